@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// buildRows returns table rows for builds bs
+func buildRows(bs []build.Build) [][]string {
+	var rows [][]string
+	for _, b := range bs {
+		rows = append(rows, []string{
+			strconv.Itoa(b.ID),
+			b.BuildTypeID,
+			b.State,
+			b.BranchName,
+			strconv.Itoa(b.PercentageComplete) + "%",
+		})
+	}
+	return rows
+}
+
+// buildsRunning lists running builds
+func buildsRunning(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("builds running")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bs, err := (&build.Config{Client: c}).RunningBuilds()
+	if err != nil {
+		return err
+	}
+	return out.print(bs, []string{"ID", "BUILD TYPE", "STATE", "BRANCH", "COMPLETE"}, buildRows(bs))
+}
+
+// buildsWait waits for running builds to finish
+func buildsWait(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("builds wait")
+	p := fs.String("project", c.DefaultProject, "only wait for builds in this project")
+	t := fs.Duration("timeout", 0, "give up after this long, 0 waits forever")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// progress goes to stderr so it does not mix with -o json|yaml output
+	return (&build.Config{Client: c, Progress: os.Stderr}).WaitForRunningBuilds(*p, *t)
+}
+
+// queueFilterFlags registers the queue filter flags on fs
+func queueFilterFlags(fs *flag.FlagSet, c *teamcity.Client) *queue.QueueFilter {
+	f := &queue.QueueFilter{}
+	fs.StringVar(&f.Project, "project", c.DefaultProject, "only builds in this project and its subprojects")
+	fs.StringVar(&f.BuildType, "type", "", "only builds of this build type")
+	fs.StringVar(&f.Branch, "branch", "", "only builds on this branch")
+	fs.StringVar(&f.User, "user", "", "only builds triggered by this username")
+	return f
+}
+
+// queueList lists queued builds
+func queueList(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("queue list")
+	f := queueFilterFlags(fs, c)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bs, err := (&queue.Config{Client: c}).ActiveQueueFiltered(f)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, b := range bs {
+		rows = append(rows, []string{strconv.Itoa(b.ID), b.BuildTypeID, b.BranchName, b.QueuedDate, b.Triggered.User.Username})
+	}
+	return out.print(bs, []string{"ID", "BUILD TYPE", "BRANCH", "QUEUED", "TRIGGERED BY"}, rows)
+}
+
+// queueClear cancels queued builds
+func queueClear(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("queue clear")
+	f := queueFilterFlags(fs, c)
+	qc := &queue.Config{Client: c}
+	fs.BoolVar(&qc.DryRun, "dry-run", false, "list the builds that would be cancelled")
+	fs.StringVar(&qc.CancelReason, "reason", "Cancelled by tcctl", "cancel comment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := qc.ClearQueueFiltered(f)
+	if r == nil {
+		return err
+	}
+	var rows [][]string
+	for _, b := range r.Builds {
+		st := "cancelled"
+		if r.DryRun {
+			st = "would cancel"
+		}
+		for _, id := range r.Skipped {
+			if id == b.ID {
+				st = "skipped"
+			}
+		}
+		for _, fl := range r.Failed {
+			if fl.ID == b.ID {
+				st = "failed: " + fl.Error
+			}
+		}
+		for _, fl := range r.NotAudited {
+			if fl.ID == b.ID {
+				st = "cancelled, " + fl.Error
+			}
+		}
+		rows = append(rows, []string{strconv.Itoa(b.ID), b.BuildTypeID, b.BranchName, st})
+	}
+	if perr := out.print(r, []string{"ID", "BUILD TYPE", "BRANCH", "RESULT"}, rows); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// triggerFlags registers the -type, -project and -file flags on fs
+func triggerFlags(fs *flag.FlagSet) (*string, *string, *string) {
+	t := fs.String("type", "", "build type ID")
+	p := fs.String("project", "", "project ID, covering all of its build types")
+	f := fs.String("file", "", "trigger state file")
+	return t, p, f
+}
+
+// parseTriggerFlags parses args and checks the trigger flags
+func parseTriggerFlags(n string, args []string) (string, string, string, error) {
+	fs := newFlags(n)
+	t, p, f := triggerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return "", "", "", err
+	}
+	if err := requireOne(map[string]string{"type": *t, "project": *p}); err != nil {
+		return "", "", "", err
+	}
+	if *f == "" {
+		return "", "", "", errors.New("-file required")
+	}
+	return *t, *p, *f, nil
+}
+
+// triggersSave saves trigger state to a file
+func triggersSave(c *teamcity.Client, out *printer, args []string) error {
+	t, p, f, err := parseTriggerFlags("triggers save", args)
+	if err != nil {
+		return err
+	}
+	bc := &build.Config{Client: c}
+	if t != "" {
+		err = bc.SaveBuildTriggerState(t, f)
+	} else {
+		err = bc.SaveProjectTriggerState(p, f)
+	}
+	if err != nil {
+		return err
+	}
+	out.message("saved trigger state to " + f)
+	return nil
+}
+
+// triggersRestore restores trigger state from a file
+func triggersRestore(c *teamcity.Client, out *printer, args []string) error {
+	t, p, f, err := parseTriggerFlags("triggers restore", args)
+	if err != nil {
+		return err
+	}
+	bc := &build.Config{Client: c}
+	if t != "" {
+		if err := bc.TriggerStateFromFile(t, f); err != nil {
+			return err
+		}
+		out.message("restored trigger state of " + t + " from " + f)
+		return nil
+	}
+	ds, err := bc.RestoreProjectTriggerState(f)
+	if err != nil {
+		return err
+	}
+	if ds == nil {
+		ds = []build.TriggerDrift{}
+	}
+	var rows [][]string
+	for _, d := range ds {
+		rows = append(rows, []string{d.Kind, d.BuildTypeID, d.TriggerID})
+	}
+	out.message("restored trigger state of " + p + " from " + f)
+	return out.print(ds, []string{"DRIFT", "BUILD TYPE", "TRIGGER"}, rows)
+}
+
+// triggersDisable saves trigger state to a file and disables all triggers
+func triggersDisable(c *teamcity.Client, out *printer, args []string) error {
+	t, p, f, err := parseTriggerFlags("triggers disable", args)
+	if err != nil {
+		return err
+	}
+	bc := &build.Config{Client: c}
+	if t != "" {
+		if err := bc.SaveBuildStateAndDisableAll(t, f); err != nil {
+			return err
+		}
+		out.message("disabled triggers of " + t + ", state saved to " + f)
+		return nil
+	}
+	if err := bc.SaveProjectStateAndDisableAll(p, f); err != nil {
+		return err
+	}
+	out.message("disabled triggers of " + p + ", state saved to " + f)
+	return nil
+}
+
+// typesList lists build types
+func typesList(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("types list")
+	p := fs.String("project", c.DefaultProject, "only build types in this project and its subprojects")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bc := &build.Config{Client: c}
+	var ts []build.Type
+	var err error
+	if *p != "" {
+		ts, err = bc.TypesForProjectTree(*p)
+	} else {
+		ts, err = bc.Types()
+	}
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, t := range ts {
+		rows = append(rows, []string{t.ID, t.Name, t.ProjectID, strconv.FormatBool(t.Paused)})
+	}
+	return out.print(ts, []string{"ID", "NAME", "PROJECT", "PAUSED"}, rows)
+}
+
+// projectNode is a project in the project tree
+type projectNode struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Projects []*projectNode `json:"projects,omitempty"`
+}
+
+// projectsTree prints the project tree below a root project
+func projectsTree(c *teamcity.Client, out *printer, args []string) error {
+	fs := newFlags("projects tree")
+	r := fs.String("root", "_Root", "root project ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ps, err := (&build.Config{Client: c}).Projects()
+	if err != nil {
+		return err
+	}
+	ns := make(map[string]*projectNode)
+	for _, p := range ps {
+		ns[p.ID] = &projectNode{ID: p.ID, Name: p.Name}
+	}
+	for _, p := range ps {
+		if pn, ok := ns[p.ParentProjectID]; ok && p.ID != p.ParentProjectID {
+			pn.Projects = append(pn.Projects, ns[p.ID])
+		}
+	}
+	root, ok := ns[*r]
+	if !ok {
+		return errors.New("project " + *r + " not found")
+	}
+	var rows [][]string
+	var walk func(n *projectNode, d int)
+	walk = func(n *projectNode, d int) {
+		rows = append(rows, []string{strings.Repeat("  ", d) + n.ID, n.Name})
+		for _, cn := range n.Projects {
+			walk(cn, d+1)
+		}
+	}
+	walk(root, 0)
+	return out.print(root, []string{"ID", "NAME"}, rows)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config contains the TeamCity connection settings
+type config struct {
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+}
+
+// defaultConfigFile returns the config file used when none is given
+func defaultConfigFile() string {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, "tcctl", "config.yaml")
+}
+
+// loadConfig reads config file f, then applies the TEAMCITY_* env vars on top.
+// If f is empty the default config file is read if it exists.
+func loadConfig(f string, getenv func(string) string) (*config, error) {
+	c := &config{}
+	explicit := f != ""
+	if !explicit {
+		f = defaultConfigFile()
+	}
+	if f != "" {
+		bd, err := ioutil.ReadFile(f)
+		if err != nil && (explicit || !os.IsNotExist(err)) {
+			return nil, err
+		}
+		if err == nil {
+			if yerr := yaml.UnmarshalStrict(bd, c); yerr != nil {
+				return nil, errors.New(f + ": " + yerr.Error())
+			}
+		}
+	}
+	if v := getenv("TEAMCITY_HOST"); v != "" {
+		c.Host = v
+	}
+	if v := getenv("TEAMCITY_USER"); v != "" {
+		c.User = v
+	}
+	if v := getenv("TEAMCITY_PASS"); v != "" {
+		c.Pass = v
+	}
+	if c.Host == "" {
+		return nil, errors.New("TeamCity host required, set TEAMCITY_HOST or host in " + f)
+	}
+	return c, nil
+}
+
+// newClient returns a client for profile pf if set, otherwise for config file f
+func newClient(f string, pf string, getenv func(string) string) (*teamcity.Client, error) {
+	if pf != "" {
+		return teamcity.NewFromProfile(pf)
+	}
+	c, err := loadConfig(f, getenv)
+	if err != nil {
+		return nil, err
+	}
+	return teamcity.New(c.Host, c.User, c.Pass), nil
+}
@@ -0,0 +1,134 @@
+// Command tcctl manages a TeamCity server from the command line
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/audit"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+const usage = `usage: tcctl [-config file | -profile name] [-o table|json|yaml] [-dry-run] [-audit file] <command> <subcommand> [flags]
+
+Connection settings are read from the config file and can be overridden
+with TEAMCITY_HOST, TEAMCITY_USER and TEAMCITY_PASS. With -profile or
+TEAMCITY_PROFILE they are read from the profiles file instead, and the
+profile's default project applies to commands taking -project.
+
+With -dry-run, requests that would change the server are printed to
+stderr instead of being sent. With -audit or TCCTL_AUDIT every change
+is recorded in the given file.
+
+commands:
+`
+
+// command runs a subcommand with its remaining arguments
+type command struct {
+	help string
+	run  func(c *teamcity.Client, out *printer, args []string) error
+}
+
+// commands contains all subcommands keyed by "command subcommand"
+var commands = map[string]command{
+	"builds running":   {"list running builds", buildsRunning},
+	"builds wait":      {"wait for running builds to finish", buildsWait},
+	"queue list":       {"list queued builds", queueList},
+	"queue clear":      {"cancel queued builds", queueClear},
+	"triggers save":    {"save trigger state to a file", triggersSave},
+	"triggers restore": {"restore trigger state from a file", triggersRestore},
+	"triggers disable": {"save trigger state to a file and disable all triggers", triggersDisable},
+	"types list":       {"list build types", typesList},
+	"projects tree":    {"print the project tree", projectsTree},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Getenv, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "tcctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs tcctl with arguments args, reading env vars with getenv and writing output to w
+func run(args []string, getenv func(string) string, w io.Writer) error {
+	fs := flag.NewFlagSet("tcctl", flag.ContinueOnError)
+	fs.SetOutput(w)
+	cf := fs.String("config", getenv("TCCTL_CONFIG"), "config file")
+	pf := fs.String("profile", getenv("TEAMCITY_PROFILE"), "profile from the profiles file")
+	o := fs.String("o", formatTable, "output format: table, json or yaml")
+	af := fs.String("audit", getenv("TCCTL_AUDIT"), "append a record of every change made to this JSONL file")
+	dr := fs.Bool("dry-run", false, "print the changes instead of making them, read-only requests are still sent")
+	fs.Usage = func() { printUsage(w, fs) }
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("command and subcommand required")
+	}
+	cmd, ok := commands[fs.Arg(0)+" "+fs.Arg(1)]
+	if !ok {
+		return errors.New("unknown command " + fs.Arg(0) + " " + fs.Arg(1))
+	}
+	out, err := newPrinter(w, *o)
+	if err != nil {
+		return err
+	}
+	c, err := newClient(*cf, *pf, getenv)
+	if err != nil {
+		return err
+	}
+	if *af != "" {
+		c.Audit = &audit.Log{File: *af}
+	}
+	if *dr {
+		c.DryRun = teamcity.NewPlan(os.Stderr)
+	}
+	return cmd.run(c, out, fs.Args()[2:])
+}
+
+// printUsage writes the usage text, global flags and commands to w
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprint(w, usage)
+	var ns []string
+	for n := range commands {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	for _, n := range ns {
+		fmt.Fprintf(w, "  %-18s %s\n", n, commands[n].help)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	fs.PrintDefaults()
+}
+
+// newFlags returns a flag set for subcommand n
+func newFlags(n string) *flag.FlagSet {
+	fs := flag.NewFlagSet("tcctl "+n, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// requireOne returns an error unless exactly one of the named values is set
+func requireOne(vs map[string]string) error {
+	var set, ns []string
+	for n, v := range vs {
+		ns = append(ns, "-"+n)
+		if v != "" {
+			set = append(set, n)
+		}
+	}
+	if len(set) != 1 {
+		sort.Strings(ns)
+		return errors.New("exactly one of " + strings.Join(ns, ", ") + " required")
+	}
+	return nil
+}
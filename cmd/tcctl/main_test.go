@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/audit"
+	"github.com/robertlestak/go-teamcity/pkg/teamcitytest"
+)
+
+// newServer returns a server with a small project tree and two build types
+func newServer() *httptest.Server {
+	routes := map[string]string{
+		"/httpAuth/app/rest/projects": `{"project":[
+			{"id":"_Root","name":"<Root project>"},
+			{"id":"Payments","name":"Payments","parentProjectId":"_Root"},
+			{"id":"Payments_Api","name":"Api","parentProjectId":"Payments"}]}`,
+		"/httpAuth/app/rest/buildTypes": `{"buildType":[
+			{"id":"Payments_Build","name":"Build","projectId":"Payments"},
+			{"id":"Payments_Api_Test","name":"Test","projectId":"Payments_Api","paused":true}]}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rd, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rd))
+	}))
+}
+
+// env returns a getenv func reading from m
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+// TestRunOutputFormats tests table, JSON and YAML output
+func TestRunOutputFormats(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+	e := env(map[string]string{"TEAMCITY_HOST": ts.URL, "TCCTL_CONFIG": os.DevNull})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"projects", "tree"}, "ID                NAME\n_Root             <Root project>\n  Payments        Payments\n    Payments_Api  Api\n"},
+		{[]string{"-o", "json", "projects", "tree", "-root", "Payments_Api"}, "{\n  \"id\": \"Payments_Api\",\n  \"name\": \"Api\"\n}\n"},
+		{[]string{"-o", "yaml", "projects", "tree", "-root", "Payments_Api"}, "id: Payments_Api\nname: Api\n"},
+		{[]string{"types", "list", "-project", "Payments_Api"}, "ID                 NAME  PROJECT       PAUSED\nPayments_Api_Test  Test  Payments_Api  true\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := run(tt.args, e, &b); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%v output:\n%s\nwant:\n%s", tt.args, b.String(), tt.want)
+		}
+	}
+}
+
+// TestRunErrors tests that bad invocations are rejected
+func TestRunErrors(t *testing.T) {
+	e := env(map[string]string{"TEAMCITY_HOST": "http://127.0.0.1:0", "TCCTL_CONFIG": os.DevNull})
+	bad := [][]string{
+		{"queue"},
+		{"queue", "purge"},
+		{"-o", "xml", "queue", "list"},
+		{"triggers", "save", "-file", "state.json"},
+		{"triggers", "save", "-type", "Payments_Build"},
+	}
+	for _, args := range bad {
+		if err := run(args, e, ioutil.Discard); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
+
+// TestLoadConfig tests that env vars override the config file
+func TestLoadConfig(t *testing.T) {
+	d, err := ioutil.TempDir("", "tcctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "config.yaml")
+	if err := ioutil.WriteFile(f, []byte("host: https://uat\nuser: ci\npass: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(f, env(map[string]string{"TEAMCITY_HOST": "https://prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Host != "https://prod" || c.User != "ci" || c.Pass != "secret" {
+		t.Errorf("unexpected config: %+v", c)
+	}
+	if _, err := loadConfig(filepath.Join(d, "missing.yaml"), env(nil)); err == nil {
+		t.Error("expected error for missing explicit config file")
+	}
+}
+
+// TestRunDryRun tests that -dry-run sends no mutating requests
+func TestRunDryRun(t *testing.T) {
+	s := teamcitytest.NewServer(teamcitytest.State{
+		Projects:   []teamcitytest.Project{{ID: "Payments", Name: "Payments"}},
+		BuildTypes: []teamcitytest.BuildType{{ID: "Payments_Build", Name: "Build", ProjectID: "Payments", Triggers: []teamcitytest.Trigger{{ID: "vcs", Type: "vcsTrigger"}}}},
+		Builds:     []teamcitytest.Build{{ID: 1, BuildTypeID: "Payments_Build"}},
+	})
+	defer s.Close()
+	d, err := ioutil.TempDir("", "tcctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	e := env(map[string]string{"TEAMCITY_HOST": s.URL, "TCCTL_CONFIG": os.DevNull})
+	for _, args := range [][]string{
+		{"-dry-run", "queue", "clear", "-project", "Payments"},
+		{"-dry-run", "triggers", "disable", "-type", "Payments_Build", "-file", filepath.Join(d, "triggers.json")},
+	} {
+		if err := run(args, e, ioutil.Discard); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	for _, r := range s.Requests() {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("dry run sent %s", r)
+		}
+	}
+}
+
+// TestRunAudit tests that -audit records the changes a command makes
+func TestRunAudit(t *testing.T) {
+	s := teamcitytest.NewServer(teamcitytest.State{
+		Projects:   []teamcitytest.Project{{ID: "Payments", Name: "Payments"}},
+		BuildTypes: []teamcitytest.BuildType{{ID: "Payments_Build", Name: "Build", ProjectID: "Payments"}},
+		Builds:     []teamcitytest.Build{{ID: 1, BuildTypeID: "Payments_Build"}},
+	})
+	defer s.Close()
+	d, err := ioutil.TempDir("", "tcctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "audit.jsonl")
+	e := env(map[string]string{"TEAMCITY_HOST": s.URL, "TCCTL_CONFIG": os.DevNull, "TCCTL_AUDIT": f})
+	if err := run([]string{"queue", "clear", "-project", "Payments"}, e, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := audit.Read(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].Method != "POST" || rs[1].Method != "DELETE" {
+		t.Errorf("audit records = %+v", rs)
+	}
+}
+
+// TestRunTriggersProject tests that triggers disable and restore cover the whole project tree
+func TestRunTriggersProject(t *testing.T) {
+	vcs := []teamcitytest.Trigger{{ID: "vcs", Type: "vcsTrigger"}}
+	s := teamcitytest.NewServer(teamcitytest.State{
+		Projects: []teamcitytest.Project{
+			{ID: "Payments", Name: "Payments"},
+			{ID: "Payments_Api", Name: "API", ParentProjectID: "Payments"},
+			{ID: "Payments_Api_V2", Name: "V2", ParentProjectID: "Payments_Api"},
+		},
+		BuildTypes: []teamcitytest.BuildType{
+			{ID: "Payments_Build", Name: "Build", ProjectID: "Payments", Triggers: vcs},
+			{ID: "Payments_Api_Build", Name: "Build", ProjectID: "Payments_Api", Triggers: vcs},
+			{ID: "Payments_Api_V2_Build", Name: "Build", ProjectID: "Payments_Api_V2", Triggers: vcs},
+		},
+	})
+	defer s.Close()
+	d, err := ioutil.TempDir("", "tcctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "triggers.json")
+	e := env(map[string]string{"TEAMCITY_HOST": s.URL, "TCCTL_CONFIG": os.DevNull})
+	if err := run([]string{"triggers", "disable", "-project", "Payments", "-file", f}, e, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for _, bt := range s.State().BuildTypes {
+		if !bt.Triggers[0].Disabled {
+			t.Errorf("trigger of %s not disabled", bt.ID)
+		}
+	}
+	if err := run([]string{"triggers", "restore", "-project", "Payments", "-file", f}, e, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for _, bt := range s.State().BuildTypes {
+		if bt.Triggers[0].Disabled {
+			t.Errorf("trigger of %s not restored", bt.ID)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// printer writes command results in the selected format
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// newPrinter returns a printer writing format f to w
+func newPrinter(w io.Writer, f string) (*printer, error) {
+	switch f {
+	case formatTable, formatJSON, formatYAML:
+		return &printer{w: w, format: f}, nil
+	}
+	return nil, errors.New("unknown output format " + f + ", use table, json or yaml")
+}
+
+// print writes v as JSON or YAML, or rows under headers hs as a table
+func (p *printer) print(v interface{}, hs []string, rows [][]string) error {
+	switch p.format {
+	case formatJSON:
+		bd, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, string(bd))
+		return err
+	case formatYAML:
+		// go through JSON so the output uses the API field names
+		bd, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var y interface{}
+		if err := yaml.Unmarshal(bd, &y); err != nil {
+			return err
+		}
+		yd, err := yaml.Marshal(y)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(yd)
+		return err
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	if len(hs) > 0 {
+		fmt.Fprintln(tw, strings.Join(hs, "\t"))
+	}
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message writes a line of text in table mode only
+func (p *printer) message(s string) {
+	if p.format == formatTable {
+		fmt.Fprintln(p.w, s)
+	}
+}
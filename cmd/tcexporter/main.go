@@ -0,0 +1,35 @@
+// Command tcexporter serves TeamCity queue, build and agent metrics for Prometheus
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/robertlestak/go-teamcity/pkg/exporter"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+func main() {
+	l := flag.String("listen", ":9190", "address to serve /metrics on")
+	ca := flag.Duration("cache", 0, "how long a poll of TeamCity is reused across scrapes")
+	pf := flag.String("profile", os.Getenv("TEAMCITY_PROFILE"), "profile from the profiles file, instead of TEAMCITY_HOST/USER/PASS")
+	flag.Parse()
+	var c *teamcity.Client
+	if *pf != "" {
+		var err error
+		c, err = teamcity.NewFromProfile(*pf)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		c = teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+		if c.Host == "" {
+			log.Fatal("TEAMCITY_HOST or -profile required")
+		}
+	}
+	http.Handle("/metrics", &exporter.Config{Client: c, CacheTTL: *ca})
+	log.Println("serving metrics on " + *l + "/metrics")
+	log.Fatal(http.ListenAndServe(*l, nil))
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// Config contains config data
+type Config struct {
+	Client *teamcity.Client
+	// DrainComment is the comment set on agents disabled by Drain
+	DrainComment string
+	// Progress, if set, receives a line for each running build while draining
+	Progress io.Writer
+}
+
+// Agent contains build agent data
+type Agent struct {
+	ID             int          `json:"id"`
+	Name           string       `json:"name"`
+	TypeID         int          `json:"typeId"`
+	Connected      bool         `json:"connected"`
+	Enabled        bool         `json:"enabled"`
+	Authorized     bool         `json:"authorized"`
+	IP             string       `json:"ip"`
+	HREF           string       `json:"href"`
+	WebURL         string       `json:"webUrl"`
+	Pool           Pool         `json:"pool"`
+	EnabledInfo    StatusInfo   `json:"enabledInfo"`
+	AuthorizedInfo StatusInfo   `json:"authorizedInfo"`
+	Properties     Properties   `json:"properties"`
+	Build          *build.Build `json:"build"`
+}
+
+// StatusInfo contains agent enabled or authorized status data
+type StatusInfo struct {
+	Status           bool    `json:"status"`
+	Comment          Comment `json:"comment"`
+	StatusSwitchTime string  `json:"statusSwitchTime,omitempty"`
+}
+
+// Comment contains agent status comment data
+type Comment struct {
+	Text      string      `json:"text"`
+	Timestamp string      `json:"timestamp,omitempty"`
+	User      *build.User `json:"user,omitempty"`
+}
+
+// Properties contains agent property data, shared with buildType settings
+type Properties = build.Properties
+
+// Property contains an agent property
+type Property = build.Property
+
+// agentFields are the agent fields requested for agent lists
+const agentFields = "id,name,typeId,connected,enabled,authorized,ip,href,webUrl,pool(id,name,href)," +
+	"enabledInfo(status,comment(text,timestamp,user(id,username,name)),statusSwitchTime)," +
+	"authorizedInfo(status,comment(text,timestamp,user(id,username,name)))," +
+	"properties(count,property(name,value)),build(id,buildTypeId,number,state,status,percentageComplete,href,webUrl)"
+
+// Property returns the value of agent property n
+func (a *Agent) Property(n string) string {
+	return a.Properties.Get(n)
+}
+
+// OS returns the agent operating system name
+func (a *Agent) OS() string {
+	if os := a.Property("teamcity.agent.jvm.os.name"); os != "" {
+		return os
+	}
+	return a.Property("env.OS")
+}
+
+// Agents returns list of all agents, including disconnected and unauthorized agents
+func (c *Config) Agents() ([]Agent, error) {
+	return c.AgentsFiltered("defaultFilter:false")
+}
+
+// AgentsFiltered returns list of agents matching agent locator l
+func (c *Config) AgentsFiltered(l string) ([]Agent, error) {
+	type agents struct {
+		Count int     `json:"count"`
+		Agent []Agent `json:"agent"`
+	}
+	as := &agents{}
+	u := "/httpAuth/app/rest/agents?fields=" + url.QueryEscape("count,agent("+agentFields+")")
+	if l != "" {
+		u += "&locator=" + url.QueryEscape(l)
+	}
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &as)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return as.Agent, nil
+}
+
+// GetAgent gets agent data for agent ID i
+func (c *Config) GetAgent(i int) (*Agent, error) {
+	a := &Agent{}
+	u := "/httpAuth/app/rest/agents/id:" + strconv.Itoa(i) + "?fields=" + url.QueryEscape(agentFields)
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &a)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return a, nil
+}
+
+// setStatusInfo sets the enabledInfo or authorizedInfo status for agent i
+func (c *Config) setStatusInfo(i int, info string, si StatusInfo) error {
+	jd, jerr := json.Marshal(si)
+	if jerr != nil {
+		return jerr
+	}
+	u := "/httpAuth/app/rest/agents/id:" + strconv.Itoa(i) + "/" + info
+	_, err := c.Client.HTTPRequestWithType("PUT", u, jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetEnabled sets the enabled status for agent i with comment cm.
+// If r is not zero, TeamCity switches the status back at time r.
+func (c *Config) SetEnabled(i int, e bool, cm string, r time.Time) error {
+	si := StatusInfo{Status: e, Comment: Comment{Text: cm}}
+	if !r.IsZero() {
+		si.StatusSwitchTime = r.Format(build.TimeFormat)
+	}
+	return c.setStatusInfo(i, "enabledInfo", si)
+}
+
+// EnableAgent enables agent i
+func (c *Config) EnableAgent(i int, cm string) error {
+	return c.SetEnabled(i, true, cm, time.Time{})
+}
+
+// DisableAgent disables agent i, re-enabling it at time r if r is not zero
+func (c *Config) DisableAgent(i int, cm string, r time.Time) error {
+	return c.SetEnabled(i, false, cm, r)
+}
+
+// SetAuthorized sets the authorized status for agent i with comment cm
+func (c *Config) SetAuthorized(i int, a bool, cm string) error {
+	return c.setStatusInfo(i, "authorizedInfo", StatusInfo{Status: a, Comment: Comment{Text: cm}})
+}
+
+// AuthorizeAgent authorizes agent i
+func (c *Config) AuthorizeAgent(i int, cm string) error {
+	return c.SetAuthorized(i, true, cm)
+}
+
+// UnauthorizeAgent unauthorizes agent i
+func (c *Config) UnauthorizeAgent(i int, cm string) error {
+	return c.SetAuthorized(i, false, cm)
+}
+
+// RunningBuild returns the build running on agent i, or nil if it is idle
+func (c *Config) RunningBuild(i int) (*build.Build, error) {
+	type runningBuilds struct {
+		Count int           `json:"count"`
+		Build []build.Build `json:"build"`
+	}
+	rb := &runningBuilds{}
+	l := "running:true,agent:(id:" + strconv.Itoa(i) + ")"
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/builds?locator="+url.QueryEscape(l), nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &rb)
+	if jerr != nil {
+		return nil, jerr
+	}
+	if len(rb.Build) == 0 {
+		return nil, nil
+	}
+	return &rb.Build[0], nil
+}
+
+// AgentsSummary returns a human readable summary of agents as
+func AgentsSummary(as []Agent) string {
+	bd := "Agents: " + strconv.Itoa(len(as)) + "\n"
+	for _, a := range as {
+		bd += a.Name + " (" + strconv.Itoa(a.ID) + "): "
+		switch {
+		case !a.Authorized:
+			bd += "unauthorized"
+		case !a.Connected:
+			bd += "disconnected"
+		case !a.Enabled:
+			bd += "disabled"
+		case a.Build != nil:
+			bd += "running " + a.Build.BuildTypeID + " (" + strconv.Itoa(a.Build.ID) + ")"
+		default:
+			bd += "idle"
+		}
+		if a.Pool.Name != "" {
+			bd += ", pool " + a.Pool.Name
+		}
+		bd += "\n"
+	}
+	return bd
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestAgents tests listing and disabling agents against a stub server
+func TestAgents(t *testing.T) {
+	var enabledInfo StatusInfo
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/agents":
+			if r.URL.Query().Get("locator") != "defaultFilter:false" {
+				t.Errorf("unexpected locator %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"count":2,"agent":[
+				{"id":1,"name":"linux-1","connected":true,"enabled":true,"authorized":true,"pool":{"id":0,"name":"Default"},
+				 "properties":{"property":[{"name":"teamcity.agent.jvm.os.name","value":"Linux"}]},
+				 "build":{"id":42,"buildTypeId":"bt1"}},
+				{"id":2,"name":"linux-2","connected":false,"enabled":true,"authorized":true}]}`))
+		case r.Method == "PUT" && r.URL.Path == "/httpAuth/app/rest/agents/id:1/enabledInfo":
+			bd, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(bd, &enabledInfo)
+			w.Write(bd)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	as, err := c.Agents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(as) != 2 || as[0].OS() != "Linux" || as[0].Build == nil || as[0].Build.ID != 42 {
+		t.Errorf("unexpected agents: %+v", as)
+	}
+	s := AgentsSummary(as)
+	if !strings.Contains(s, "running bt1 (42), pool Default") || !strings.Contains(s, "linux-2 (2): disconnected") {
+		t.Errorf("unexpected summary:\n%s", s)
+	}
+	r := time.Date(2019, 2, 25, 18, 0, 0, 0, time.UTC)
+	if err := c.DisableAgent(1, "patching", r); err != nil {
+		t.Fatal(err)
+	}
+	if enabledInfo.Status || enabledInfo.Comment.Text != "patching" || enabledInfo.StatusSwitchTime != "20190225T180000+0000" {
+		t.Errorf("unexpected enabledInfo: %+v", enabledInfo)
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// Compatibility contains whether an agent can run a buildType and why not
+type Compatibility struct {
+	BuildTypeID string   `json:"buildTypeId"`
+	AgentID     int      `json:"agentId"`
+	AgentName   string   `json:"agentName"`
+	Compatible  bool     `json:"compatible"`
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+// Matrix contains the compatibility of every buildType with every agent
+type Matrix struct {
+	BuildTypes []string        `json:"buildTypes"`
+	Agents     []string        `json:"agents"`
+	Entries    []Compatibility `json:"entries"`
+}
+
+// CompatibilityMatrix computes the compatibility of buildTypes ts with all authorized agents.
+// Only explicit agent requirements are evaluated, requirements which reference
+// parameters are assumed to be met.
+func (c *Config) CompatibilityMatrix(ts []build.Type) (*Matrix, error) {
+	as, err := c.AgentsFiltered("authorized:true,defaultFilter:false")
+	if err != nil {
+		return nil, err
+	}
+	bc := &build.Config{Client: c.Client}
+	m := &Matrix{}
+	for _, a := range as {
+		m.Agents = append(m.Agents, a.Name)
+	}
+	for _, t := range ts {
+		rs, err := bc.AgentRequirements(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		m.BuildTypes = append(m.BuildTypes, t.ID)
+		for _, a := range as {
+			m.Entries = append(m.Entries, Compatible(t.ID, rs, a))
+		}
+	}
+	return m, nil
+}
+
+// Compatible checks agent a against requirements rs for buildType id
+func Compatible(id string, rs []build.Requirement, a Agent) Compatibility {
+	props := make(map[string]string)
+	for _, p := range a.Properties.Property {
+		props[p.Name] = p.Value
+	}
+	ct := Compatibility{BuildTypeID: id, AgentID: a.ID, AgentName: a.Name, Compatible: true}
+	for _, r := range rs {
+		if r.Disabled {
+			continue
+		}
+		if ok, reason := EvaluateRequirement(r, props); !ok {
+			ct.Compatible = false
+			ct.Reasons = append(ct.Reasons, reason)
+		}
+	}
+	return ct
+}
+
+// EvaluateRequirement checks requirement r against agent properties props
+// and returns why it is not met
+func EvaluateRequirement(r build.Requirement, props map[string]string) (bool, string) {
+	n := r.PropertyName()
+	v := r.PropertyValue()
+	if strings.Contains(n, "%") || strings.Contains(v, "%") {
+		return true, ""
+	}
+	av, exists := props[n]
+	var ok bool
+	switch r.Type {
+	case "exists":
+		ok = exists
+	case "not-exists":
+		ok = !exists
+	case "equals":
+		ok = exists && av == v
+	case "does-not-equal":
+		ok = av != v
+	case "contains":
+		ok = exists && strings.Contains(av, v)
+	case "does-not-contain":
+		ok = !strings.Contains(av, v)
+	case "starts-with":
+		ok = exists && strings.HasPrefix(av, v)
+	case "ends-with":
+		ok = exists && strings.HasSuffix(av, v)
+	case "matches", "does-not-match":
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return false, "invalid requirement pattern " + v + " for " + n
+		}
+		ok = exists && re.MatchString(av)
+		if r.Type == "does-not-match" {
+			ok = !ok
+		}
+	case "more-than", "less-than", "no-more-than", "no-less-than":
+		ok = exists && compareNumbers(r.Type, av, v)
+	case "ver-more-than", "ver-less-than", "ver-no-more-than", "ver-no-less-than":
+		ok = exists && compareInt(strings.TrimPrefix(r.Type, "ver-"), compareVersions(av, v))
+	default:
+		return false, "unknown requirement type " + r.Type + " for " + n
+	}
+	if ok {
+		return true, ""
+	}
+	if !exists {
+		return false, "Unmet requirement: " + n + " " + r.Type + " " + v + " (property not defined)"
+	}
+	return false, "Unmet requirement: " + n + " " + r.Type + " " + v + " (agent has " + av + ")"
+}
+
+// compareNumbers compares numeric property values a and b with comparison t
+func compareNumbers(t string, a string, b string) bool {
+	af, aerr := strconv.ParseFloat(a, 64)
+	bf, berr := strconv.ParseFloat(b, 64)
+	if aerr != nil || berr != nil {
+		return false
+	}
+	switch {
+	case af < bf:
+		return compareInt(t, -1)
+	case af > bf:
+		return compareInt(t, 1)
+	}
+	return compareInt(t, 0)
+}
+
+// compareInt checks the comparison result r against comparison t
+func compareInt(t string, r int) bool {
+	switch t {
+	case "more-than":
+		return r > 0
+	case "less-than":
+		return r < 0
+	case "no-more-than":
+		return r <= 0
+	case "no-less-than":
+		return r >= 0
+	}
+	return false
+}
+
+// compareVersions compares dotted versions a and b, returning -1, 0 or 1
+func compareVersions(a string, b string) int {
+	as := strings.FieldsFunc(a, func(r rune) bool { return r == '.' || r == '_' || r == '-' })
+	bs := strings.FieldsFunc(b, func(r rune) bool { return r == '.' || r == '_' || r == '-' })
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var ap, bp string
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		an, aerr := strconv.Atoi(ap)
+		bn, berr := strconv.Atoi(bp)
+		if aerr == nil && berr == nil || ap == "" || bp == "" {
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if ap != bp {
+			if ap < bp {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// CompatibleAgents returns the compatible agents for buildType id
+func (m *Matrix) CompatibleAgents(id string) []Compatibility {
+	var cs []Compatibility
+	for _, e := range m.Entries {
+		if e.BuildTypeID == id && e.Compatible {
+			cs = append(cs, e)
+		}
+	}
+	return cs
+}
+
+// Incompatibilities returns the incompatible agents for buildType id with their reasons
+func (m *Matrix) Incompatibilities(id string) []Compatibility {
+	var cs []Compatibility
+	for _, e := range m.Entries {
+		if e.BuildTypeID == id && !e.Compatible {
+			cs = append(cs, e)
+		}
+	}
+	return cs
+}
+
+// AtRisk returns the buildTypes with at most n compatible agents, fewest first
+func (m *Matrix) AtRisk(n int) []string {
+	counts := make(map[string]int)
+	for _, e := range m.Entries {
+		if e.Compatible {
+			counts[e.BuildTypeID]++
+		}
+	}
+	var ids []string
+	for _, id := range m.BuildTypes {
+		if counts[id] <= n {
+			ids = append(ids, id)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return counts[ids[i]] < counts[ids[j]]
+	})
+	return ids
+}
+
+// MatrixSummary returns a human readable summary of buildTypes with at most one compatible agent
+func MatrixSummary(m *Matrix) string {
+	rs := m.AtRisk(1)
+	bd := "Build Types With At Most One Compatible Agent: " + strconv.Itoa(len(rs)) + "\n"
+	for _, id := range rs {
+		ca := m.CompatibleAgents(id)
+		bd += id + ": " + strconv.Itoa(len(ca)) + " compatible"
+		if len(ca) == 1 {
+			bd += " (" + ca[0].AgentName + ")"
+		}
+		bd += "\n"
+		for _, ic := range m.Incompatibilities(id) {
+			bd += "  " + ic.AgentName + ": " + strings.Join(ic.Reasons, "; ") + "\n"
+		}
+	}
+	return bd
+}
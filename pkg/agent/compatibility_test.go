@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// requirement returns a requirement of type t for property n and value v
+func requirement(t string, n string, v string) build.Requirement {
+	return build.Requirement{Type: t, Properties: build.Properties{Property: []build.Property{
+		{Name: "property-name", Value: n},
+		{Name: "property-value", Value: v},
+	}}}
+}
+
+// TestEvaluateRequirement tests EvaluateRequirement for each comparison type
+func TestEvaluateRequirement(t *testing.T) {
+	props := map[string]string{
+		"teamcity.agent.jvm.os.name": "Linux",
+		"system.cpus":                "8",
+		"env.JDK_VERSION":            "11.0.2",
+	}
+	tests := []struct {
+		r    build.Requirement
+		want bool
+	}{
+		{requirement("exists", "system.cpus", ""), true},
+		{requirement("not-exists", "env.DOCKER", ""), true},
+		{requirement("equals", "teamcity.agent.jvm.os.name", "Windows 10"), false},
+		{requirement("contains", "teamcity.agent.jvm.os.name", "Lin"), true},
+		{requirement("starts-with", "teamcity.agent.jvm.os.name", "Mac"), false},
+		{requirement("matches", "teamcity.agent.jvm.os.name", "L.*x"), true},
+		{requirement("no-less-than", "system.cpus", "8"), true},
+		{requirement("more-than", "system.cpus", "16"), false},
+		{requirement("ver-no-less-than", "env.JDK_VERSION", "1.8"), true},
+		{requirement("ver-more-than", "env.JDK_VERSION", "11.0.10"), false},
+		{requirement("equals", "env.MISSING", "x"), false},
+		{requirement("equals", "%dep.property%", "x"), true},
+	}
+	for _, tt := range tests {
+		ok, reason := EvaluateRequirement(tt.r, props)
+		if ok != tt.want {
+			t.Errorf("%s %s %s = %v (%s), want %v", tt.r.PropertyName(), tt.r.Type, tt.r.PropertyValue(), ok, reason, tt.want)
+		}
+		if !ok && reason == "" {
+			t.Errorf("%s %s has no reason", tt.r.PropertyName(), tt.r.Type)
+		}
+	}
+}
+
+// TestCompatibilityMatrix tests CompatibilityMatrix against a stub server
+func TestCompatibilityMatrix(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/httpAuth/app/rest/agents":
+			w.Write([]byte(`{"agent":[
+				{"id":1,"name":"linux-1","properties":{"property":[{"name":"teamcity.agent.jvm.os.name","value":"Linux"}]}},
+				{"id":2,"name":"windows-1","properties":{"property":[{"name":"teamcity.agent.jvm.os.name","value":"Windows 10"}]}}]}`))
+		case "/httpAuth/app/rest/buildTypes/id:linux_only/agent-requirements":
+			w.Write([]byte(`{"agent-requirement":[{"id":"RQ_1","type":"equals","properties":{"property":[
+				{"name":"property-name","value":"teamcity.agent.jvm.os.name"},{"name":"property-value","value":"Linux"}]}}]}`))
+		case "/httpAuth/app/rest/buildTypes/id:any/agent-requirements":
+			w.Write([]byte(`{"count":0}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	m, err := c.CompatibilityMatrix([]build.Type{{ID: "linux_only"}, {ID: "any"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 4 || len(m.CompatibleAgents("any")) != 2 {
+		t.Errorf("unexpected matrix: %+v", m)
+	}
+	rs := m.AtRisk(1)
+	if len(rs) != 1 || rs[0] != "linux_only" {
+		t.Errorf("at risk = %v, want [linux_only]", rs)
+	}
+	s := MatrixSummary(m)
+	if !strings.Contains(s, "linux_only: 1 compatible (linux-1)") || !strings.Contains(s, "windows-1: Unmet requirement") {
+		t.Errorf("unexpected summary:\n%s", s)
+	}
+}
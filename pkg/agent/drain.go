@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// DefaultDrainComment is the comment set on drained agents if DrainComment is empty
+const DefaultDrainComment = "Drained for maintenance"
+
+// drainComment returns the comment set on drained agents
+func (c *Config) drainComment() string {
+	if c.DrainComment != "" {
+		return c.DrainComment
+	}
+	return DefaultDrainComment
+}
+
+// Drain disables agent i and waits up to timeout t for its running build to finish.
+// Agents which are already disabled keep their comment. The agent stays disabled
+// if the timeout is reached.
+func (c *Config) Drain(i int, t time.Duration) error {
+	a, aerr := c.GetAgent(i)
+	if aerr != nil {
+		return aerr
+	}
+	if a.Enabled {
+		derr := c.DisableAgent(i, c.drainComment(), time.Time{})
+		if derr != nil {
+			return derr
+		}
+	}
+	err := build.WaitUntil(func() (bool, error) {
+		b, err := c.RunningBuild(i)
+		if err != nil {
+			return false, err
+		}
+		if b == nil {
+			return true, nil
+		}
+		if c.Progress != nil {
+			fmt.Fprintf(c.Progress, "Agent %d running %s (%d): %d%%\n", i, b.BuildTypeID, b.ID, b.PercentageComplete)
+		}
+		return false, nil
+	}, t)
+	if err == build.ErrTimeout {
+		return errors.New("Timeout reached draining agent " + strconv.Itoa(i))
+	}
+	return err
+}
+
+// Undrain re-enables agent i if it was disabled by Drain.
+// An agent disabled with any other comment is left disabled and an error is returned.
+func (c *Config) Undrain(i int) error {
+	a, err := c.GetAgent(i)
+	if err != nil {
+		return err
+	}
+	if a.Enabled {
+		return nil
+	}
+	if a.EnabledInfo.Comment.Text != c.drainComment() {
+		return errors.New("agent " + strconv.Itoa(i) + " was not disabled by Drain: " + a.EnabledInfo.Comment.Text)
+	}
+	return c.EnableAgent(i, "")
+}
+
+// DrainAgents drains agents ids, draining at most max agents at once.
+// If max is less than 1, all agents are drained at once.
+func (c *Config) DrainAgents(ids []int, t time.Duration, max int) error {
+	if max < 1 || max > len(ids) {
+		max = len(ids)
+	}
+	sem := make(chan struct{}, max)
+	res := make(chan error, len(ids))
+	for _, id := range ids {
+		sem <- struct{}{}
+		go func(i int) {
+			res <- c.Drain(i, t)
+			<-sem
+		}(id)
+	}
+	var erstrs []string
+	for range ids {
+		if err := <-res; err != nil {
+			erstrs = append(erstrs, err.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
+
+// PoolAgentIDs returns the IDs of all authorized agents in pool p
+func (c *Config) PoolAgentIDs(p int) ([]int, error) {
+	as, err := c.AgentsFiltered("pool:(id:" + strconv.Itoa(p) + "),authorized:true,defaultFilter:false")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, a := range as {
+		ids = append(ids, a.ID)
+	}
+	return ids, nil
+}
+
+// DrainPool drains all agents in pool p, draining at most max agents at once
+func (c *Config) DrainPool(p int, t time.Duration, max int) error {
+	ids, err := c.PoolAgentIDs(p)
+	if err != nil {
+		return err
+	}
+	return c.DrainAgents(ids, t, max)
+}
+
+// UndrainPool re-enables the agents in pool p which were disabled by Drain.
+// Agents disabled with any other comment are left disabled.
+func (c *Config) UndrainPool(p int) error {
+	as, err := c.AgentsFiltered("pool:(id:" + strconv.Itoa(p) + "),authorized:true,defaultFilter:false")
+	if err != nil {
+		return err
+	}
+	var erstrs []string
+	for _, a := range as {
+		if a.Enabled || a.EnabledInfo.Comment.Text != c.drainComment() {
+			continue
+		}
+		if err := c.EnableAgent(a.ID, ""); err != nil {
+			erstrs = append(erstrs, err.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
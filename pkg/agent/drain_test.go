@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestDrainPool tests draining and undraining a pool with a concurrency cap
+func TestDrainPool(t *testing.T) {
+	defer func(p time.Duration) { build.PollInterval = p }(build.PollInterval)
+	build.PollInterval = time.Millisecond * 5
+	var mu sync.Mutex
+	enabled := map[int]StatusInfo{1: {Status: true}, 2: {Status: true}, 3: {Status: false, Comment: Comment{Text: "broken disk"}}}
+	polls := make(map[int]int)
+	var active, peak int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/agents":
+			var as []Agent
+			for _, id := range []int{1, 2, 3} {
+				as = append(as, Agent{ID: id, Authorized: true, Enabled: enabled[id].Status, EnabledInfo: enabled[id]})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"agent": as})
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/httpAuth/app/rest/agents/id:"):
+			id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/httpAuth/app/rest/agents/id:"))
+			json.NewEncoder(w).Encode(Agent{ID: id, Authorized: true, Enabled: enabled[id].Status, EnabledInfo: enabled[id]})
+		case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/enabledInfo"):
+			id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/httpAuth/app/rest/agents/id:"), "/enabledInfo"))
+			var si StatusInfo
+			json.NewDecoder(r.Body).Decode(&si)
+			if !si.Status && enabled[id].Status {
+				active++
+				if active > peak {
+					peak = active
+				}
+			}
+			enabled[id] = si
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/builds":
+			l := r.URL.Query().Get("locator")
+			id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(l, "running:true,agent:(id:"), ")"))
+			polls[id]++
+			if polls[id] < 3 {
+				w.Write([]byte(`{"count":1,"build":[{"id":` + strconv.Itoa(100+id) + `,"buildTypeId":"bt1"}]}`))
+				return
+			}
+			active--
+			w.Write([]byte(`{"count":0}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	if err := c.DrainPool(1, time.Second*5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if peak != 1 {
+		t.Errorf("drained %d agents at once, want 1", peak)
+	}
+	if enabled[1].Status || enabled[2].Status || enabled[1].Comment.Text != DefaultDrainComment {
+		t.Errorf("agents not drained: %+v", enabled)
+	}
+	if err := c.UndrainPool(1); err != nil {
+		t.Fatal(err)
+	}
+	if !enabled[1].Status || !enabled[2].Status {
+		t.Errorf("agents not undrained: %+v", enabled)
+	}
+	if enabled[3].Status || enabled[3].Comment.Text != "broken disk" {
+		t.Errorf("drain changed an agent disabled for another reason: %+v", enabled[3])
+	}
+	if err := c.Undrain(3); err == nil || !strings.Contains(err.Error(), "broken disk") {
+		t.Errorf("expected error undraining an agent disabled for another reason, got %v", err)
+	}
+}
+
+// TestDrainTimeout tests that a timed out drain stops polling
+func TestDrainTimeout(t *testing.T) {
+	defer func(p time.Duration) { build.PollInterval = p }(build.PollInterval)
+	build.PollInterval = time.Millisecond * 5
+	var mu sync.Mutex
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/agents/id:1":
+			w.Write([]byte(`{"id":1,"enabled":false,"enabledInfo":{"status":false,"comment":{"text":"Drained for maintenance"}}}`))
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/builds":
+			polls++
+			w.Write([]byte(`{"count":1,"build":[{"id":101,"buildTypeId":"bt1","percentageComplete":40}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	var out bytes.Buffer
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), Progress: &out}
+	if err := c.Drain(1, time.Millisecond*30); err == nil || !strings.Contains(err.Error(), "Timeout reached draining agent 1") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	mu.Lock()
+	n := polls
+	mu.Unlock()
+	time.Sleep(time.Millisecond * 30)
+	mu.Lock()
+	defer mu.Unlock()
+	if polls != n {
+		t.Errorf("drain kept polling after the timeout: %d polls, then %d", n, polls)
+	}
+	if !strings.HasPrefix(out.String(), "Agent 1 running bt1 (101): 40%\n") {
+		t.Errorf("progress = %q", out.String())
+	}
+}
@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pool contains agent pool data
+type Pool struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	HREF      string        `json:"href"`
+	MaxAgents int           `json:"maxAgents,omitempty"`
+	Agents    *PoolAgents   `json:"agents,omitempty"`
+	Projects  *PoolProjects `json:"projects,omitempty"`
+}
+
+// PoolAgents contains the agents in a pool
+type PoolAgents struct {
+	Count int     `json:"count"`
+	Agent []Agent `json:"agent"`
+}
+
+// PoolProjects contains the projects associated with a pool
+type PoolProjects struct {
+	Count   int          `json:"count"`
+	Project []ProjectRef `json:"project"`
+}
+
+// ProjectRef references a project
+type ProjectRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// PoolSpec contains the desired membership of an agent pool
+type PoolSpec struct {
+	Name string `json:"name"`
+	// Agents are agent names, agents not named in any spec are left in their pool
+	Agents []string `json:"agents"`
+	// Projects are project IDs, projects not listed are removed from the pool
+	Projects []string `json:"projects"`
+}
+
+// Pool change actions reported by PlanPools
+const (
+	PoolCreate        = "createPool"
+	PoolMoveAgent     = "moveAgent"
+	PoolAddProject    = "addProject"
+	PoolRemoveProject = "removeProject"
+)
+
+// PoolChange contains a change required to reach a pool spec
+type PoolChange struct {
+	Action string `json:"action"`
+	Pool   string `json:"pool"`
+	// Target is the agent name or project ID the change applies to
+	Target string `json:"target,omitempty"`
+	// From is the current pool of a moved agent
+	From string `json:"from,omitempty"`
+}
+
+// String returns a human readable change line
+func (pc PoolChange) String() string {
+	switch pc.Action {
+	case PoolCreate:
+		return "create pool " + pc.Pool
+	case PoolMoveAgent:
+		return "move agent " + pc.Target + " from " + pc.From + " to " + pc.Pool
+	case PoolAddProject:
+		return "add project " + pc.Target + " to " + pc.Pool
+	case PoolRemoveProject:
+		return "remove project " + pc.Target + " from " + pc.Pool
+	}
+	return pc.Action + " " + pc.Pool + " " + pc.Target
+}
+
+// poolFields are the pool fields requested for pool data
+const poolFields = "id,name,href,maxAgents,agents(count,agent(id,name)),projects(count,project(id,name))"
+
+// Pools returns list of all agent pools with their agents and projects
+func (c *Config) Pools() ([]Pool, error) {
+	type pools struct {
+		Count     int    `json:"count"`
+		AgentPool []Pool `json:"agentPool"`
+	}
+	ps := &pools{}
+	u := "/httpAuth/app/rest/agentPools?fields=" + url.QueryEscape("count,agentPool("+poolFields+")")
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &ps)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return ps.AgentPool, nil
+}
+
+// GetPool gets pool data for pool ID p
+func (c *Config) GetPool(p int) (*Pool, error) {
+	pl := &Pool{}
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "?fields=" + url.QueryEscape(poolFields)
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &pl)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return pl, nil
+}
+
+// CreatePool creates an agent pool named n
+func (c *Config) CreatePool(n string) (*Pool, error) {
+	type newPool struct {
+		Name string `json:"name"`
+	}
+	jd, jerr := json.Marshal(newPool{Name: n})
+	if jerr != nil {
+		return nil, jerr
+	}
+	rd, err := c.Client.HTTPRequestWithType("POST", "/httpAuth/app/rest/agentPools", jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	pl := &Pool{}
+	jerr = json.Unmarshal(rd, &pl)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return pl, nil
+}
+
+// RenamePool renames pool p to n
+func (c *Config) RenamePool(p int, n string) error {
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "/name"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(n), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetPoolMaxAgents sets the maximum number of agents in pool p, -1 for unlimited
+func (c *Config) SetPoolMaxAgents(p int, m int) error {
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "/maxAgents"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(strconv.Itoa(m)), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeletePool deletes pool p, its agents move to the default pool
+func (c *Config) DeletePool(p int) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/agentPools/id:"+strconv.Itoa(p), nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MoveAgent moves agent i to pool p
+func (c *Config) MoveAgent(i int, p int) error {
+	type agentRef struct {
+		ID int `json:"id"`
+	}
+	jd, jerr := json.Marshal(agentRef{ID: i})
+	if jerr != nil {
+		return jerr
+	}
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "/agents"
+	_, err := c.Client.HTTPRequestWithType("POST", u, jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddPoolProject associates project pr with pool p
+func (c *Config) AddPoolProject(p int, pr string) error {
+	jd, jerr := json.Marshal(ProjectRef{ID: pr})
+	if jerr != nil {
+		return jerr
+	}
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "/projects"
+	_, err := c.Client.HTTPRequestWithType("POST", u, jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemovePoolProject removes the association of project pr with pool p
+func (c *Config) RemovePoolProject(p int, pr string) error {
+	u := "/httpAuth/app/rest/agentPools/id:" + strconv.Itoa(p) + "/projects/id:" + pr
+	_, err := c.Client.HTTPRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// PlanPools returns the changes required for the pools to match spec ps
+func (c *Config) PlanPools(ps []PoolSpec) ([]PoolChange, error) {
+	pls, err := c.Pools()
+	if err != nil {
+		return nil, err
+	}
+	return planPools(pls, ps), nil
+}
+
+// planPools compares the actual pools pls with spec ps
+func planPools(pls []Pool, ps []PoolSpec) []PoolChange {
+	byName := make(map[string]Pool)
+	agentPool := make(map[string]string)
+	for _, pl := range pls {
+		byName[pl.Name] = pl
+		if pl.Agents != nil {
+			for _, a := range pl.Agents.Agent {
+				agentPool[a.Name] = pl.Name
+			}
+		}
+	}
+	var pcs []PoolChange
+	for _, s := range ps {
+		pl, ok := byName[s.Name]
+		if !ok {
+			pcs = append(pcs, PoolChange{Action: PoolCreate, Pool: s.Name})
+		}
+		for _, a := range s.Agents {
+			if agentPool[a] != s.Name {
+				pcs = append(pcs, PoolChange{Action: PoolMoveAgent, Pool: s.Name, Target: a, From: agentPool[a]})
+			}
+		}
+		current := make(map[string]bool)
+		if pl.Projects != nil {
+			for _, pr := range pl.Projects.Project {
+				current[pr.ID] = true
+			}
+		}
+		desired := make(map[string]bool)
+		for _, pr := range s.Projects {
+			desired[pr] = true
+			if !current[pr] {
+				pcs = append(pcs, PoolChange{Action: PoolAddProject, Pool: s.Name, Target: pr})
+			}
+		}
+		var removed []string
+		for pr := range current {
+			if !desired[pr] {
+				removed = append(removed, pr)
+			}
+		}
+		sort.Strings(removed)
+		for _, pr := range removed {
+			pcs = append(pcs, PoolChange{Action: PoolRemoveProject, Pool: s.Name, Target: pr})
+		}
+	}
+	return pcs
+}
+
+// ApplyPools applies the changes required for the pools to match spec ps
+// and returns the changes made
+func (c *Config) ApplyPools(ps []PoolSpec) ([]PoolChange, error) {
+	pls, err := c.Pools()
+	if err != nil {
+		return nil, err
+	}
+	pcs := planPools(pls, ps)
+	poolID := make(map[string]int)
+	for _, pl := range pls {
+		poolID[pl.Name] = pl.ID
+	}
+	as, err := c.Agents()
+	if err != nil {
+		return nil, err
+	}
+	agentID := make(map[string]int)
+	for _, a := range as {
+		agentID[a.Name] = a.ID
+	}
+	var done []PoolChange
+	var erstrs []string
+	for _, pc := range pcs {
+		var cerr error
+		pid, pok := poolID[pc.Pool]
+		switch {
+		case pc.Action == PoolCreate:
+			pl, err := c.CreatePool(pc.Pool)
+			if err == nil {
+				poolID[pc.Pool] = pl.ID
+			}
+			cerr = err
+		case !pok:
+			cerr = errors.New("pool " + pc.Pool + " not found")
+		case pc.Action == PoolMoveAgent:
+			id, ok := agentID[pc.Target]
+			if !ok {
+				cerr = errors.New("agent " + pc.Target + " not found")
+				break
+			}
+			cerr = c.MoveAgent(id, pid)
+		case pc.Action == PoolAddProject:
+			cerr = c.AddPoolProject(pid, pc.Target)
+		case pc.Action == PoolRemoveProject:
+			cerr = c.RemovePoolProject(pid, pc.Target)
+		}
+		if cerr != nil {
+			erstrs = append(erstrs, pc.String()+": "+cerr.Error())
+			continue
+		}
+		done = append(done, pc)
+	}
+	if len(erstrs) > 0 {
+		return done, errors.New(strings.Join(erstrs, "; "))
+	}
+	return done, nil
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestApplyPools tests planning and applying a pool spec against a stub server
+func TestApplyPools(t *testing.T) {
+	var calls []string
+	gets := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/agentPools":
+			gets++
+			w.Write([]byte(`{"count":2,"agentPool":[
+				{"id":0,"name":"Default","agents":{"agent":[{"id":1,"name":"linux-1"},{"id":2,"name":"linux-2"}]}},
+				{"id":1,"name":"web","agents":{"agent":[{"id":3,"name":"linux-3"}]},"projects":{"project":[{"id":"Web"},{"id":"Legacy"}]}}]}`))
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/agents":
+			w.Write([]byte(`{"agent":[{"id":1,"name":"linux-1"},{"id":2,"name":"linux-2"},{"id":3,"name":"linux-3"}]}`))
+		case r.Method == "POST" && r.URL.Path == "/httpAuth/app/rest/agentPools":
+			bd, _ := ioutil.ReadAll(r.Body)
+			calls = append(calls, "create "+string(bd))
+			w.Write([]byte(`{"id":5,"name":"mobile"}`))
+		case r.Method == "GET":
+			http.NotFound(w, r)
+		default:
+			bd, _ := ioutil.ReadAll(r.Body)
+			calls = append(calls, r.Method+" "+r.URL.Path+" "+string(bd))
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	spec := []PoolSpec{
+		{Name: "web", Agents: []string{"linux-3", "linux-1"}, Projects: []string{"Web"}},
+		{Name: "mobile", Agents: []string{"linux-2"}, Projects: []string{"Mobile"}},
+	}
+	pcs, err := c.PlanPools(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"move agent linux-1 from Default to web",
+		"remove project Legacy from web",
+		"create pool mobile",
+		"move agent linux-2 from Default to mobile",
+		"add project Mobile to mobile",
+	}
+	if len(pcs) != len(want) {
+		t.Fatalf("plan = %v, want %v", pcs, want)
+	}
+	for i := range want {
+		if pcs[i].String() != want[i] {
+			t.Errorf("plan[%d] = %s, want %s", i, pcs[i], want[i])
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("plan made changes: %v", calls)
+	}
+	gets = 0
+	if _, err := c.ApplyPools(spec); err != nil {
+		t.Fatal(err)
+	}
+	if gets != 1 {
+		t.Errorf("apply fetched the pools %d times, want 1", gets)
+	}
+	wantCalls := []string{
+		`POST /httpAuth/app/rest/agentPools/id:1/agents {"id":1}`,
+		`DELETE /httpAuth/app/rest/agentPools/id:1/projects/id:Legacy `,
+		`create {"name":"mobile"}`,
+		`POST /httpAuth/app/rest/agentPools/id:5/agents {"id":2}`,
+		`POST /httpAuth/app/rest/agentPools/id:5/projects {"id":"Mobile"}`,
+	}
+	if len(calls) != len(wantCalls) {
+		t.Fatalf("calls = %v, want %v", calls, wantCalls)
+	}
+	for i := range wantCalls {
+		if calls[i] != wantCalls[i] {
+			t.Errorf("call[%d] = %s, want %s", i, calls[i], wantCalls[i])
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// maxLine is the longest record Read accepts
+const maxLine = 1024 * 1024
+
+// ErrNotReversible is returned by Reverse for records it cannot undo
+var ErrNotReversible = errors.New("audit record is not reversible")
+
+// Log is an append-only JSONL audit log file. Set it as the Audit of a teamcity.Client.
+type Log struct {
+	File string
+	mu   sync.Mutex
+}
+
+// Audit appends record r to the log file, creating it if needed
+func (l *Log) Audit(r teamcity.AuditRecord) error {
+	bd, jerr := json.Marshal(r)
+	if jerr != nil {
+		return jerr
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.New("audit log " + l.File + ": " + err.Error())
+	}
+	// one write per record, so concurrent processes appending to the
+	// same file do not interleave records
+	if _, werr := f.Write(append(bd, '\n')); werr != nil {
+		f.Close()
+		return errors.New("audit log " + l.File + ": " + werr.Error())
+	}
+	return f.Close()
+}
+
+// Filter selects audit records. Empty fields match everything.
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	// User is the TeamCity user
+	User   string
+	OSUser string
+	Method string
+	// Resource matches records whose resource contains it
+	Resource string
+	// Failed only matches records whose request failed
+	Failed bool
+}
+
+// Match checks if record r matches the filter. A nil filter matches every record.
+func (f *Filter) Match(r teamcity.AuditRecord) bool {
+	if f == nil {
+		return true
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.OSUser != "" && r.OSUser != f.OSUser {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(r.Method, f.Method) {
+		return false
+	}
+	if f.Resource != "" && !strings.Contains(r.Resource, f.Resource) {
+		return false
+	}
+	if f.Failed && r.Result == teamcity.AuditOK {
+		return false
+	}
+	return true
+}
+
+// Read returns the records in log file lf matching filter f, oldest first
+func Read(lf string, f *Filter) ([]teamcity.AuditRecord, error) {
+	fd, err := os.Open(lf)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var rs []teamcity.AuditRecord
+	sc := bufio.NewScanner(fd)
+	sc.Buffer(make([]byte, 64*1024), maxLine)
+	n := 0
+	for sc.Scan() {
+		n++
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		r := teamcity.AuditRecord{}
+		if jerr := json.Unmarshal(sc.Bytes(), &r); jerr != nil {
+			return nil, errors.New(lf + ":" + strconv.Itoa(n) + ": " + jerr.Error())
+		}
+		if f.Match(r) {
+			rs = append(rs, r)
+		}
+	}
+	if serr := sc.Err(); serr != nil {
+		return nil, serr
+	}
+	return rs, nil
+}
+
+// Action is a request that reverses an audited request
+type Action struct {
+	Method      string `json:"method"`
+	Resource    string `json:"resource"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// Description says what the action does
+	Description string `json:"description"`
+}
+
+// Config contains the client used to look up and apply reverse actions
+type Config struct {
+	Client *teamcity.Client
+}
+
+var (
+	// reToggle matches the trigger disabled and build type paused flags
+	reToggle = regexp.MustCompile(`^/httpAuth/app/rest/buildTypes/id:([^/?]+)/(triggers/([^/?]+)/disabled|paused)$`)
+	// reAgent matches the agent enabled and authorized status
+	reAgent = regexp.MustCompile(`^/httpAuth/app/rest/agents/id:([0-9]+)/(enabledInfo|authorizedInfo)$`)
+	// reCancel matches cancelling a queued or running build
+	reCancel = regexp.MustCompile(`^/httpAuth/app/rest/(buildQueue|builds)/id:([0-9]+)$`)
+)
+
+// Reverse returns the action that undoes record r. Trigger disable/enable,
+// build type pause/unpause and agent enable/authorize are flipped back using
+// the body kept in the record, or for older records without a body the
+// digest of a true or false body. A cancelled build is re-queued with the
+// same build type and branch, which is only possible while TeamCity still
+// has the cancelled build. Other records return ErrNotReversible.
+func (c *Config) Reverse(r teamcity.AuditRecord) (*Action, error) {
+	if r.Result != teamcity.AuditOK {
+		return nil, errors.New("audited request failed, there is nothing to reverse: " + r.Result)
+	}
+	u := r.Resource
+	if i := strings.Index(u, "?"); i >= 0 {
+		u = u[:i]
+	}
+	if m := reToggle.FindStringSubmatch(u); m != nil && r.Method == "PUT" {
+		v, ok := toggled(r)
+		if !ok {
+			return nil, ErrNotReversible
+		}
+		nv := strconv.FormatBool(!v)
+		d := "set paused of " + m[1] + " to " + nv
+		if m[3] != "" {
+			d = "set disabled of trigger " + m[3] + " on " + m[1] + " to " + nv
+		}
+		return &Action{Method: "PUT", Resource: u, ContentType: "text/plain", Body: nv, Description: d}, nil
+	}
+	if m := reAgent.FindStringSubmatch(u); m != nil && r.Method == "PUT" {
+		return agentStatus(m[1], m[2], r.Body)
+	}
+	if m := reCancel.FindStringSubmatch(u); m != nil && r.Method == "POST" {
+		return c.requeue(m[2])
+	}
+	return nil, ErrNotReversible
+}
+
+// toggled returns the boolean value the request of record r set
+func toggled(r teamcity.AuditRecord) (bool, bool) {
+	if r.Body != "" {
+		v, err := strconv.ParseBool(r.Body)
+		return v, err == nil
+	}
+	switch r.Digest {
+	case teamcity.Digest([]byte("true")):
+		return true, true
+	case teamcity.Digest([]byte("false")):
+		return false, true
+	}
+	return false, false
+}
+
+// agentStatus returns the action that flips back the enabledInfo or
+// authorizedInfo status of agent id set by request body b
+func agentStatus(id string, info string, b string) (*Action, error) {
+	type statusInfo struct {
+		Status *bool `json:"status"`
+	}
+	si := statusInfo{}
+	if b == "" || json.Unmarshal([]byte(b), &si) != nil || si.Status == nil {
+		return nil, ErrNotReversible
+	}
+	nv := !*si.Status
+	jd, jerr := json.Marshal(statusInfo{Status: &nv})
+	if jerr != nil {
+		return nil, jerr
+	}
+	d := "set enabled of agent " + id + " to " + strconv.FormatBool(nv)
+	if info == "authorizedInfo" {
+		d = "set authorized of agent " + id + " to " + strconv.FormatBool(nv)
+	}
+	return &Action{
+		Method:      "PUT",
+		Resource:    "/httpAuth/app/rest/agents/id:" + id + "/" + info,
+		ContentType: "application/json",
+		Body:        string(jd),
+		Description: d,
+	}, nil
+}
+
+// requeue returns the action that queues a new build like cancelled build id
+func (c *Config) requeue(id string) (*Action, error) {
+	bs, err := (&build.Config{Client: c.Client}).BuildsFiltered("id:" + id)
+	if err != nil && !teamcity.IsNotFound(err) {
+		return nil, err
+	}
+	if len(bs) == 0 {
+		return nil, errors.New("build " + id + " no longer exists, it cannot be re-queued")
+	}
+	type buildType struct {
+		ID string `json:"id"`
+	}
+	type triggerRequest struct {
+		BuildType  buildType `json:"buildType"`
+		BranchName string    `json:"branchName,omitempty"`
+	}
+	jd, jerr := json.Marshal(triggerRequest{BuildType: buildType{ID: bs[0].BuildTypeID}, BranchName: bs[0].BranchName})
+	if jerr != nil {
+		return nil, jerr
+	}
+	d := "queue a new build of " + bs[0].BuildTypeID
+	if bs[0].BranchName != "" {
+		d += " on " + bs[0].BranchName
+	}
+	return &Action{
+		Method:      "POST",
+		Resource:    "/httpAuth/app/rest/buildQueue",
+		ContentType: "application/json",
+		Body:        string(jd),
+		Description: d + " to replace cancelled build " + id,
+	}, nil
+}
+
+// Apply sends action a to TeamCity
+func (c *Config) Apply(a *Action) error {
+	_, err := c.Client.HTTPRequestWithType(a.Method, a.Resource, []byte(a.Body), a.ContentType, a.ContentType)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/agent"
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/teamcitytest"
+)
+
+// TestLogReadReverse tests logging mutations, filtering the log and undoing them
+func TestLogReadReverse(t *testing.T) {
+	s := teamcitytest.NewServer(teamcitytest.State{
+		Projects: []teamcitytest.Project{{ID: "Payments", Name: "Payments"}},
+		BuildTypes: []teamcitytest.BuildType{{ID: "Payments_Build", Name: "Build", ProjectID: "Payments",
+			Triggers: []teamcitytest.Trigger{{ID: "vcs", Type: "vcsTrigger"}}}},
+		Builds: []teamcitytest.Build{
+			{ID: 1, BuildTypeID: "Payments_Build", BranchName: "main"},
+			{ID: 2, BuildTypeID: "Payments_Build"},
+		},
+	})
+	defer s.Close()
+	d, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	lf := filepath.Join(d, "audit.jsonl")
+	c := s.Client()
+	c.Audit = &Log{File: lf}
+	bc := &build.Config{Client: c}
+	qc := &queue.Config{Client: c}
+
+	if err := bc.DisableBuildTrigger("Payments_Build", "vcs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.PauseType("Payments_Build"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qc.CancelBuild(1, "cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qc.CancelAndDeleteBuild(2, "cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.GetType("Missing"); err == nil {
+		t.Fatal("expected error for missing build type")
+	}
+	if err := bc.SetTypePaused("Missing", true); err == nil {
+		t.Fatal("expected error for missing build type")
+	}
+
+	all, err := Read(lf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 6 || all[0].User != "teamcitytest" || all[0].Time.IsZero() {
+		t.Fatalf("read %d records: %+v", len(all), all)
+	}
+	cs, err := Read(lf, &Filter{Method: "post", Since: all[0].Time, Until: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 2 || !strings.HasSuffix(cs[0].Resource, "/buildQueue/id:1") {
+		t.Errorf("cancel records = %+v", cs)
+	}
+	fs, err := Read(lf, &Filter{Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 1 || fs[0].Status != 404 {
+		t.Errorf("failed records = %+v", fs)
+	}
+
+	ac := &Config{Client: s.Client()}
+	for _, r := range all[:3] {
+		a, err := ac.Reverse(r)
+		if err != nil {
+			t.Fatalf("reverse %s %s: %v", r.Method, r.Resource, err)
+		}
+		if err := ac.Apply(a); err != nil {
+			t.Fatalf("apply %s: %v", a.Description, err)
+		}
+	}
+	st := s.State()
+	if bt := st.BuildTypes[0]; bt.Paused || bt.Triggers[0].Disabled {
+		t.Errorf("build type not restored: %+v", bt)
+	}
+	var nb *teamcitytest.Build
+	for i, b := range st.Builds {
+		if b.ID != 1 && b.State == teamcitytest.StateQueued {
+			nb = &st.Builds[i]
+		}
+	}
+	if nb == nil || nb.BuildTypeID != "Payments_Build" || nb.BranchName != "main" {
+		t.Errorf("cancelled build not re-queued: %+v", st.Builds)
+	}
+	if _, err := ac.Reverse(all[3]); err == nil || !strings.Contains(err.Error(), "no longer exists") {
+		t.Errorf("expected error re-queueing deleted build, got %v", err)
+	}
+	if _, err := ac.Reverse(all[4]); err != ErrNotReversible {
+		t.Errorf("expected ErrNotReversible for delete, got %v", err)
+	}
+	if _, err := ac.Reverse(all[5]); err == nil {
+		t.Error("expected error reversing failed request")
+	}
+}
+
+// TestReverseAgentStatus tests undoing agent disable and unauthorize records
+func TestReverseAgentStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	d, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	lf := filepath.Join(d, "audit.jsonl")
+	c := teamcity.New(ts.URL, "", "")
+	c.Audit = &Log{File: lf}
+	agc := &agent.Config{Client: c}
+	if err := agc.SetEnabled(3, false, "draining", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := agc.SetAuthorized(4, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := Read(lf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 {
+		t.Fatalf("read %d records: %+v", len(rs), rs)
+	}
+	ac := &Config{Client: c}
+	want := []Action{
+		{Method: "PUT", Resource: "/httpAuth/app/rest/agents/id:3/enabledInfo", ContentType: "application/json",
+			Body: `{"status":true}`, Description: "set enabled of agent 3 to true"},
+		{Method: "PUT", Resource: "/httpAuth/app/rest/agents/id:4/authorizedInfo", ContentType: "application/json",
+			Body: `{"status":true}`, Description: "set authorized of agent 4 to true"},
+	}
+	for i, r := range rs {
+		a, err := ac.Reverse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *a != want[i] {
+			t.Errorf("reverse of %s = %+v, want %+v", r.Resource, a, want[i])
+		}
+	}
+	rs[0].Body = ""
+	if _, err := ac.Reverse(rs[0]); err != ErrNotReversible {
+		t.Errorf("expected ErrNotReversible without a body, got %v", err)
+	}
+}
@@ -2,8 +2,9 @@ package build
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -14,18 +15,58 @@ import (
 // Config contains config data
 type Config struct {
 	Client *teamcity.Client
+	// Progress receives the running builds on each poll of WaitForRunningBuilds,
+	// os.Stdout if nil. Set it to ioutil.Discard for no output.
+	Progress io.Writer
 }
 
+// TimeFormat is the layout TeamCity uses for dates
+const TimeFormat = "20060102T150405-0700"
+
 // Build contains build data
 type Build struct {
-	ID                 int    `json:"id"`
-	BuildTypeID        string `json:"buildTypeId"`
-	Number             string `json:"number"`
-	Status             string `json:"status"`
-	State              string `json:"string"`
-	PercentageComplete int    `json:"percentageComplete"`
-	HREF               string `json:"href"`
-	WebURL             string `json:"webUrl"`
+	ID                 int       `json:"id"`
+	BuildTypeID        string    `json:"buildTypeId"`
+	Number             string    `json:"number"`
+	Status             string    `json:"status"`
+	StatusText         string    `json:"statusText,omitempty"`
+	State              string    `json:"state"`
+	BranchName         string    `json:"branchName"`
+	PercentageComplete int       `json:"percentageComplete"`
+	QueuedDate         string    `json:"queuedDate"`
+	StartDate          string    `json:"startDate,omitempty"`
+	FinishDate         string    `json:"finishDate,omitempty"`
+	HREF               string    `json:"href"`
+	WebURL             string    `json:"webUrl"`
+	Triggered          Triggered `json:"triggered"`
+	// CanceledInfo is set on builds that were cancelled
+	CanceledInfo *CanceledInfo `json:"canceledInfo,omitempty"`
+}
+
+// CanceledInfo contains build cancellation data
+type CanceledInfo struct {
+	Text      string `json:"text"`
+	Timestamp string `json:"timestamp"`
+	User      *User  `json:"user,omitempty"`
+}
+
+// Triggered contains build trigger cause data
+type Triggered struct {
+	Type string `json:"type"`
+	Date string `json:"date"`
+	User User   `json:"user"`
+}
+
+// User contains user data
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// ParseTime parses a TeamCity date
+func ParseTime(s string) (time.Time, error) {
+	return time.Parse(TimeFormat, s)
 }
 
 // Type contains buildType data
@@ -64,7 +105,7 @@ type ProjectList struct {
 type Parameters struct {
 	Count               int                `json:"count"`
 	HREF                string             `json:"href"`
-	ParameterProperties []ParameterPropery `json:"propery"`
+	ParameterProperties []ParameterPropery `json:"property"`
 }
 
 // ParameterPropery contains project parameter propery data
@@ -72,6 +113,18 @@ type ParameterPropery struct {
 	Name      string `json:"name"`
 	Value     string `json:"value"`
 	Inherited bool   `json:"inherited"`
+	// Type is the parameter specification, nil for plain text parameters
+	Type *ParameterType `json:"type,omitempty"`
+}
+
+// ParameterType contains parameter specification data
+type ParameterType struct {
+	RawValue string `json:"rawValue"`
+}
+
+// Password returns true if the parameter is a password, whose value the server never returns
+func (p ParameterPropery) Password() bool {
+	return p.Type != nil && strings.HasPrefix(p.Type.RawValue, "password")
 }
 
 var typeCache []*Type
@@ -135,49 +188,30 @@ func RunningBuildsPercentages(rbs []Build, p string) string {
 // WaitForRunningBuilds waits for all running builds to complete with timeout t
 // if Project/Parent Project ID p provided, only wait for these builds
 func (c *Config) WaitForRunningBuilds(p string, t time.Duration) error {
-	var rbs []Build
-	var e error
-	rbs, e = c.RunningBuilds()
-	if e != nil {
-		return e
-	}
-	if len(rbs) == 0 {
-		return nil
-	}
-	w := make(chan error, 1)
-	go func() {
-		for len(rbs) > 0 {
-			fmt.Print(RunningBuildsPercentages(rbs, p))
-			rbs, e = c.RunningBuilds()
-			if e != nil {
-				w <- e
-				return
+	return WaitUntil(func() (bool, error) {
+		rbs, err := c.RunningBuilds()
+		if err != nil {
+			return false, err
+		}
+		if len(rbs) == 0 {
+			return true, nil
+		}
+		if p != "" {
+			cp, cerr := c.BuildsContainsProject(rbs, p)
+			if cerr != nil {
+				return false, cerr
 			}
-			if p != "" {
-				cp, cerr := c.BuildsContainsProject(rbs, p)
-				if cerr != nil {
-					w <- e
-					return
-				}
-				if !cp {
-					w <- nil
-					return
-				}
+			if !cp {
+				return true, nil
 			}
-			time.Sleep(time.Second * 10)
 		}
-		w <- nil
-	}()
-	if t > 0 {
-		select {
-		case <-time.After(t):
-			return errors.New("Timeout reached")
-		case we := <-w:
-			return we
+		w := c.Progress
+		if w == nil {
+			w = os.Stdout
 		}
-	} else {
-		return <-w
-	}
+		fmt.Fprint(w, RunningBuildsPercentages(rbs, p))
+		return false, nil
+	}, t)
 }
 
 // Types returns list of all running builds
@@ -212,7 +246,8 @@ func (c *Config) GetProject(p string) (*Project, error) {
 	return pr, nil
 }
 
-// TypesForProject returns all buildTypes for project p
+// TypesForProject returns the buildTypes of the direct subprojects of project p.
+// Use TypesForProjectTree for every buildType in p and its subprojects.
 func (c *Config) TypesForProject(p string) ([]Type, error) {
 	ts, err := c.Types()
 	if err != nil {
@@ -270,3 +305,18 @@ func (c *Config) ParentProjectID(id string) (string, error) {
 	}
 	return t.Project.ParentProjectID, nil
 }
+
+// SetTypePaused sets the paused status for buildType id
+func (c *Config) SetTypePaused(id string, p bool) error {
+	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/paused"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(strconv.FormatBool(p)), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	for _, tc := range typeCache {
+		if tc.ID == id {
+			tc.Paused = p
+		}
+	}
+	return nil
+}
@@ -2,37 +2,76 @@ package build
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/robertlestak/go-teamcity/pkg/cassette"
 	"github.com/robertlestak/go-teamcity/pkg/teamcity"
 )
 
+// testClient returns a client replaying cassette testdata/n.json, or recording
+// it from TEAMCITY_HOST when TEAMCITY_RECORD is set. The buildType cache is
+// cleared so each test makes its own requests.
+func testClient(t *testing.T, n string) (*teamcity.Client, *cassette.Cassette) {
+	typeCache = nil
+	cs, err := cassette.Open(filepath.Join("testdata", n+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := teamcity.New(cs.Host(os.Getenv("TEAMCITY_HOST")), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc.Transport = cs
+	return tc, cs
+}
+
+// replaying checks if cassette cs replays the committed recording, whose
+// values the tests check; a fresh recording has whatever the server returns
+func replaying(cs *cassette.Cassette) bool {
+	return cs.Mode() == cassette.ModeReplay
+}
+
+// saveCassette saves cassette cs if it was recorded
+func saveCassette(t *testing.T, cs *cassette.Cassette) {
+	if err := cs.Save(); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestRunningBuilds tests the response for RunningBuilds
 func TestRunningBuilds(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "running_builds")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	bs, err := c.RunningBuilds()
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Running Builds: %+v", bs)
+	if replaying(cs) && (len(bs) != 1 || bs[0].ID != 4211 || bs[0].BuildTypeID != "Payments_Build" ||
+		bs[0].BranchName != "main" || bs[0].PercentageComplete != 62) {
+		t.Errorf("unexpected running builds %+v", bs)
+	}
 }
 
 // TestTypes tests the response for Types
 func TestTypes(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "types")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	ts, err := c.Types()
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Number of Types: %+v", len(ts))
+	if replaying(cs) && (len(ts) != 2 || ts[0].ID != "Payments_Build" || ts[1].ProjectID != "Payments_Api") {
+		t.Errorf("unexpected types %+v", ts)
+	}
 }
 
 // TestWaitForRunningBuilds tests the response for WaitForRunningBuilds
 /*
 func TestWaitForRunningBuilds(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "wait_for_running_builds")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	t.Log("Wait for all builds")
 	err := c.WaitForRunningBuilds("", time.Second*20)
@@ -49,22 +88,30 @@ func TestWaitForRunningBuilds(t *testing.T) {
 
 // TestProjectID tests the response for ProjectID
 func TestProjectID(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "project_id")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
-	id, err := c.ProjectID(os.Getenv("BUILD_ID"))
+	id, err := c.ProjectID(cs.Var("BUILD_ID", os.Getenv("BUILD_ID")))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Project ID: %s", id)
+	if replaying(cs) && id != "Payments" {
+		t.Errorf("project ID = %s, want Payments", id)
+	}
 }
 
 // TestParentProjectID tests the response for ParentProjectID
 func TestParentProjectID(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "parent_project_id")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
-	id, err := c.ParentProjectID(os.Getenv("BUILD_ID"))
+	id, err := c.ParentProjectID(cs.Var("BUILD_ID", os.Getenv("BUILD_ID")))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Parent Project ID: %s", id)
+	if replaying(cs) && id != "_Root" {
+		t.Errorf("parent project ID = %s, want _Root", id)
+	}
 }
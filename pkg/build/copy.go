@@ -0,0 +1,162 @@
+package build
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+)
+
+// locatorRef references an entity by locator
+type locatorRef struct {
+	Locator string `json:"locator"`
+}
+
+// CopyBuildType copies buildType src into project p with new ID id and name n.
+// If all is set, the VCS roots and other settings the buildType uses are copied too.
+func (c *Config) CopyBuildType(src string, p string, id string, n string, all bool) (*Type, error) {
+	type newBuildTypeDescription struct {
+		ID                        string `json:"id"`
+		Name                      string `json:"name"`
+		SourceBuildTypeLocator    string `json:"sourceBuildTypeLocator"`
+		CopyAllAssociatedSettings bool   `json:"copyAllAssociatedSettings"`
+	}
+	d := newBuildTypeDescription{
+		ID:                        id,
+		Name:                      n,
+		SourceBuildTypeLocator:    "id:" + src,
+		CopyAllAssociatedSettings: all,
+	}
+	t := &Type{}
+	err := c.sendJSON("POST", "/httpAuth/app/rest/projects/id:"+p+"/buildTypes", d, t)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CopyProject copies project src into parent project p with new ID id and name n.
+// If all is set, the VCS roots and other settings the project uses are copied too.
+func (c *Config) CopyProject(src string, p string, id string, n string, all bool) (*Project, error) {
+	type newProjectDescription struct {
+		ID                        string     `json:"id"`
+		Name                      string     `json:"name"`
+		ParentProject             locatorRef `json:"parentProject"`
+		SourceProject             locatorRef `json:"sourceProject"`
+		CopyAllAssociatedSettings bool       `json:"copyAllAssociatedSettings"`
+	}
+	d := newProjectDescription{
+		ID:                        id,
+		Name:                      n,
+		ParentProject:             locatorRef{Locator: "id:" + p},
+		SourceProject:             locatorRef{Locator: "id:" + src},
+		CopyAllAssociatedSettings: all,
+	}
+	pr := &Project{}
+	err := c.sendJSON("POST", "/httpAuth/app/rest/projects", d, pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// CreateType creates an empty buildType in project p with ID id and name n
+func (c *Config) CreateType(p string, id string, n string) (*Type, error) {
+	t := &Type{}
+	err := c.sendJSON("POST", "/httpAuth/app/rest/projects/id:"+p+"/buildTypes", TypeRef{ID: id, Name: n}, t)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteType deletes buildType id
+func (c *Config) DeleteType(id string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/buildTypes/id:"+id, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetTypeParameter sets parameter n on buildType id to v
+func (c *Config) SetTypeParameter(id string, n string, v string) error {
+	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/parameters/" + url.PathEscape(n)
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(v), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Templates returns list of all buildType templates
+func (c *Config) Templates() ([]Type, error) {
+	type templates struct {
+		Count int    `json:"count"`
+		Type  []Type `json:"buildType"`
+	}
+	ts := &templates{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes?locator="+url.QueryEscape("templateFlag:true"), nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &ts)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return ts.Type, nil
+}
+
+// TypeTemplates returns the templates attached to buildType id
+func (c *Config) TypeTemplates(id string) ([]Type, error) {
+	type templates struct {
+		Count int    `json:"count"`
+		Type  []Type `json:"buildType"`
+	}
+	ts := &templates{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes/id:"+id+"/templates", nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &ts)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return ts.Type, nil
+}
+
+// AttachTemplate attaches template t to buildType id
+func (c *Config) AttachTemplate(id string, t string) error {
+	return c.sendJSON("POST", "/httpAuth/app/rest/buildTypes/id:"+id+"/templates", TypeRef{ID: t}, nil)
+}
+
+// DetachTemplate detaches template t from buildType id
+func (c *Config) DetachTemplate(id string, t string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/buildTypes/id:"+id+"/templates/id:"+t, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateTypeFromTemplate creates buildType id named n in project p based on
+// template t, overriding the template parameters in ps
+func (c *Config) CreateTypeFromTemplate(p string, id string, n string, t string, ps map[string]string) (*Type, error) {
+	bt, err := c.CreateType(p, id, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AttachTemplate(bt.ID, t); err != nil {
+		return bt, err
+	}
+	var names []string
+	for pn := range ps {
+		names = append(names, pn)
+	}
+	sort.Strings(names)
+	for _, pn := range names {
+		if err := c.SetTypeParameter(bt.ID, pn, ps[pn]); err != nil {
+			return bt, err
+		}
+	}
+	return bt, nil
+}
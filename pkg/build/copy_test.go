@@ -0,0 +1,68 @@
+package build
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestCopyBuildType tests the copy request sent by CopyBuildType
+func TestCopyBuildType(t *testing.T) {
+	var req map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/httpAuth/app/rest/projects/id:Payments/buildTypes" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"id":"Payments_Build","name":"Build","projectId":"Payments"}`))
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	bt, err := c.CopyBuildType("Orders_Build", "Payments", "Payments_Build", "Build", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bt.ID != "Payments_Build" || bt.ProjectID != "Payments" {
+		t.Errorf("unexpected buildType: %+v", bt)
+	}
+	if req["sourceBuildTypeLocator"] != "id:Orders_Build" || req["copyAllAssociatedSettings"] != true || req["id"] != "Payments_Build" {
+		t.Errorf("unexpected copy request: %v", req)
+	}
+}
+
+// TestCreateTypeFromTemplate tests the requests sent by CreateTypeFromTemplate
+func TestCreateTypeFromTemplate(t *testing.T) {
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bd, _ := ioutil.ReadAll(r.Body)
+		calls = append(calls, r.Method+" "+r.URL.Path+" "+string(bd))
+		if r.URL.Path == "/httpAuth/app/rest/projects/id:Payments/buildTypes" {
+			w.Write([]byte(`{"id":"Payments_Deploy","name":"Deploy","projectId":"Payments"}`))
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	ps := map[string]string{"env.SERVICE": "payments", "env.PORT": "8080"}
+	if _, err := c.CreateTypeFromTemplate("Payments", "Payments_Deploy", "Deploy", "Microservice_Deploy", ps); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`POST /httpAuth/app/rest/projects/id:Payments/buildTypes {"id":"Payments_Deploy","name":"Deploy"}`,
+		`POST /httpAuth/app/rest/buildTypes/id:Payments_Deploy/templates {"id":"Microservice_Deploy"}`,
+		`PUT /httpAuth/app/rest/buildTypes/id:Payments_Deploy/parameters/env.PORT 8080`,
+		`PUT /httpAuth/app/rest/buildTypes/id:Payments_Deploy/parameters/env.SERVICE payments`,
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call[%d] = %s, want %s", i, calls[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package build
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// buildFields are the build fields requested for build lists
+const buildFields = "count,build(id,buildTypeId,number,status,statusText,state,branchName,percentageComplete," +
+	"queuedDate,startDate,finishDate,href,webUrl,triggered(type,date,user(id,username,name))," +
+	"canceledInfo(text,timestamp,user(id,username,name)))"
+
+// BuildsFiltered returns the builds matching locator l, newest first
+func (c *Config) BuildsFiltered(l string) ([]Build, error) {
+	type builds struct {
+		Count int     `json:"count"`
+		Build []Build `json:"build"`
+	}
+	bs := &builds{}
+	u := "/httpAuth/app/rest/builds?locator=" + url.QueryEscape(l) + "&fields=" + url.QueryEscape(buildFields)
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &bs)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return bs.Build, nil
+}
+
+// FinishedBuildsSince returns up to n builds that finished after time t, newest first.
+// Cancelled and personal builds are included.
+func (c *Config) FinishedBuildsSince(t time.Time, n int) ([]Build, error) {
+	l := "defaultFilter:false,state:finished,count:" + strconv.Itoa(n) +
+		",finishDate:(date:" + t.Format(TimeFormat) + ",condition:after)"
+	return c.BuildsFiltered(l)
+}
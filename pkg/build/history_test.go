@@ -0,0 +1,32 @@
+package build
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestFinishedBuildsSince tests the locator sent by FinishedBuildsSince
+func TestFinishedBuildsSince(t *testing.T) {
+	var l string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l = r.URL.Query().Get("locator")
+		w.Write([]byte(`{"count":1,"build":[{"id":7,"status":"FAILURE","startDate":"20240101T120000+0000","finishDate":"20240101T121000+0000"}]}`))
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	bs, err := c.FinishedBuildsSince(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "defaultFilter:false,state:finished,count:50,finishDate:(date:20240101T110000+0000,condition:after)"
+	if l != want {
+		t.Errorf("locator = %s, want %s", l, want)
+	}
+	if len(bs) != 1 || bs[0].FinishDate != "20240101T121000+0000" {
+		t.Errorf("unexpected builds: %+v", bs)
+	}
+}
@@ -0,0 +1,182 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// PausedState contains the paused state of a buildType
+type PausedState struct {
+	ID     string `json:"id"`
+	Paused bool   `json:"paused"`
+}
+
+// PauseType pauses buildType id
+func (c *Config) PauseType(id string) error {
+	return c.SetTypePaused(id, true)
+}
+
+// ResumeType resumes buildType id
+func (c *Config) ResumeType(id string) error {
+	return c.SetTypePaused(id, false)
+}
+
+// Projects returns list of all projects
+func (c *Config) Projects() ([]Project, error) {
+	type projects struct {
+		Count   int       `json:"count"`
+		Project []Project `json:"project"`
+	}
+	pr := &projects{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/projects", nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &pr)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return pr.Project, nil
+}
+
+// ProjectTree returns the IDs of project p and all of its descendant projects
+func (c *Config) ProjectTree(p string) ([]string, error) {
+	ps, err := c.Projects()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[string][]string)
+	for _, pd := range ps {
+		children[pd.ParentProjectID] = append(children[pd.ParentProjectID], pd.ID)
+	}
+	ids := []string{p}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// TypesForProjectTree returns all buildTypes in project p and its descendant projects
+func (c *Config) TypesForProjectTree(p string) ([]Type, error) {
+	pids, err := c.ProjectTree(p)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := c.Types()
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]bool)
+	for _, id := range pids {
+		tree[id] = true
+	}
+	var nts []Type
+	for _, t := range ts {
+		if tree[t.ProjectID] {
+			nts = append(nts, t)
+		}
+	}
+	return nts, nil
+}
+
+// PausedStates returns the paused state of buildTypes ts
+func PausedStates(ts []Type) []PausedState {
+	var ps []PausedState
+	for _, t := range ts {
+		ps = append(ps, PausedState{ID: t.ID, Paused: t.Paused})
+	}
+	return ps
+}
+
+// SavePausedState saves the paused state to file f
+func (c *Config) SavePausedState(ps []PausedState, f string) error {
+	of, ferr := os.Create(f)
+	if ferr != nil {
+		return ferr
+	}
+	defer of.Close()
+	jd, jerr := json.Marshal(ps)
+	if jerr != nil {
+		return jerr
+	}
+	_, werr := of.Write(jd)
+	if werr != nil {
+		return werr
+	}
+	return nil
+}
+
+// ParsePausedState parses a paused state array from a file
+func ParsePausedState(f string) ([]PausedState, error) {
+	var ps []PausedState
+	bd, rerr := ioutil.ReadFile(f)
+	if rerr != nil {
+		return nil, rerr
+	}
+	jerr := json.Unmarshal(bd, &ps)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return ps, nil
+}
+
+// setProjectPaused saves the paused state of the project p tree to file f
+// and then sets all of its buildTypes to paused p
+func (c *Config) setProjectPaused(p string, f string, pd bool) error {
+	ts, err := c.TypesForProjectTree(p)
+	if err != nil {
+		return err
+	}
+	serr := c.SavePausedState(PausedStates(ts), f)
+	if serr != nil {
+		return serr
+	}
+	var erstrs []string
+	for _, t := range ts {
+		if t.Paused == pd {
+			continue
+		}
+		derr := c.SetTypePaused(t.ID, pd)
+		if derr != nil {
+			erstrs = append(erstrs, derr.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
+
+// SaveProjectPausedStateAndPauseAll saves the paused state of the project p tree
+// to file f and pauses all of its buildTypes
+func (c *Config) SaveProjectPausedStateAndPauseAll(p string, f string) error {
+	return c.setProjectPaused(p, f, true)
+}
+
+// SaveProjectPausedStateAndResumeAll saves the paused state of the project p tree
+// to file f and resumes all of its buildTypes
+func (c *Config) SaveProjectPausedStateAndResumeAll(p string, f string) error {
+	return c.setProjectPaused(p, f, false)
+}
+
+// PausedStateFromFile sets the paused state of every buildType in file f
+func (c *Config) PausedStateFromFile(f string) error {
+	ps, err := ParsePausedState(f)
+	if err != nil {
+		return err
+	}
+	var erstrs []string
+	for _, p := range ps {
+		derr := c.SetTypePaused(p.ID, p.Paused)
+		if derr != nil {
+			erstrs = append(erstrs, derr.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package build
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestProjectPausedState tests pausing a project tree and restoring it from file
+func TestProjectPausedState(t *testing.T) {
+	paused := map[string]bool{"child_b": true}
+	types := []Type{
+		{ID: "root_a", ProjectID: "Root"},
+		{ID: "child_b", ProjectID: "Child"},
+		{ID: "grandchild_c", ProjectID: "Grandchild"},
+		{ID: "other_d", ProjectID: "Other"},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/httpAuth/app/rest")
+		switch {
+		case p == "/projects":
+			w.Write([]byte(`{"project":[{"id":"_Root"},{"id":"Root","parentProjectId":"_Root"},
+				{"id":"Child","parentProjectId":"Root"},{"id":"Grandchild","parentProjectId":"Child"},
+				{"id":"Other","parentProjectId":"_Root"}]}`))
+		case p == "/buildTypes":
+			var bts []Type
+			for _, t := range types {
+				t.Paused = paused[t.ID]
+				bts = append(bts, t)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"buildType": bts})
+		case r.Method == "PUT" && strings.HasSuffix(p, "/paused"):
+			bd, _ := ioutil.ReadAll(r.Body)
+			paused[strings.TrimSuffix(strings.TrimPrefix(p, "/buildTypes/id:"), "/paused")] = string(bd) == "true"
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	f := "/tmp/go-teamcity-test-paused-state.json"
+	os.Remove(f)
+	defer os.Remove(f)
+	if err := c.SaveProjectPausedStateAndPauseAll("Root", f); err != nil {
+		t.Fatal(err)
+	}
+	if !paused["root_a"] || !paused["child_b"] || !paused["grandchild_c"] || paused["other_d"] {
+		t.Errorf("project tree not paused: %v", paused)
+	}
+	ps, err := ParsePausedState(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 {
+		t.Errorf("saved %d paused states, want 3", len(ps))
+	}
+	if err := c.PausedStateFromFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if paused["root_a"] || !paused["child_b"] || paused["grandchild_c"] {
+		t.Errorf("paused state not restored: %v", paused)
+	}
+}
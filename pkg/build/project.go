@@ -0,0 +1,144 @@
+package build
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// CreateProject creates project id named n in parent project p
+func (c *Config) CreateProject(p string, id string, n string) (*Project, error) {
+	type newProjectDescription struct {
+		ID            string     `json:"id"`
+		Name          string     `json:"name"`
+		ParentProject locatorRef `json:"parentProject"`
+	}
+	d := newProjectDescription{ID: id, Name: n, ParentProject: locatorRef{Locator: "id:" + p}}
+	pr := &Project{}
+	err := c.sendJSON("POST", "/httpAuth/app/rest/projects", d, pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// DeleteProject deletes project p
+func (c *Config) DeleteProject(p string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/projects/id:"+p, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetProjectField sets field f, such as name or description, on project p to v
+func (c *Config) SetProjectField(p string, f string, v string) error {
+	u := "/httpAuth/app/rest/projects/id:" + p + "/" + f
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(v), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetProjectParameter sets parameter n on project p to v
+func (c *Config) SetProjectParameter(p string, n string, v string) error {
+	u := "/httpAuth/app/rest/projects/id:" + p + "/parameters/" + url.PathEscape(n)
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(v), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteProjectParameter deletes parameter n from project p
+func (c *Config) DeleteProjectParameter(p string, n string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/projects/id:"+p+"/parameters/"+url.PathEscape(n), nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetTypeField sets field f, such as name or description, on buildType id to v
+func (c *Config) SetTypeField(id string, f string, v string) error {
+	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/" + f
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(v), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// TypeParameters returns the parameters of buildType id
+func (c *Config) TypeParameters(id string) ([]ParameterPropery, error) {
+	ps := &Parameters{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes/id:"+id+"/parameters", nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &ps)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return ps.ParameterProperties, nil
+}
+
+// DeleteTypeParameter deletes parameter n from buildType id
+func (c *Config) DeleteTypeParameter(id string, n string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/buildTypes/id:"+id+"/parameters/"+url.PathEscape(n), nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// VCSRootEntry contains a VCS root attached to a buildType
+type VCSRootEntry struct {
+	ID            string  `json:"id"`
+	VCSRoot       TypeRef `json:"vcs-root"`
+	CheckoutRules string  `json:"checkout-rules"`
+	Inherited     bool    `json:"inherited,omitempty"`
+}
+
+// VCSRootEntries returns the VCS roots attached to buildType id
+func (c *Config) VCSRootEntries(id string) ([]VCSRootEntry, error) {
+	type vcsRootEntries struct {
+		Count int            `json:"count"`
+		Entry []VCSRootEntry `json:"vcs-root-entry"`
+	}
+	es := &vcsRootEntries{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes/id:"+id+"/vcs-root-entries", nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &es)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return es.Entry, nil
+}
+
+// AddVCSRootEntry attaches VCS root r to buildType id with checkout rules cr
+func (c *Config) AddVCSRootEntry(id string, r string, cr string) error {
+	e := VCSRootEntry{ID: r, VCSRoot: TypeRef{ID: r}, CheckoutRules: cr}
+	return c.sendJSON("POST", "/httpAuth/app/rest/buildTypes/id:"+id+"/vcs-root-entries", e, nil)
+}
+
+// SetVCSRootEntryCheckoutRules sets the checkout rules of VCS root r on buildType id to cr
+func (c *Config) SetVCSRootEntryCheckoutRules(id string, r string, cr string) error {
+	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/vcs-root-entries/" + url.PathEscape(r) + "/checkout-rules"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(cr), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteVCSRootEntry detaches VCS root r from buildType id
+func (c *Config) DeleteVCSRootEntry(id string, r string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/buildTypes/id:"+id+"/vcs-root-entries/"+url.PathEscape(r), nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
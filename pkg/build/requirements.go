@@ -0,0 +1,64 @@
+package build
+
+import (
+	"encoding/json"
+)
+
+// Properties contains generic property data
+type Properties struct {
+	Count    int        `json:"count,omitempty"`
+	Property []Property `json:"property"`
+}
+
+// Property contains a generic property
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Get returns the value of property n
+func (p Properties) Get(n string) string {
+	for _, pp := range p.Property {
+		if pp.Name == n {
+			return pp.Value
+		}
+	}
+	return ""
+}
+
+// Requirement contains agent requirement data
+type Requirement struct {
+	ID         string     `json:"id,omitempty"`
+	Type       string     `json:"type"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	Inherited  bool       `json:"inherited,omitempty"`
+	Properties Properties `json:"properties"`
+}
+
+// PropertyName returns the agent property name the requirement checks
+func (r Requirement) PropertyName() string {
+	return r.Properties.Get("property-name")
+}
+
+// PropertyValue returns the value the requirement compares against
+func (r Requirement) PropertyValue() string {
+	return r.Properties.Get("property-value")
+}
+
+// AgentRequirements returns agent requirements for a buildType id
+func (c *Config) AgentRequirements(id string) ([]Requirement, error) {
+	type requirements struct {
+		Count       int           `json:"count"`
+		Requirement []Requirement `json:"agent-requirement"`
+	}
+	rb := &requirements{}
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes/id:"+id+"/agent-requirements", nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &rb)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return rb.Requirement, nil
+}
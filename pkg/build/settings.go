@@ -0,0 +1,364 @@
+package build
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// TypeRef references a buildType
+type TypeRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Step contains build step data
+type Step struct {
+	ID         string     `json:"id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Type       string     `json:"type"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	Inherited  bool       `json:"inherited,omitempty"`
+	Properties Properties `json:"properties"`
+}
+
+// Feature contains build feature data
+type Feature struct {
+	ID         string     `json:"id,omitempty"`
+	Type       string     `json:"type"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	Inherited  bool       `json:"inherited,omitempty"`
+	Properties Properties `json:"properties"`
+}
+
+// Dependency contains snapshot or artifact dependency data
+type Dependency struct {
+	ID              string     `json:"id,omitempty"`
+	Type            string     `json:"type"`
+	Disabled        bool       `json:"disabled,omitempty"`
+	Inherited       bool       `json:"inherited,omitempty"`
+	Properties      Properties `json:"properties"`
+	SourceBuildType *TypeRef   `json:"source-buildType,omitempty"`
+}
+
+// TypeSettings contains the editable settings of a buildType
+type TypeSettings struct {
+	Steps                []Step        `json:"steps"`
+	Features             []Feature     `json:"features"`
+	SnapshotDependencies []Dependency  `json:"snapshotDependencies"`
+	ArtifactDependencies []Dependency  `json:"artifactDependencies"`
+	AgentRequirements    []Requirement `json:"agentRequirements"`
+}
+
+// Settings collections of a buildType, with the JSON key of their entries
+const (
+	stepsPath                = "steps"
+	featuresPath             = "features"
+	snapshotDependenciesPath = "snapshot-dependencies"
+	artifactDependenciesPath = "artifact-dependencies"
+	agentRequirementsPath    = "agent-requirements"
+)
+
+// settingsKeys maps settings collections to the JSON key of their entries
+var settingsKeys = map[string]string{
+	stepsPath:                "step",
+	featuresPath:             "feature",
+	snapshotDependenciesPath: "snapshot-dependency",
+	artifactDependenciesPath: "artifact-dependency",
+	agentRequirementsPath:    "agent-requirement",
+}
+
+// settingsURL returns the URL of settings collection p of buildType id,
+// or of entry e in the collection if e is not empty
+func settingsURL(id string, p string, e string) string {
+	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/" + p
+	if e != "" {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+// getSettings reads settings collection p of buildType id into v
+func (c *Config) getSettings(id string, p string, v interface{}) error {
+	rd, err := c.Client.HTTPRequest("GET", settingsURL(id, p, ""), nil)
+	if err != nil {
+		return err
+	}
+	cl := make(map[string]json.RawMessage)
+	jerr := json.Unmarshal(rd, &cl)
+	if jerr != nil {
+		return jerr
+	}
+	if ed, ok := cl[settingsKeys[p]]; ok {
+		return json.Unmarshal(ed, v)
+	}
+	return nil
+}
+
+// sendJSON sends v as JSON with method m to u and reads the response into r if r is not nil
+func (c *Config) sendJSON(m string, u string, v interface{}, r interface{}) error {
+	jd, jerr := json.Marshal(v)
+	if jerr != nil {
+		return jerr
+	}
+	rd, err := c.Client.HTTPRequestWithType(m, u, jd, "application/json", "application/json")
+	if err != nil {
+		return err
+	}
+	if r == nil || len(rd) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rd, r)
+}
+
+// setSettings replaces settings collection p of buildType id with entries v
+func (c *Config) setSettings(id string, p string, v interface{}) error {
+	ed, jerr := json.Marshal(v)
+	if jerr != nil {
+		return jerr
+	}
+	if string(ed) == "null" {
+		ed = []byte("[]")
+	}
+	cl := map[string]json.RawMessage{settingsKeys[p]: ed}
+	return c.sendJSON("PUT", settingsURL(id, p, ""), cl, nil)
+}
+
+// deleteSetting deletes entry e from settings collection p of buildType id
+func (c *Config) deleteSetting(id string, p string, e string) error {
+	_, err := c.Client.HTTPRequest("DELETE", settingsURL(id, p, e), nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Steps returns build steps for buildType id
+func (c *Config) Steps(id string) ([]Step, error) {
+	var ss []Step
+	err := c.getSettings(id, stepsPath, &ss)
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// AddStep adds build step s to buildType id and returns the created step
+func (c *Config) AddStep(id string, s Step) (*Step, error) {
+	ns := &Step{}
+	err := c.sendJSON("POST", settingsURL(id, stepsPath, ""), s, ns)
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// UpdateStep replaces build step s.ID on buildType id
+func (c *Config) UpdateStep(id string, s Step) (*Step, error) {
+	ns := &Step{}
+	err := c.sendJSON("PUT", settingsURL(id, stepsPath, s.ID), s, ns)
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// DeleteStep deletes build step s from buildType id
+func (c *Config) DeleteStep(id string, s string) error {
+	return c.deleteSetting(id, stepsPath, s)
+}
+
+// SetSteps replaces all build steps on buildType id with ss
+func (c *Config) SetSteps(id string, ss []Step) error {
+	return c.setSettings(id, stepsPath, ss)
+}
+
+// Features returns build features for buildType id
+func (c *Config) Features(id string) ([]Feature, error) {
+	var fs []Feature
+	err := c.getSettings(id, featuresPath, &fs)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// AddFeature adds build feature f to buildType id and returns the created feature
+func (c *Config) AddFeature(id string, f Feature) (*Feature, error) {
+	nf := &Feature{}
+	err := c.sendJSON("POST", settingsURL(id, featuresPath, ""), f, nf)
+	if err != nil {
+		return nil, err
+	}
+	return nf, nil
+}
+
+// UpdateFeature replaces build feature f.ID on buildType id
+func (c *Config) UpdateFeature(id string, f Feature) (*Feature, error) {
+	nf := &Feature{}
+	err := c.sendJSON("PUT", settingsURL(id, featuresPath, f.ID), f, nf)
+	if err != nil {
+		return nil, err
+	}
+	return nf, nil
+}
+
+// DeleteFeature deletes build feature f from buildType id
+func (c *Config) DeleteFeature(id string, f string) error {
+	return c.deleteSetting(id, featuresPath, f)
+}
+
+// SetFeatures replaces all build features on buildType id with fs
+func (c *Config) SetFeatures(id string, fs []Feature) error {
+	return c.setSettings(id, featuresPath, fs)
+}
+
+// SnapshotDependencies returns snapshot dependencies for buildType id
+func (c *Config) SnapshotDependencies(id string) ([]Dependency, error) {
+	var ds []Dependency
+	err := c.getSettings(id, snapshotDependenciesPath, &ds)
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// AddSnapshotDependency adds snapshot dependency d to buildType id and returns the created dependency
+func (c *Config) AddSnapshotDependency(id string, d Dependency) (*Dependency, error) {
+	nd := &Dependency{}
+	err := c.sendJSON("POST", settingsURL(id, snapshotDependenciesPath, ""), d, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// UpdateSnapshotDependency replaces snapshot dependency d.ID on buildType id
+func (c *Config) UpdateSnapshotDependency(id string, d Dependency) (*Dependency, error) {
+	nd := &Dependency{}
+	err := c.sendJSON("PUT", settingsURL(id, snapshotDependenciesPath, d.ID), d, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// DeleteSnapshotDependency deletes snapshot dependency d from buildType id
+func (c *Config) DeleteSnapshotDependency(id string, d string) error {
+	return c.deleteSetting(id, snapshotDependenciesPath, d)
+}
+
+// SetSnapshotDependencies replaces all snapshot dependencies on buildType id with ds
+func (c *Config) SetSnapshotDependencies(id string, ds []Dependency) error {
+	return c.setSettings(id, snapshotDependenciesPath, ds)
+}
+
+// ArtifactDependencies returns artifact dependencies for buildType id
+func (c *Config) ArtifactDependencies(id string) ([]Dependency, error) {
+	var ds []Dependency
+	err := c.getSettings(id, artifactDependenciesPath, &ds)
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// AddArtifactDependency adds artifact dependency d to buildType id and returns the created dependency
+func (c *Config) AddArtifactDependency(id string, d Dependency) (*Dependency, error) {
+	nd := &Dependency{}
+	err := c.sendJSON("POST", settingsURL(id, artifactDependenciesPath, ""), d, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// UpdateArtifactDependency replaces artifact dependency d.ID on buildType id
+func (c *Config) UpdateArtifactDependency(id string, d Dependency) (*Dependency, error) {
+	nd := &Dependency{}
+	err := c.sendJSON("PUT", settingsURL(id, artifactDependenciesPath, d.ID), d, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// DeleteArtifactDependency deletes artifact dependency d from buildType id
+func (c *Config) DeleteArtifactDependency(id string, d string) error {
+	return c.deleteSetting(id, artifactDependenciesPath, d)
+}
+
+// SetArtifactDependencies replaces all artifact dependencies on buildType id with ds
+func (c *Config) SetArtifactDependencies(id string, ds []Dependency) error {
+	return c.setSettings(id, artifactDependenciesPath, ds)
+}
+
+// AddAgentRequirement adds agent requirement r to buildType id and returns the created requirement
+func (c *Config) AddAgentRequirement(id string, r Requirement) (*Requirement, error) {
+	nr := &Requirement{}
+	err := c.sendJSON("POST", settingsURL(id, agentRequirementsPath, ""), r, nr)
+	if err != nil {
+		return nil, err
+	}
+	return nr, nil
+}
+
+// UpdateAgentRequirement replaces agent requirement r.ID on buildType id
+func (c *Config) UpdateAgentRequirement(id string, r Requirement) (*Requirement, error) {
+	nr := &Requirement{}
+	err := c.sendJSON("PUT", settingsURL(id, agentRequirementsPath, r.ID), r, nr)
+	if err != nil {
+		return nil, err
+	}
+	return nr, nil
+}
+
+// DeleteAgentRequirement deletes agent requirement r from buildType id
+func (c *Config) DeleteAgentRequirement(id string, r string) error {
+	return c.deleteSetting(id, agentRequirementsPath, r)
+}
+
+// SetAgentRequirements replaces all agent requirements on buildType id with rs
+func (c *Config) SetAgentRequirements(id string, rs []Requirement) error {
+	return c.setSettings(id, agentRequirementsPath, rs)
+}
+
+// Settings returns the steps, features, dependencies and agent requirements of buildType id
+func (c *Config) Settings(id string) (*TypeSettings, error) {
+	ts := &TypeSettings{}
+	var err error
+	if ts.Steps, err = c.Steps(id); err != nil {
+		return nil, err
+	}
+	if ts.Features, err = c.Features(id); err != nil {
+		return nil, err
+	}
+	if ts.SnapshotDependencies, err = c.SnapshotDependencies(id); err != nil {
+		return nil, err
+	}
+	if ts.ArtifactDependencies, err = c.ArtifactDependencies(id); err != nil {
+		return nil, err
+	}
+	if ts.AgentRequirements, err = c.AgentRequirements(id); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// SetSettings replaces the steps, features, dependencies and agent requirements
+// of buildType id with ts. Snapshot dependencies are set before artifact
+// dependencies, which may depend on them.
+func (c *Config) SetSettings(id string, ts *TypeSettings) error {
+	if err := c.SetSteps(id, ts.Steps); err != nil {
+		return err
+	}
+	if err := c.SetFeatures(id, ts.Features); err != nil {
+		return err
+	}
+	if err := c.SetSnapshotDependencies(id, ts.SnapshotDependencies); err != nil {
+		return err
+	}
+	if err := c.SetArtifactDependencies(id, ts.ArtifactDependencies); err != nil {
+		return err
+	}
+	return c.SetAgentRequirements(id, ts.AgentRequirements)
+}
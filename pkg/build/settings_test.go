@@ -0,0 +1,76 @@
+package build
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestSettingsRoundTrip tests reading buildType settings and writing them back unchanged
+func TestSettingsRoundTrip(t *testing.T) {
+	collections := map[string]string{
+		"steps": `{"count":1,"step":[{"id":"RUNNER_1","name":"Build","type":"simpleRunner",
+			"properties":{"count":2,"property":[{"name":"script.content","value":"make"},{"name":"use.custom.script","value":"true"}]}}]}`,
+		"features": `{"count":1,"feature":[{"id":"BUILD_EXT_1","type":"commit-status-publisher","disabled":true,
+			"properties":{"property":[{"name":"publisherId","value":"githubStatusPublisher"}]}}]}`,
+		"snapshot-dependencies": `{"count":1,"snapshot-dependency":[{"id":"Proj_Compile","type":"snapshot_dependency",
+			"properties":{"property":[{"name":"run-build-on-the-same-agent","value":"false"}]},
+			"source-buildType":{"id":"Proj_Compile","name":"Compile","href":"/app/rest/buildTypes/id:Proj_Compile"}}]}`,
+		"artifact-dependencies": `{"count":1,"artifact-dependency":[{"id":"ARTIFACT_DEPENDENCY_1","type":"artifact_dependency",
+			"properties":{"property":[{"name":"pathRules","value":"*.jar"},{"name":"revisionName","value":"sameChainOrLastFinished"}]},
+			"source-buildType":{"id":"Proj_Compile"}}]}`,
+		"agent-requirements": `{"count":1,"agent-requirement":[{"id":"RQ_1","type":"equals",
+			"properties":{"property":[{"name":"property-name","value":"teamcity.agent.jvm.os.name"},{"name":"property-value","value":"Linux"}]}}]}`,
+	}
+	written := make(map[string][]byte)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path[len("/httpAuth/app/rest/buildTypes/id:bt1/"):]
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(collections[p]))
+		case "PUT":
+			bd, _ := ioutil.ReadAll(r.Body)
+			written[p] = bd
+			w.Write(bd)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	s, err := c.Settings("bt1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Steps) != 1 || s.Steps[0].Properties.Get("script.content") != "make" || !s.Features[0].Disabled {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	if s.SnapshotDependencies[0].SourceBuildType.ID != "Proj_Compile" || s.AgentRequirements[0].PropertyValue() != "Linux" {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	if err := c.SetSettings("bt1", s); err != nil {
+		t.Fatal(err)
+	}
+	ws := &TypeSettings{}
+	for p, v := range map[string]interface{}{
+		"steps":                 &ws.Steps,
+		"features":              &ws.Features,
+		"snapshot-dependencies": &ws.SnapshotDependencies,
+		"artifact-dependencies": &ws.ArtifactDependencies,
+		"agent-requirements":    &ws.AgentRequirements,
+	} {
+		cl := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(written[p], &cl); err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if err := json.Unmarshal(cl[settingsKeys[p]], v); err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+	}
+	if !reflect.DeepEqual(s, ws) {
+		t.Errorf("settings changed on round trip:\n%+v\n%+v", s, ws)
+	}
+}
@@ -0,0 +1,202 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TriggerSnapshotVersion is the current trigger snapshot format version
+const TriggerSnapshotVersion = 1
+
+// Trigger drift kinds reported by RestoreTriggerSnapshot
+const (
+	DriftTypeDeleted    = "buildTypeDeleted"
+	DriftTriggerDeleted = "triggerDeleted"
+	DriftTriggerAdded   = "triggerAdded"
+	DriftTriggerChanged = "triggerChanged"
+)
+
+// TriggerSnapshot contains a versioned project trigger snapshot
+type TriggerSnapshot struct {
+	Version    int            `json:"version"`
+	Server     string         `json:"server"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Project    string         `json:"project"`
+	BuildTypes []TypeTriggers `json:"buildTypes"`
+}
+
+// TypeTriggers contains the triggers for a single buildType
+type TypeTriggers struct {
+	ID       string    `json:"id"`
+	Triggers []Trigger `json:"triggers"`
+}
+
+// TriggerDrift contains a difference between a snapshot and the server
+type TriggerDrift struct {
+	Kind        string `json:"kind"`
+	BuildTypeID string `json:"buildTypeId"`
+	TriggerID   string `json:"triggerId,omitempty"`
+}
+
+// String returns a human readable drift line
+func (d TriggerDrift) String() string {
+	if d.TriggerID == "" {
+		return d.Kind + ": " + d.BuildTypeID
+	}
+	return d.Kind + ": " + d.BuildTypeID + "/" + d.TriggerID
+}
+
+// ProjectTriggerSnapshot returns a trigger snapshot for all buildTypes in
+// project p and its descendant projects
+func (c *Config) ProjectTriggerSnapshot(p string) (*TriggerSnapshot, error) {
+	ts, err := c.TypesForProjectTree(p)
+	if err != nil {
+		return nil, err
+	}
+	return c.TypesTriggerSnapshot(p, ts)
+}
+
+// TypesTriggerSnapshot returns a trigger snapshot for buildTypes ts,
+// recorded against project p which may be empty for server-wide snapshots
+func (c *Config) TypesTriggerSnapshot(p string, ts []Type) (*TriggerSnapshot, error) {
+	s := &TriggerSnapshot{
+		Version:   TriggerSnapshotVersion,
+		Server:    c.Client.Host,
+		Timestamp: time.Now().UTC(),
+		Project:   p,
+	}
+	for _, t := range ts {
+		tts, err := c.BuildTriggers(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.BuildTypes = append(s.BuildTypes, TypeTriggers{ID: t.ID, Triggers: tts})
+	}
+	return s, nil
+}
+
+// SaveTriggerSnapshot saves the trigger snapshot s to file f
+func (c *Config) SaveTriggerSnapshot(s *TriggerSnapshot, f string) error {
+	of, ferr := os.Create(f)
+	if ferr != nil {
+		return ferr
+	}
+	defer of.Close()
+	jd, jerr := json.MarshalIndent(s, "", "  ")
+	if jerr != nil {
+		return jerr
+	}
+	_, werr := of.Write(jd)
+	if werr != nil {
+		return werr
+	}
+	return nil
+}
+
+// ParseTriggerSnapshot parses a trigger snapshot from a file
+func ParseTriggerSnapshot(f string) (*TriggerSnapshot, error) {
+	bd, rerr := ioutil.ReadFile(f)
+	if rerr != nil {
+		return nil, rerr
+	}
+	if td := strings.TrimSpace(string(bd)); strings.HasPrefix(td, "[") {
+		return nil, errors.New(f + " is a flat trigger state without buildType IDs, use TriggerStateFromFile")
+	}
+	s := &TriggerSnapshot{}
+	jerr := json.Unmarshal(bd, s)
+	if jerr != nil {
+		return nil, jerr
+	}
+	if s.Version < 1 || s.Version > TriggerSnapshotVersion {
+		return nil, errors.New("unsupported trigger snapshot version " + strconv.Itoa(s.Version))
+	}
+	return s, nil
+}
+
+// DisableSnapshotTriggers disables every trigger that is enabled in snapshot s.
+// Triggers and buildTypes deleted since the snapshot are skipped.
+func (c *Config) DisableSnapshotTriggers(s *TriggerSnapshot) error {
+	var erstrs []string
+	for _, bt := range s.BuildTypes {
+		for _, t := range bt.Triggers {
+			if t.Disabled {
+				continue
+			}
+			if err := c.DisableBuildTrigger(bt.ID, t.ID); err != nil && !teamcity.IsNotFound(err) {
+				erstrs = append(erstrs, err.Error())
+			}
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
+
+// RestoreProjectTriggerState restores the project trigger snapshot in file f
+// and returns the drift found since the snapshot was taken
+func (c *Config) RestoreProjectTriggerState(f string) ([]TriggerDrift, error) {
+	s, err := ParseTriggerSnapshot(f)
+	if err != nil {
+		return nil, err
+	}
+	return c.RestoreTriggerSnapshot(s)
+}
+
+// RestoreTriggerSnapshot sets each trigger in snapshot s back on its own buildType.
+// Triggers and buildTypes deleted since the snapshot are skipped and reported as drift,
+// as are triggers added since the snapshot.
+func (c *Config) RestoreTriggerSnapshot(s *TriggerSnapshot) ([]TriggerDrift, error) {
+	if !teamcity.SameHost(s.Server, c.Client.Host) {
+		return nil, errors.New("snapshot was taken on " + s.Server + ", not " + c.Client.Host)
+	}
+	var ds []TriggerDrift
+	var erstrs []string
+	for _, bt := range s.BuildTypes {
+		cts, err := c.BuildTriggers(bt.ID)
+		if teamcity.IsNotFound(err) {
+			ds = append(ds, TriggerDrift{Kind: DriftTypeDeleted, BuildTypeID: bt.ID})
+			continue
+		} else if err != nil {
+			erstrs = append(erstrs, err.Error())
+			continue
+		}
+		current := make(map[string]Trigger)
+		for _, ct := range cts {
+			current[ct.ID] = ct
+		}
+		saved := make(map[string]bool)
+		for _, t := range bt.Triggers {
+			saved[t.ID] = true
+			ct, ok := current[t.ID]
+			if !ok {
+				ds = append(ds, TriggerDrift{Kind: DriftTriggerDeleted, BuildTypeID: bt.ID, TriggerID: t.ID})
+				continue
+			}
+			if ct.Disabled == t.Disabled {
+				continue
+			}
+			ds = append(ds, TriggerDrift{Kind: DriftTriggerChanged, BuildTypeID: bt.ID, TriggerID: t.ID})
+			derr := c.SetBuildTriggerDisable(bt.ID, t.ID, t.Disabled)
+			if derr != nil {
+				erstrs = append(erstrs, derr.Error())
+			}
+		}
+		for _, ct := range cts {
+			if !saved[ct.ID] {
+				ds = append(ds, TriggerDrift{Kind: DriftTriggerAdded, BuildTypeID: bt.ID, TriggerID: ct.ID})
+			}
+		}
+	}
+	if len(erstrs) > 0 {
+		return ds, errors.New(strings.Join(erstrs, "; "))
+	}
+	return ds, nil
+}
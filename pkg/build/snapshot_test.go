@@ -0,0 +1,152 @@
+package build
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/teamcitytest"
+)
+
+// TestRestoreTriggerSnapshot tests RestoreTriggerSnapshot against a stub server
+func TestRestoreTriggerSnapshot(t *testing.T) {
+	var puts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/buildTypes/id:bt1/triggers":
+			w.Write([]byte(`{"count":2,"trigger":[{"id":"t1","type":"vcsTrigger","disabled":true},{"id":"t3","type":"schedulingTrigger"}]}`))
+		case r.Method == "PUT" && r.URL.Path == "/httpAuth/app/rest/buildTypes/id:bt1/triggers/t1/disabled":
+			bd, _ := ioutil.ReadAll(r.Body)
+			puts = append(puts, string(bd))
+			w.Write(bd)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	s := &TriggerSnapshot{
+		Version: TriggerSnapshotVersion,
+		Server:  ts.URL,
+		BuildTypes: []TypeTriggers{
+			{ID: "bt1", Triggers: []Trigger{{ID: "t1"}, {ID: "t2"}}},
+			{ID: "bt2", Triggers: []Trigger{{ID: "t4"}}},
+		},
+	}
+	ds, err := c.RestoreTriggerSnapshot(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TriggerDrift{
+		{Kind: DriftTriggerChanged, BuildTypeID: "bt1", TriggerID: "t1"},
+		{Kind: DriftTriggerDeleted, BuildTypeID: "bt1", TriggerID: "t2"},
+		{Kind: DriftTriggerAdded, BuildTypeID: "bt1", TriggerID: "t3"},
+		{Kind: DriftTypeDeleted, BuildTypeID: "bt2"},
+	}
+	if len(ds) != len(want) {
+		t.Fatalf("drift = %v, want %v", ds, want)
+	}
+	for i := range want {
+		if ds[i] != want[i] {
+			t.Errorf("drift[%d] = %v, want %v", i, ds[i], want[i])
+		}
+	}
+	if len(puts) != 1 || puts[0] != "false" {
+		t.Errorf("unexpected trigger updates: %v", puts)
+	}
+	s.Server = "https://other.example.com"
+	if _, err := c.RestoreTriggerSnapshot(s); err == nil {
+		t.Error("expected error restoring snapshot from another server")
+	}
+}
+
+// TestParseTriggerSnapshot tests ParseTriggerSnapshot
+func TestParseTriggerSnapshot(t *testing.T) {
+	c := &Config{Client: teamcity.New("https://teamcity.example.com", "", "")}
+	f := "/tmp/go-teamcity-test-trigger-snapshot.json"
+	os.Remove(f)
+	s := &TriggerSnapshot{
+		Version:    TriggerSnapshotVersion,
+		Server:     c.Client.Host,
+		Project:    "proj",
+		BuildTypes: []TypeTriggers{{ID: "bt1", Triggers: []Trigger{{ID: "t1", Disabled: true}}}},
+	}
+	if err := c.SaveTriggerSnapshot(s, f); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := ParseTriggerSnapshot(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.Project != "proj" || len(ps.BuildTypes) != 1 || !ps.BuildTypes[0].Triggers[0].Disabled {
+		t.Errorf("parsed snapshot does not match: %+v", ps)
+	}
+	if err := c.SaveTriggerState([]Trigger{{ID: "t1"}}, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTriggerSnapshot(f); err == nil {
+		t.Error("expected error parsing flat trigger state")
+	}
+	os.Remove(f)
+}
+
+// TestProjectTriggerSnapshotTree tests that snapshots cover the whole project tree
+// and can still be read as flat trigger state
+func TestProjectTriggerSnapshotTree(t *testing.T) {
+	s := teamcitytest.NewServer(teamcitytest.State{
+		Projects: []teamcitytest.Project{
+			{ID: "Payments", Name: "Payments"},
+			{ID: "Payments_Api", Name: "API", ParentProjectID: "Payments"},
+			{ID: "Payments_Api_V2", Name: "V2", ParentProjectID: "Payments_Api"},
+			{ID: "Orders", Name: "Orders"},
+		},
+		BuildTypes: []teamcitytest.BuildType{
+			{ID: "Payments_Build", Name: "Build", ProjectID: "Payments", Triggers: []teamcitytest.Trigger{{ID: "t0", Type: "vcsTrigger"}}},
+			{ID: "Payments_Api_Build", Name: "Build", ProjectID: "Payments_Api", Triggers: []teamcitytest.Trigger{{ID: "t1", Type: "vcsTrigger"}}},
+			{ID: "Payments_Api_V2_Build", Name: "Build", ProjectID: "Payments_Api_V2", Triggers: []teamcitytest.Trigger{{ID: "t2", Type: "vcsTrigger", Disabled: true}}},
+			{ID: "Orders_Build", Name: "Build", ProjectID: "Orders", Triggers: []teamcitytest.Trigger{{ID: "t3", Type: "vcsTrigger"}}},
+		},
+	})
+	defer s.Close()
+	c := &Config{Client: s.Client()}
+	sn, err := c.ProjectTriggerSnapshot("Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, bt := range sn.BuildTypes {
+		ids = append(ids, bt.ID)
+	}
+	if want := []string{"Payments_Build", "Payments_Api_Build", "Payments_Api_V2_Build"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("snapshot buildTypes = %v, want %v", ids, want)
+	}
+
+	f := "/tmp/go-teamcity-test-project-trigger-snapshot.json"
+	defer os.Remove(f)
+	if err := c.SaveProjectTriggerState("Payments", f); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := ParseTriggerState(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 3 || ts[2].ID != "t2" || !ts[2].Disabled {
+		t.Errorf("flat triggers from snapshot = %+v", ts)
+	}
+	if err := c.DisableBuildTrigger("Payments_Api_Build", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TriggerStateFromFile("Payments_Api_Build", f); err != nil {
+		t.Fatal(err)
+	}
+	if tr := s.State().BuildTypes[1].Triggers[0]; tr.Disabled {
+		t.Errorf("trigger not restored from snapshot: %+v", tr)
+	}
+	if err := c.TriggerStateFromFile("Orders_Build", f); err == nil {
+		t.Error("expected error restoring a buildType missing from the snapshot")
+	}
+}
@@ -13,6 +13,7 @@ type Trigger struct {
 	ID         string            `json:"id"`
 	Type       string            `json:"type"`
 	Disabled   bool              `json:"disabled"`
+	Inherited  bool              `json:"inherited,omitempty"`
 	Properties TriggerProperties `json:"properties"`
 }
 
@@ -46,9 +47,10 @@ func (c *Config) BuildTriggers(id string) ([]Trigger, error) {
 	return rb.Trigger, nil
 }
 
-// ProjectTriggers returns triggers for a project
+// ProjectTriggers returns the triggers of all buildTypes in project p and its
+// subprojects. Older versions only covered buildTypes of direct subprojects.
 func (c *Config) ProjectTriggers(p string) ([]Trigger, error) {
-	ts, err := c.TypesForProject(p)
+	ts, err := c.TypesForProjectTree(p)
 	if err != nil {
 		return nil, err
 	}
@@ -66,15 +68,42 @@ func (c *Config) ProjectTriggers(p string) ([]Trigger, error) {
 // SetBuildTriggerDisable sets disabled status a build trigger for a build
 func (c *Config) SetBuildTriggerDisable(id string, t string, d bool) error {
 	u := "/httpAuth/app/rest/buildTypes/id:" + id + "/triggers/" + t + "/disabled"
-	c.Client.Accept = "text/plain"
-	c.Client.ContentType = "text/plain"
 	var sb string
 	if d {
 		sb = "true"
 	} else {
 		sb = "false"
 	}
-	_, err := c.Client.HTTPRequest("PUT", u, []byte(sb))
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(sb), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddBuildTrigger adds trigger t to build id and returns the created trigger
+func (c *Config) AddBuildTrigger(id string, t Trigger) (*Trigger, error) {
+	nt := &Trigger{}
+	err := c.sendJSON("POST", "/httpAuth/app/rest/buildTypes/id:"+id+"/triggers", t, nt)
+	if err != nil {
+		return nil, err
+	}
+	return nt, nil
+}
+
+// UpdateBuildTrigger replaces trigger t.ID on build id
+func (c *Config) UpdateBuildTrigger(id string, t Trigger) (*Trigger, error) {
+	nt := &Trigger{}
+	err := c.sendJSON("PUT", "/httpAuth/app/rest/buildTypes/id:"+id+"/triggers/"+t.ID, t, nt)
+	if err != nil {
+		return nil, err
+	}
+	return nt, nil
+}
+
+// DeleteBuildTrigger deletes trigger t from build id
+func (c *Config) DeleteBuildTrigger(id string, t string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/buildTypes/id:"+id+"/triggers/"+t, nil)
 	if err != nil {
 		return err
 	}
@@ -122,43 +151,77 @@ func (c *Config) SaveBuildTriggerState(id string, f string) error {
 	return nil
 }
 
-// SaveProjectTriggerState saves the project trigger state to file f
+// SaveProjectTriggerState saves a project trigger snapshot to file f,
+// which can be restored with RestoreProjectTriggerState.
+// Older versions saved a flat trigger array instead, ParseTriggerState
+// and TriggerStateFromFile read both formats.
 func (c *Config) SaveProjectTriggerState(p string, f string) error {
-	ts, err := c.ProjectTriggers(p)
+	s, err := c.ProjectTriggerSnapshot(p)
 	if err != nil {
 		return err
 	}
-	terr := c.SaveTriggerState(ts, f)
+	terr := c.SaveTriggerSnapshot(s, f)
 	if terr != nil {
 		return terr
 	}
 	return nil
 }
 
-// ParseTriggerState parses a trigger state array from a file
+// ParseTriggerState parses a trigger state array from a file.
+// If the file is a trigger snapshot, the triggers of all its buildTypes are returned.
 func ParseTriggerState(f string) ([]Trigger, error) {
-	if _, err := os.Stat(f); os.IsNotExist(err) {
+	s, ts, err := parseTriggerFile(f)
+	if err != nil {
 		return nil, err
 	}
-	var ts []Trigger
+	if s != nil {
+		for _, bt := range s.BuildTypes {
+			ts = append(ts, bt.Triggers...)
+		}
+	}
+	return ts, nil
+}
+
+// parseTriggerFile parses file f as a trigger snapshot or a flat trigger state array
+func parseTriggerFile(f string) (*TriggerSnapshot, []Trigger, error) {
+	if _, err := os.Stat(f); os.IsNotExist(err) {
+		return nil, nil, err
+	}
 	bd, rerr := ioutil.ReadFile(f)
 	if rerr != nil {
-		return nil, rerr
+		return nil, nil, rerr
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(bd)), "[") {
+		s, err := ParseTriggerSnapshot(f)
+		return s, nil, err
 	}
+	var ts []Trigger
 	jerr := json.Unmarshal(bd, &ts)
 	if jerr != nil {
-		return nil, jerr
+		return nil, nil, jerr
 	}
-	return ts, nil
+	return nil, ts, nil
 }
 
 // TriggerStateFromFile sets the build trigger state for all Triggers
-// in build id from file f
+// in build id from file f. If f is a trigger snapshot, only the triggers
+// saved for build id are set.
 func (c *Config) TriggerStateFromFile(id string, f string) error {
-	ts, err := ParseTriggerState(f)
+	s, ts, err := parseTriggerFile(f)
 	if err != nil {
 		return err
 	}
+	if s != nil {
+		found := false
+		for _, bt := range s.BuildTypes {
+			if bt.ID == id {
+				ts, found = bt.Triggers, true
+			}
+		}
+		if !found {
+			return errors.New(f + " has no triggers saved for buildType " + id)
+		}
+	}
 	var erstrs []string
 	for _, t := range ts {
 		derr := c.SetBuildTriggerDisable(id, t.ID, t.Disabled)
@@ -194,3 +257,16 @@ func (c *Config) SaveBuildStateAndDisableAll(id string, f string) error {
 	}
 	return nil
 }
+
+// SaveProjectStateAndDisableAll saves a trigger snapshot of project p and its
+// subprojects to file f and disables all triggers, restored with RestoreProjectTriggerState
+func (c *Config) SaveProjectStateAndDisableAll(p string, f string) error {
+	s, err := c.ProjectTriggerSnapshot(p)
+	if err != nil {
+		return err
+	}
+	if serr := c.SaveTriggerSnapshot(s, f); serr != nil {
+		return serr
+	}
+	return c.DisableSnapshotTriggers(s)
+}
@@ -3,39 +3,46 @@ package build
 import (
 	"os"
 	"testing"
-
-	"github.com/robertlestak/go-teamcity/pkg/teamcity"
 )
 
 // TestBuildTriggers tests the response for BuildTriggers
 func TestBuildTriggers(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "build_triggers")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
-	bt, err := c.BuildTriggers(os.Getenv("BUILD_ID"))
+	bt, err := c.BuildTriggers(cs.Var("BUILD_ID", os.Getenv("BUILD_ID")))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Build Triggers: %+v", bt)
+	if replaying(cs) && (len(bt) != 1 || bt[0].ID != "vcsTrigger" || bt[0].Type != "vcsTrigger" || bt[0].Properties.Count != 2) {
+		t.Errorf("unexpected build triggers %+v", bt)
+	}
 }
 
 // TestProjectTriggers tests the response for ProjectTriggers
 func TestProjectTriggers(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "project_triggers")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
-	bt, err := c.ProjectTriggers(os.Getenv("PROJECT_NAME"))
+	bt, err := c.ProjectTriggers(cs.Var("PROJECT_NAME", os.Getenv("PROJECT_NAME")))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Project Triggers: %+v", bt)
+	if replaying(cs) && (len(bt) != 3 || bt[1].ID != "TRIGGER_12" || bt[1].Type != "schedulingTrigger" || !bt[2].Disabled) {
+		t.Errorf("unexpected project triggers %+v", bt)
+	}
 }
 
 // TestSaveBuildTriggerState tests SaveBuildTriggerState
 func TestSaveBuildTriggerState(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "save_build_trigger_state")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	f := "/tmp/go-teamcity-test-build-trigger-state.json"
 	os.Remove(f)
-	err := c.SaveBuildTriggerState(os.Getenv("BUILD_ID"), f)
+	err := c.SaveBuildTriggerState(cs.Var("BUILD_ID", os.Getenv("BUILD_ID")), f)
 	if err != nil {
 		t.Error(err)
 	}
@@ -47,11 +54,12 @@ func TestSaveBuildTriggerState(t *testing.T) {
 
 // TestParseBuildTriggerState tests ParseBuildTriggerState
 func TestParseBuildTriggerState(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "parse_build_trigger_state")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	f := "/tmp/go-teamcity-test-build-trigger-state.json"
 	os.Remove(f)
-	ts, err := c.BuildTriggers(os.Getenv("BUILD_ID"))
+	ts, err := c.BuildTriggers(cs.Var("BUILD_ID", os.Getenv("BUILD_ID")))
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -70,32 +78,41 @@ func TestParseBuildTriggerState(t *testing.T) {
 	if len(ts) != len(pts) {
 		t.Errorf("Number of saved and parsed records do not match")
 	}
+	if replaying(cs) && (len(pts) != 1 || pts[0].ID != "vcsTrigger") {
+		t.Errorf("unexpected parsed triggers %+v", pts)
+	}
 	os.Remove(f)
 }
 
 // TestSaveProjectTriggerState tests SaveProjectTriggerState
 func TestSaveProjectTriggerState(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "save_project_trigger_state")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	f := "/tmp/go-teamcity-test-project-trigger-state.json"
 	os.Remove(f)
-	err := c.SaveProjectTriggerState(os.Getenv("PROJECT_NAME"), f)
+	err := c.SaveProjectTriggerState(cs.Var("PROJECT_NAME", os.Getenv("PROJECT_NAME")), f)
 	if err != nil {
 		t.Error(err)
 	}
-	if _, err := os.Stat(f); os.IsNotExist(err) {
+	s, err := ParseTriggerSnapshot(f)
+	if err != nil {
 		t.Error(err)
+	} else if replaying(cs) && (s.Project != "Payments" || len(s.BuildTypes) != 2 ||
+		s.BuildTypes[1].ID != "Payments_Api_Build" || len(s.BuildTypes[1].Triggers) != 2) {
+		t.Errorf("unexpected snapshot %+v", s)
 	}
 	os.Remove(f)
 }
 
 // TestParseProjectTriggerState tests ParseProjectTriggerState
 func TestParseProjectTriggerState(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "parse_project_trigger_state")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	f := "/tmp/go-teamcity-test-project-trigger-state.json"
 	os.Remove(f)
-	ts, err := c.ProjectTriggers(os.Getenv("PROJECT_NAME"))
+	ts, err := c.ProjectTriggers(cs.Var("PROJECT_NAME", os.Getenv("PROJECT_NAME")))
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -114,5 +131,8 @@ func TestParseProjectTriggerState(t *testing.T) {
 	if len(ts) != len(pts) {
 		t.Errorf("Number of saved and parsed records do not match")
 	}
+	if replaying(cs) && (len(pts) != 3 || pts[1].ID != "TRIGGER_12" || !pts[2].Disabled) {
+		t.Errorf("unexpected parsed triggers %+v", pts)
+	}
 	os.Remove(f)
 }
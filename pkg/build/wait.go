@@ -0,0 +1,54 @@
+package build
+
+import (
+	"errors"
+	"time"
+)
+
+// PollInterval is the time between checks while waiting
+var PollInterval = time.Second * 10
+
+// ErrTimeout is returned when a wait reaches its timeout
+var ErrTimeout = errors.New("Timeout reached")
+
+// WaitUntil calls done every PollInterval until it returns true or an error,
+// or timeout t is reached. If t is 0 it waits forever. done is not called
+// again once WaitUntil has returned.
+func WaitUntil(done func() (bool, error), t time.Duration) error {
+	var to <-chan time.Time
+	if t > 0 {
+		tm := time.NewTimer(t)
+		defer tm.Stop()
+		to = tm.C
+	}
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-to:
+			return ErrTimeout
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// WaitForBuilds waits up to timeout t until no running build matches m
+func (c *Config) WaitForBuilds(m func(Build) bool, t time.Duration) error {
+	return WaitUntil(func() (bool, error) {
+		rbs, err := c.RunningBuilds()
+		if err != nil {
+			return false, err
+		}
+		for _, b := range rbs {
+			if m(b) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, t)
+}
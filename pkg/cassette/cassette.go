@@ -0,0 +1,324 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is the current cassette file format version
+const Version = 1
+
+// Host replaces the recorded server in URLs and bodies
+const Host = "https://teamcity.example"
+
+// RecordEnv is the environment variable that switches Open to record mode
+const RecordEnv = "TEAMCITY_RECORD"
+
+// redacted replaces credentials in recorded bodies
+const redacted = "REDACTED"
+
+// minSecret is the shortest credential scrubbed from bodies, so short
+// values do not mangle unrelated text
+const minSecret = 4
+
+// Mode is whether a cassette records or replays
+type Mode int
+
+// Cassette modes
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// Request is a recorded request. Headers are not recorded.
+type Request struct {
+	Method string `json:"method"`
+	// URL is the path and query, without the server
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Interaction is a recorded request and response pair
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is an http.RoundTripper that records request/response pairs to
+// a file, or replays them from it. Set it as the Transport of a teamcity.Client.
+type Cassette struct {
+	Version int `json:"version"`
+	// Vars are test inputs, such as a buildType ID, recorded with the interactions
+	Vars         map[string]string `json:"vars,omitempty"`
+	Interactions []Interaction     `json:"interactions"`
+
+	file string
+	mode Mode
+	// Transport makes the requests while recording, http.DefaultTransport if nil
+	Transport http.RoundTripper `json:"-"`
+	mu        sync.Mutex
+	used      []bool
+	secrets   []string
+	hosts     []string
+}
+
+// Open returns a cassette for file f, recording if RecordEnv is set and replaying otherwise
+func Open(f string) (*Cassette, error) {
+	m := ModeReplay
+	if os.Getenv(RecordEnv) != "" {
+		m = ModeRecord
+	}
+	return Load(f, m)
+}
+
+// Load returns a cassette for file f in mode m. A recording cassette starts
+// empty, a replaying cassette reads f.
+func Load(f string, m Mode) (*Cassette, error) {
+	c := &Cassette{Version: Version, Vars: make(map[string]string), file: f, mode: m}
+	if m == ModeRecord {
+		return c, nil
+	}
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("cassette " + f + " does not exist, record it with " + RecordEnv + "=1")
+		}
+		return nil, err
+	}
+	if jerr := json.Unmarshal(bd, c); jerr != nil {
+		return nil, errors.New("cassette " + f + ": " + jerr.Error())
+	}
+	if c.Version != Version {
+		return nil, errors.New("cassette " + f + ": unsupported version " + strconv.Itoa(c.Version))
+	}
+	c.used = make([]bool, len(c.Interactions))
+	return c, nil
+}
+
+// Mode returns the cassette mode
+func (c *Cassette) Mode() Mode {
+	return c.mode
+}
+
+// Host returns server h while recording and the Host placeholder while replaying
+func (c *Cassette) Host(h string) string {
+	if c.mode == ModeRecord {
+		return h
+	}
+	return Host
+}
+
+// Var returns test input n. While recording v is stored and returned, while
+// replaying the recorded value is returned.
+func (c *Cassette) Var(n string, v string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == ModeRecord {
+		c.Vars[n] = v
+		return v
+	}
+	return c.Vars[n]
+}
+
+// Scrub adds secrets ss that are replaced in recorded bodies. Credentials
+// sent in the Authorization header are scrubbed without being added.
+func (c *Cassette) Scrub(ss ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range ss {
+		c.addSecret(s)
+	}
+}
+
+// addSecret adds secret s if it is long enough to scrub safely
+func (c *Cassette) addSecret(s string) {
+	if len(s) < minSecret {
+		return
+	}
+	for _, o := range c.secrets {
+		if o == s {
+			return
+		}
+	}
+	c.secrets = append(c.secrets, s)
+}
+
+// RoundTrip records or replays request r
+func (c *Cassette) RoundTrip(r *http.Request) (*http.Response, error) {
+	var bd []byte
+	if r.Body != nil {
+		var err error
+		bd, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.mode == ModeRecord {
+		return c.record(r, bd)
+	}
+	return c.replay(r, bd)
+}
+
+// record sends request r with body bd and records the scrubbed interaction
+func (c *Cassette) record(r *http.Request, bd []byte) (*http.Response, error) {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	nr := r.Clone(r.Context())
+	nr.Body = ioutil.NopCloser(bytes.NewReader(bd))
+	res, err := rt.RoundTrip(nr)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(rb))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u, p, ok := r.BasicAuth(); ok {
+		c.addSecret(u)
+		c.addSecret(p)
+	}
+	if a := r.Header.Get("Authorization"); strings.HasPrefix(a, "Bearer ") {
+		c.addSecret(strings.TrimPrefix(a, "Bearer "))
+	}
+	c.addHost(r.URL.Scheme + "://" + r.URL.Host)
+	c.Interactions = append(c.Interactions, Interaction{
+		Request: Request{
+			Method:      r.Method,
+			URL:         c.scrub(r.URL.RequestURI()),
+			ContentType: r.Header.Get("Content-Type"),
+			Body:        c.scrub(string(bd)),
+		},
+		Response: Response{
+			Status:      res.StatusCode,
+			ContentType: res.Header.Get("Content-Type"),
+			Body:        c.scrub(string(rb)),
+		},
+	})
+	return res, nil
+}
+
+// addHost adds server u to the hosts replaced in recordings
+func (c *Cassette) addHost(u string) {
+	for _, h := range c.hosts {
+		if h == u {
+			return
+		}
+	}
+	c.hosts = append(c.hosts, u)
+}
+
+// scrub replaces server URLs, hostnames and secrets in s
+func (c *Cassette) scrub(s string) string {
+	ph := strings.TrimPrefix(Host, "https://")
+	for _, h := range c.hosts {
+		s = strings.Replace(s, h, Host, -1)
+		hp := h[strings.Index(h, "://")+3:]
+		s = strings.Replace(s, hp, ph, -1)
+		if i := strings.LastIndex(hp, ":"); i > 0 {
+			s = strings.Replace(s, hp[:i], ph, -1)
+		}
+	}
+	for _, sc := range c.secrets {
+		s = strings.Replace(s, sc, redacted, -1)
+	}
+	return s
+}
+
+// replay returns the first unused recorded response matching request r with
+// body bd. Once every match has been used the last one is repeated.
+func (c *Cassette) replay(r *http.Request, bd []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := r.URL.RequestURI()
+	last := -1
+	for i, in := range c.Interactions {
+		if in.Request.Method != r.Method || in.Request.URL != u || in.Request.Body != string(bd) {
+			continue
+		}
+		last = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, errors.New("cassette " + c.file + ": no recorded response for " + r.Method + " " + u +
+			", re-record it with " + RecordEnv + "=1")
+	}
+	c.used[last] = true
+	res := c.Interactions[last].Response
+	h := make(http.Header)
+	if res.ContentType != "" {
+		h.Set("Content-Type", res.ContentType)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(res.Status) + " " + http.StatusText(res.Status),
+		StatusCode:    res.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(strings.NewReader(res.Body)),
+		ContentLength: int64(len(res.Body)),
+		Request:       r,
+	}, nil
+}
+
+// Unused returns the recorded interactions that have not been replayed
+func (c *Cassette) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == ModeRecord {
+		return nil
+	}
+	var is []Interaction
+	for i, in := range c.Interactions {
+		if !c.used[i] {
+			is = append(is, in)
+		}
+	}
+	return is
+}
+
+// Save writes a recording cassette to its file. Replaying cassettes are not written.
+func (c *Cassette) Save() error {
+	if c.mode != ModeRecord {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bd, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if merr := os.MkdirAll(filepath.Dir(c.file), 0755); merr != nil {
+		return merr
+	}
+	tf := c.file + ".tmp"
+	if werr := ioutil.WriteFile(tf, append(bd, '\n'), 0644); werr != nil {
+		return werr
+	}
+	return os.Rename(tf, c.file)
+}
@@ -0,0 +1,106 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// get makes a GET request for path p through cassette c against server h
+func get(t *testing.T, c *Cassette, h string, p string) (int, string, error) {
+	req, err := http.NewRequest("GET", h+p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("ci-reader", "hunter2hunter2")
+	res, err := (&http.Client{Transport: c}).Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	bd, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(bd), nil
+}
+
+// TestRecordReplay tests scrubbing, ordered replay and unmatched requests
+func TestRecordReplay(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count":` + strconv.Itoa(n) + `,"href":"http://` + r.Host + `/app/rest/buildQueue","user":"ci-reader"}`))
+	}))
+	defer ts.Close()
+	d, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "testdata", "queue.json")
+
+	rc, err := Load(f, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := rc.Var("BUILD_ID", "Payments_Build"); id != "Payments_Build" {
+		t.Errorf("recorded var = %s", id)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := get(t, rc, rc.Host(ts.URL), "/httpAuth/app/rest/buildQueue"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rc.Save(); err != nil {
+		t.Fatal(err)
+	}
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(ts.URL, "http://")
+	for _, leak := range []string{host, "ci-reader", "hunter2hunter2"} {
+		if strings.Contains(string(bd), leak) {
+			t.Errorf("cassette contains %q:\n%s", leak, bd)
+		}
+	}
+
+	pc, err := Load(f, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := pc.Var("BUILD_ID", ""); id != "Payments_Build" {
+		t.Errorf("replayed var = %s", id)
+	}
+	var bodies []string
+	for i := 0; i < 3; i++ {
+		st, b, err := get(t, pc, pc.Host(""), "/httpAuth/app/rest/buildQueue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st != http.StatusOK {
+			t.Errorf("replayed status %d", st)
+		}
+		bodies = append(bodies, b)
+	}
+	want := []string{`"count":1`, `"count":2`, `"count":2`}
+	for i, b := range bodies {
+		if !strings.Contains(b, want[i]) || !strings.Contains(b, "teamcity.example/app/rest") || !strings.Contains(b, `"user":"REDACTED"`) {
+			t.Errorf("replay %d = %s", i, b)
+		}
+	}
+	if len(pc.Unused()) != 0 {
+		t.Errorf("unused interactions %+v", pc.Unused())
+	}
+	_, _, err = get(t, pc, pc.Host(""), "/httpAuth/app/rest/builds")
+	if err == nil || !strings.Contains(err.Error(), "no recorded response for GET /httpAuth/app/rest/builds") {
+		t.Errorf("expected unmatched request error, got %v", err)
+	}
+	if _, err := Load(filepath.Join(d, "missing.json"), ModeReplay); err == nil || !strings.Contains(err.Error(), RecordEnv) {
+		t.Errorf("expected missing cassette error, got %v", err)
+	}
+}
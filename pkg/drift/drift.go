@@ -0,0 +1,426 @@
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/projectspec"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/vcs"
+)
+
+// Difference states
+const (
+	OnlySource = "onlySource"
+	OnlyTarget = "onlyTarget"
+	Changed    = "changed"
+)
+
+// Difference kinds
+const (
+	KindProject            = "project"
+	KindBuildType          = "buildType"
+	KindField              = "field"
+	KindPaused             = "paused"
+	KindParameter          = "parameter"
+	KindTemplate           = "template"
+	KindVCSRoot            = "vcsRoot"
+	KindVCSRootProperty    = "vcsRootProperty"
+	KindTrigger            = "trigger"
+	KindSnapshotDependency = "snapshotDependency"
+	KindArtifactDependency = "artifactDependency"
+)
+
+var kinds = []string{
+	KindProject, KindBuildType, KindField, KindPaused, KindParameter, KindTemplate,
+	KindVCSRoot, KindVCSRootProperty, KindTrigger, KindSnapshotDependency, KindArtifactDependency,
+}
+
+// Config contains config data
+type Config struct {
+	Source *teamcity.Client
+	Target *teamcity.Client
+	Ignore []Rule
+}
+
+// Rule ignores differences of a kind whose path matches a pattern.
+// Patterns use path.Match syntax, except that * also matches /, so
+// Payments_* matches Payments_Build/env.GOOS. An empty Kind matches every kind.
+type Rule struct {
+	Kind    string `json:"kind,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+// Difference contains a single difference between the source and target server.
+// Path is the owning project or buildType ID, followed by the item name for
+// parameters, fields and settings, such as Payments_Build/env.GOOS.
+type Difference struct {
+	State  string `json:"state"`
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// Report contains the differences found for a project
+type Report struct {
+	Project     string       `json:"project"`
+	Source      string       `json:"source"`
+	Target      string       `json:"target"`
+	Differences []Difference `json:"differences"`
+}
+
+// ParseRule parses an ignore rule of the form kind:pattern or pattern
+func ParseRule(s string) (Rule, error) {
+	r := Rule{Pattern: s}
+	if i := strings.Index(s, ":"); i > 0 {
+		for _, k := range kinds {
+			if s[:i] == k {
+				r = Rule{Kind: k, Pattern: s[i+1:]}
+				break
+			}
+		}
+	}
+	if _, err := match(r.Pattern, ""); err != nil {
+		return r, errors.New("invalid ignore pattern " + strconv.Quote(r.Pattern))
+	}
+	return r, nil
+}
+
+// Matches returns true if the rule ignores difference d
+func (r Rule) Matches(d Difference) bool {
+	if r.Kind != "" && r.Kind != d.Kind {
+		return false
+	}
+	m, _ := match(r.Pattern, d.Path)
+	return m
+}
+
+// match reports whether name matches pattern p, with / treated as an ordinary character
+func match(p string, name string) (bool, error) {
+	return path.Match(strings.Replace(p, "/", "\x00", -1), strings.Replace(name, "/", "\x00", -1))
+}
+
+// Diff exports project p from both servers and returns their differences,
+// including differences in the definitions of the VCS roots its buildTypes use
+func (c *Config) Diff(p string) (*Report, error) {
+	if c.Source == nil || c.Target == nil {
+		return nil, errors.New("source and target clients required")
+	}
+	ss, err := (&projectspec.Config{Client: c.Source}).Export(p)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := (&projectspec.Config{Client: c.Target}).Export(p)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	rootIDs(&ss.Project, ids)
+	rootIDs(&ts.Project, ids)
+	sr, err := roots(c.Source, ids)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := roots(c.Target, ids)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Project:     p,
+		Source:      c.Source.Host,
+		Target:      c.Target.Host,
+		Differences: append(Compare(ss, ts, c.Ignore), CompareRoots(sr, tr, c.Ignore)...),
+	}
+	return r, nil
+}
+
+// rootIDs adds the IDs of the VCS roots attached in project p and its subprojects to ids
+func rootIDs(p *projectspec.ProjectSpec, ids map[string]bool) {
+	for _, t := range p.BuildTypes {
+		for _, r := range t.VCSRoots {
+			ids[r.ID] = true
+		}
+	}
+	for i := range p.Projects {
+		rootIDs(&p.Projects[i], ids)
+	}
+}
+
+// roots returns the VCS roots ids that exist on the server of client c, sorted by ID
+func roots(c *teamcity.Client, ids map[string]bool) ([]vcs.Root, error) {
+	var ns []string
+	for id := range ids {
+		ns = append(ns, id)
+	}
+	sort.Strings(ns)
+	vc := &vcs.Config{Client: c}
+	var rs []vcs.Root
+	for _, id := range ns {
+		r, err := vc.GetRoot(id)
+		if teamcity.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		rs = append(rs, *r)
+	}
+	return rs, nil
+}
+
+// Compare returns the differences between specs a and b not ignored by rules rs
+func Compare(a *projectspec.Spec, b *projectspec.Spec, rs []Rule) []Difference {
+	d := &differ{}
+	d.project(&a.Project, &b.Project)
+	return d.filter(rs)
+}
+
+// CompareRoots returns the differences between the VCS root definitions a
+// and b not ignored by rules rs. Roots are matched by ID. Secure properties,
+// such as passwords, are not compared because TeamCity does not return them.
+func CompareRoots(a []vcs.Root, b []vcs.Root, rs []Rule) []Difference {
+	d := &differ{}
+	br := make(map[string]*vcs.Root)
+	for i := range b {
+		br[b[i].ID] = &b[i]
+	}
+	for i := range a {
+		r := &a[i]
+		o, ok := br[r.ID]
+		if !ok {
+			d.only(OnlySource, KindVCSRoot, r.ID, r.Name)
+			continue
+		}
+		delete(br, r.ID)
+		d.value(KindField, r.ID+"/name", r.Name, o.Name)
+		d.value(KindField, r.ID+"/vcsName", r.VcsName, o.VcsName)
+		d.values(KindVCSRootProperty, r.ID, rootProperties(r), rootProperties(o))
+	}
+	for _, r := range b {
+		if _, ok := br[r.ID]; ok {
+			d.only(OnlyTarget, KindVCSRoot, r.ID, r.Name)
+		}
+	}
+	return d.filter(rs)
+}
+
+// rootProperties returns the properties of VCS root r, without secure properties
+func rootProperties(r *vcs.Root) map[string]string {
+	m := make(map[string]string)
+	for _, p := range r.Properties.Property {
+		if !strings.HasPrefix(p.Name, "secure:") {
+			m[p.Name] = p.Value
+		}
+	}
+	return m
+}
+
+// filter returns the collected differences not ignored by rules rs
+func (d *differ) filter(rs []Rule) []Difference {
+	ds := []Difference{}
+	for _, df := range d.ds {
+		ignored := false
+		for _, r := range rs {
+			if r.Matches(df) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			ds = append(ds, df)
+		}
+	}
+	return ds
+}
+
+// differ collects differences
+type differ struct {
+	ds []Difference
+}
+
+// value records a difference for a value present on both sides
+func (d *differ) value(k string, p string, a string, b string) {
+	if a != b {
+		d.ds = append(d.ds, Difference{State: Changed, Kind: k, Path: p, Source: a, Target: b})
+	}
+}
+
+// only records a difference for an item present on one side
+func (d *differ) only(st string, k string, p string, v string) {
+	df := Difference{State: st, Kind: k, Path: p}
+	if st == OnlySource {
+		df.Source = v
+	} else {
+		df.Target = v
+	}
+	d.ds = append(d.ds, df)
+}
+
+// project compares projects a and b
+func (d *differ) project(a *projectspec.ProjectSpec, b *projectspec.ProjectSpec) {
+	p := a.ID
+	d.value(KindField, p+"/name", a.Name, b.Name)
+	d.value(KindField, p+"/description", a.Description, b.Description)
+	d.values(KindParameter, p, a.Parameters, b.Parameters)
+	bt := make(map[string]*projectspec.TypeSpec)
+	for i := range b.BuildTypes {
+		bt[b.BuildTypes[i].ID] = &b.BuildTypes[i]
+	}
+	for i := range a.BuildTypes {
+		t := &a.BuildTypes[i]
+		if o, ok := bt[t.ID]; ok {
+			d.buildType(t, o)
+			delete(bt, t.ID)
+		} else {
+			d.only(OnlySource, KindBuildType, t.ID, t.Name)
+		}
+	}
+	for _, t := range b.BuildTypes {
+		if _, ok := bt[t.ID]; ok {
+			d.only(OnlyTarget, KindBuildType, t.ID, t.Name)
+		}
+	}
+	bp := make(map[string]*projectspec.ProjectSpec)
+	for i := range b.Projects {
+		bp[b.Projects[i].ID] = &b.Projects[i]
+	}
+	for i := range a.Projects {
+		cp := &a.Projects[i]
+		if o, ok := bp[cp.ID]; ok {
+			d.project(cp, o)
+			delete(bp, cp.ID)
+		} else {
+			d.only(OnlySource, KindProject, cp.ID, cp.Name)
+		}
+	}
+	for _, cp := range b.Projects {
+		if _, ok := bp[cp.ID]; ok {
+			d.only(OnlyTarget, KindProject, cp.ID, cp.Name)
+		}
+	}
+}
+
+// buildType compares buildTypes a and b
+func (d *differ) buildType(a *projectspec.TypeSpec, b *projectspec.TypeSpec) {
+	id := a.ID
+	d.value(KindField, id+"/name", a.Name, b.Name)
+	d.value(KindField, id+"/description", a.Description, b.Description)
+	d.value(KindPaused, id, strconv.FormatBool(a.Paused), strconv.FormatBool(b.Paused))
+	d.values(KindTemplate, id, set(a.Templates), set(b.Templates))
+	d.values(KindParameter, id, a.Parameters, b.Parameters)
+	ar := make(map[string]string)
+	for _, r := range a.VCSRoots {
+		ar[r.ID] = r.CheckoutRules
+	}
+	br := make(map[string]string)
+	for _, r := range b.VCSRoots {
+		br[r.ID] = r.CheckoutRules
+	}
+	d.values(KindVCSRoot, id, ar, br)
+	d.values(KindTrigger, id, settings(a.Triggers), settings(b.Triggers))
+	d.values(KindSnapshotDependency, id, settings(a.SnapshotDependencies), settings(b.SnapshotDependencies))
+	d.values(KindArtifactDependency, id, settings(a.ArtifactDependencies), settings(b.ArtifactDependencies))
+}
+
+// values compares the named values of kind k owned by o
+func (d *differ) values(k string, o string, a map[string]string, b map[string]string) {
+	var ns []string
+	for n := range a {
+		ns = append(ns, n)
+	}
+	for n := range b {
+		if _, ok := a[n]; !ok {
+			ns = append(ns, n)
+		}
+	}
+	sort.Strings(ns)
+	for _, n := range ns {
+		av, aok := a[n]
+		bv, bok := b[n]
+		switch {
+		case !bok:
+			d.only(OnlySource, k, o+"/"+n, av)
+		case !aok:
+			d.only(OnlyTarget, k, o+"/"+n, bv)
+		default:
+			d.value(k, o+"/"+n, av, bv)
+		}
+	}
+}
+
+// set converts a list to a map of its items with empty values
+func set(l []string) map[string]string {
+	m := make(map[string]string)
+	for _, v := range l {
+		m[v] = ""
+	}
+	return m
+}
+
+// settings converts settings to a map of ID to a one line description
+func settings(ss []projectspec.SettingSpec) map[string]string {
+	m := make(map[string]string)
+	for _, s := range ss {
+		v := s.Type
+		if s.SourceBuildType != "" {
+			v += " from " + s.SourceBuildType
+		}
+		if s.Disabled {
+			v += " (disabled)"
+		}
+		var ns []string
+		for n := range s.Properties {
+			ns = append(ns, n)
+		}
+		sort.Strings(ns)
+		for _, n := range ns {
+			v += " " + n + "=" + s.Properties[n]
+		}
+		m[s.ID] = v
+	}
+	return m
+}
+
+// Text returns a human readable description of the report
+func (r *Report) Text() string {
+	var b bytes.Buffer
+	b.WriteString("project " + r.Project + ": " + r.Source + " -> " + r.Target + ", ")
+	b.WriteString(strconv.Itoa(len(r.Differences)) + " difference")
+	if len(r.Differences) != 1 {
+		b.WriteString("s")
+	}
+	b.WriteString("\n")
+	for _, d := range r.Differences {
+		b.WriteString(d.String() + "\n")
+	}
+	return b.String()
+}
+
+// JSON returns the JSON encoding of the report
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// String returns a one line description of the difference
+func (d Difference) String() string {
+	switch d.State {
+	case OnlySource:
+		return "- " + d.Kind + " " + d.Path + describe(d.Source) + " (only in source)"
+	case OnlyTarget:
+		return "+ " + d.Kind + " " + d.Path + describe(d.Target) + " (only in target)"
+	}
+	return "~ " + d.Kind + " " + d.Path + ": " + strconv.Quote(d.Source) + " -> " + strconv.Quote(d.Target)
+}
+
+// describe returns value v quoted for display, or nothing if it is empty
+func describe(v string) string {
+	if v == "" {
+		return ""
+	}
+	return " " + strconv.Quote(v)
+}
@@ -0,0 +1,131 @@
+package drift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/projectspec"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/vcs"
+)
+
+// newServer returns a server with project Payments and buildType Payments_Build
+// using parameter value v and paused state pd, checking out VCS root Payments_Git on branch br
+func newServer(v string, pd string, br string) *httptest.Server {
+	routes := map[string]string{
+		"/httpAuth/app/rest/projects":                                      `{"project":[{"id":"Payments","name":"Payments","parentProjectId":"_Root"}]}`,
+		"/httpAuth/app/rest/buildTypes":                                    `{"buildType":[{"id":"Payments_Build","name":"Build","projectId":"Payments","paused":` + pd + `}]}`,
+		"/httpAuth/app/rest/projects/id:Payments":                          `{"id":"Payments","name":"Payments","parentProjectId":"_Root"}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/templates":        `{}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/parameters":       `{"property":[{"name":"env.GOOS","value":"` + v + `"}]}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/vcs-root-entries": `{"vcs-root-entry":[{"id":"Payments_Git","vcs-root":{"id":"Payments_Git"}}]}`,
+		"/httpAuth/app/rest/vcs-roots/id:Payments_Git": `{"id":"Payments_Git","name":"Payments","vcsName":"jetbrains.git","properties":{"property":[` +
+			`{"name":"url","value":"git@git.example.com:team/payments.git"},{"name":"branch","value":"` + br + `"},{"name":"secure:password"}]}}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/triggers":              `{}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/snapshot-dependencies": `{}`,
+		"/httpAuth/app/rest/buildTypes/id:Payments_Build/artifact-dependencies": `{}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rd, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rd))
+	}))
+}
+
+// TestDiff tests the report for two servers whose buildType differs
+func TestDiff(t *testing.T) {
+	uat := newServer("linux", "false", "refs/heads/main")
+	defer uat.Close()
+	prod := newServer("darwin", "true", "refs/heads/main")
+	defer prod.Close()
+	c := &Config{Source: teamcity.New(uat.URL, "", ""), Target: teamcity.New(prod.URL, "", "")}
+	r, err := c.Diff("Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "project Payments: " + uat.URL + " -> " + prod.URL + ", 2 differences\n" +
+		"~ paused Payments_Build: \"false\" -> \"true\"\n" +
+		"~ parameter Payments_Build/env.GOOS: \"linux\" -> \"darwin\"\n"
+	if r.Text() != want {
+		t.Errorf("text report:\n%s\nwant:\n%s", r.Text(), want)
+	}
+	jd, err := r.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr := &Report{}
+	if err := json.Unmarshal(jd, jr); err != nil {
+		t.Fatal(err)
+	}
+	if len(jr.Differences) != 2 || jr.Differences[1].Source != "linux" || jr.Differences[1].Target != "darwin" {
+		t.Errorf("unexpected JSON report: %s", jd)
+	}
+}
+
+// TestDiffVCSRoots tests that differences in VCS root definitions are reported
+func TestDiffVCSRoots(t *testing.T) {
+	uat := newServer("linux", "false", "refs/heads/main")
+	defer uat.Close()
+	prod := newServer("linux", "false", "refs/heads/release")
+	defer prod.Close()
+	c := &Config{Source: teamcity.New(uat.URL, "", ""), Target: teamcity.New(prod.URL, "", "")}
+	r, err := c.Diff("Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Differences) != 1 || r.Differences[0].String() != `~ vcsRootProperty Payments_Git/branch: "refs/heads/main" -> "refs/heads/release"` {
+		t.Errorf("differences = %v", r.Differences)
+	}
+	c.Ignore = []Rule{{Kind: KindVCSRootProperty, Pattern: "*/branch"}}
+	if r, err = c.Diff("Payments"); err != nil || len(r.Differences) != 0 {
+		t.Errorf("ignored differences = %v, %v", r, err)
+	}
+	ds := CompareRoots([]vcs.Root{{ID: "Payments_Git", Name: "Payments"}}, nil, nil)
+	if len(ds) != 1 || ds[0].String() != `- vcsRoot Payments_Git "Payments" (only in source)` {
+		t.Errorf("missing root differences = %v", ds)
+	}
+}
+
+// TestCompareIgnoreRules tests that ignore rules drop matching differences
+func TestCompareIgnoreRules(t *testing.T) {
+	a := &projectspec.Spec{Project: projectspec.ProjectSpec{ID: "Payments", Name: "Payments",
+		Parameters: map[string]string{"env.SERVER_URL": "https://uat", "env.TEAM": "payments"},
+		BuildTypes: []projectspec.TypeSpec{{ID: "Payments_Build", Name: "Build"}, {ID: "Payments_Scratch", Name: "Scratch"}},
+		Projects: []projectspec.ProjectSpec{{ID: "Payments_Legacy", Name: "Legacy",
+			BuildTypes: []projectspec.TypeSpec{{ID: "Payments_Legacy_Build", Name: "Build", Parameters: map[string]string{"env.JDK": "8"}}}}}}}
+	b := &projectspec.Spec{Project: projectspec.ProjectSpec{ID: "Payments", Name: "Payments",
+		Parameters: map[string]string{"env.SERVER_URL": "https://prod"},
+		BuildTypes: []projectspec.TypeSpec{{ID: "Payments_Build", Name: "Build",
+			Triggers: []projectspec.SettingSpec{{ID: "TRIGGER_1", Type: "vcsTrigger", Properties: map[string]string{"branchFilter": "+:*"}}}}},
+		Projects: []projectspec.ProjectSpec{{ID: "Payments_Legacy", Name: "Legacy",
+			BuildTypes: []projectspec.TypeSpec{{ID: "Payments_Legacy_Build", Name: "Build", Parameters: map[string]string{"env.JDK": "11"}}}}}}}
+	var rs []Rule
+	for _, s := range []string{"parameter:*/env.SERVER_URL", "*_Scratch", "Payments_Legacy*"} {
+		r, err := ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	ds := Compare(a, b, rs)
+	want := []string{
+		`- parameter Payments/env.TEAM "payments" (only in source)`,
+		`+ trigger Payments_Build/TRIGGER_1 "vcsTrigger branchFilter=+:*" (only in target)`,
+	}
+	if len(ds) != len(want) {
+		t.Fatalf("differences = %v, want %v", ds, want)
+	}
+	for i := range want {
+		if ds[i].String() != want[i] {
+			t.Errorf("difference[%d] = %s, want %s", i, ds[i], want[i])
+		}
+	}
+	if _, err := ParseRule("parameter:[bad"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,285 @@
+package exporter
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/agent"
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// DefaultWaitBuckets are the default queue wait histogram buckets in seconds
+var DefaultWaitBuckets = []float64{10, 30, 60, 300, 600, 1800, 3600, 7200}
+
+// DefaultDurationBuckets are the default build duration histogram buckets in seconds
+var DefaultDurationBuckets = []float64{30, 60, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+// finishedOverlap is how far back each poll for finished builds reaches
+// before the newest finish time already seen
+const finishedOverlap = time.Minute
+
+// finishedLimit is the maximum number of finished builds fetched per poll
+const finishedLimit = 1000
+
+// now returns the current time, overridden by tests
+var now = time.Now
+
+// Config contains config data. A Config is an http.Handler serving /metrics.
+type Config struct {
+	Client *teamcity.Client
+	// CacheTTL is how long a collection is served to scrapes before
+	// TeamCity is polled again. Zero polls on every scrape.
+	CacheTTL time.Duration
+	// WaitBuckets are the queue wait histogram buckets in seconds
+	WaitBuckets []float64
+	// DurationBuckets are the build duration histogram buckets in seconds
+	DurationBuckets []float64
+
+	mu       sync.Mutex
+	cached   []byte
+	cachedAt time.Time
+	// since is the newest finish time seen, seen the IDs of recently finished builds
+	since     time.Time
+	seen      map[int]time.Time
+	waits     map[string]*histogram
+	durations map[string]*histogram
+	finished  map[string]map[string]float64
+}
+
+// ServeHTTP serves the metrics
+func (c *Config) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bd, _ := c.Collect()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(bd)
+}
+
+// Collect polls TeamCity, unless the cached collection is still fresh, and
+// returns the metrics. If polling fails teamcity_up is 0 and the error is returned.
+func (c *Config) Collect() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := now()
+	if c.cached != nil && c.CacheTTL > 0 && st.Sub(c.cachedAt) < c.CacheTTL {
+		return c.cached, nil
+	}
+	w := &writer{}
+	err := c.collect(w, st)
+	up := 1.0
+	if err != nil {
+		up = 0
+		w = &writer{}
+		c.writeFinished(w)
+	}
+	w.header("teamcity_up", "gauge", "Whether the last poll of TeamCity succeeded.")
+	w.sample("teamcity_up", up)
+	w.header("teamcity_scrape_duration_seconds", "gauge", "Time taken to poll TeamCity.")
+	w.sample("teamcity_scrape_duration_seconds", now().Sub(st).Seconds())
+	if err != nil {
+		return w.b.Bytes(), err
+	}
+	c.cached = w.b.Bytes()
+	c.cachedAt = st
+	return c.cached, nil
+}
+
+// collect polls TeamCity and writes all metrics to w
+func (c *Config) collect(w *writer, st time.Time) error {
+	bc := &build.Config{Client: c.Client}
+	ts, err := bc.Types()
+	if err != nil {
+		return err
+	}
+	projects := make(map[string]string)
+	for _, t := range ts {
+		projects[t.ID] = t.ProjectID
+	}
+	project := func(b build.Build) string {
+		if p, ok := projects[b.BuildTypeID]; ok {
+			return p
+		}
+		return "unknown"
+	}
+	qbs, err := (&queue.Config{Client: c.Client}).ActiveQueue()
+	if err != nil {
+		return err
+	}
+	rbs, err := bc.RunningBuilds()
+	if err != nil {
+		return err
+	}
+	as, err := (&agent.Config{Client: c.Client}).Agents()
+	if err != nil {
+		return err
+	}
+	if err := c.pollFinished(bc, st, project); err != nil {
+		return err
+	}
+
+	queued := make(map[string]float64)
+	oldest := make(map[string]float64)
+	for _, b := range qbs {
+		p := project(b)
+		queued[p]++
+		if qt, err := build.ParseTime(b.QueuedDate); err == nil {
+			if wt := st.Sub(qt).Seconds(); wt > oldest[p] {
+				oldest[p] = wt
+			}
+		}
+	}
+	w.header("teamcity_queue_length", "gauge", "Number of queued builds by project.")
+	for _, p := range sortedKeys(queued) {
+		w.sample("teamcity_queue_length", queued[p], "project", p)
+	}
+	w.header("teamcity_queue_oldest_wait_seconds", "gauge", "Time the longest waiting queued build has been queued, by project.")
+	for _, p := range sortedKeys(oldest) {
+		w.sample("teamcity_queue_oldest_wait_seconds", oldest[p], "project", p)
+	}
+
+	running := make(map[string]float64)
+	for _, b := range rbs {
+		running[project(b)]++
+	}
+	w.header("teamcity_running_builds", "gauge", "Number of running builds by project.")
+	for _, p := range sortedKeys(running) {
+		w.sample("teamcity_running_builds", running[p], "project", p)
+	}
+
+	agents := make(map[string]map[string]float64)
+	for _, a := range as {
+		if agents[a.Pool.Name] == nil {
+			agents[a.Pool.Name] = make(map[string]float64)
+		}
+		agents[a.Pool.Name][agentState(a)]++
+	}
+	w.header("teamcity_agents", "gauge", "Number of agents by pool and state.")
+	for _, pl := range sortedKeys(agents) {
+		for _, s := range sortedKeys(agents[pl]) {
+			w.sample("teamcity_agents", agents[pl][s], "pool", pl, "state", s)
+		}
+	}
+	c.writeFinished(w)
+	return nil
+}
+
+// pollFinished records the builds finished since the last poll. The first
+// poll only marks the builds it finds as seen so history is not replayed.
+func (c *Config) pollFinished(bc *build.Config, st time.Time, project func(build.Build) string) error {
+	seed := c.seen == nil
+	if seed {
+		c.since = st
+		c.seen = make(map[int]time.Time)
+		c.waits = make(map[string]*histogram)
+		c.durations = make(map[string]*histogram)
+		c.finished = make(map[string]map[string]float64)
+	}
+	bs, err := bc.FinishedBuildsSince(c.since.Add(-finishedOverlap), finishedLimit)
+	if err != nil {
+		return err
+	}
+	for _, b := range bs {
+		if _, ok := c.seen[b.ID]; ok {
+			continue
+		}
+		ft, err := build.ParseTime(b.FinishDate)
+		if err != nil {
+			continue
+		}
+		c.seen[b.ID] = ft
+		if ft.After(c.since) {
+			c.since = ft
+		}
+		if seed {
+			continue
+		}
+		p := project(b)
+		if c.finished[p] == nil {
+			c.finished[p] = make(map[string]float64)
+		}
+		c.finished[p][strings.ToLower(b.Status)]++
+		qt, qerr := build.ParseTime(b.QueuedDate)
+		bt, berr := build.ParseTime(b.StartDate)
+		if berr != nil {
+			continue
+		}
+		if qerr == nil {
+			c.histogram(c.waits, p, c.WaitBuckets, DefaultWaitBuckets).observe(bt.Sub(qt).Seconds())
+		}
+		c.histogram(c.durations, p, c.DurationBuckets, DefaultDurationBuckets).observe(ft.Sub(bt).Seconds())
+	}
+	for id, ft := range c.seen {
+		if ft.Before(c.since.Add(-finishedOverlap)) {
+			delete(c.seen, id)
+		}
+	}
+	return nil
+}
+
+// histogram returns the histogram for project p in hs, creating it with buckets bs or d
+func (c *Config) histogram(hs map[string]*histogram, p string, bs []float64, d []float64) *histogram {
+	if hs[p] == nil {
+		if len(bs) == 0 {
+			bs = d
+		}
+		hs[p] = newHistogram(bs)
+	}
+	return hs[p]
+}
+
+// writeFinished writes the metrics accumulated from finished builds
+func (c *Config) writeFinished(w *writer) {
+	w.header("teamcity_builds_finished_total", "counter", "Number of finished builds by project and status.")
+	for _, p := range sortedKeys(c.finished) {
+		for _, s := range sortedKeys(c.finished[p]) {
+			w.sample("teamcity_builds_finished_total", c.finished[p][s], "project", p, "status", s)
+		}
+	}
+	w.header("teamcity_build_queue_wait_seconds", "histogram", "Time finished builds waited in the queue, by project.")
+	for _, p := range sortedKeys(c.waits) {
+		w.histogram("teamcity_build_queue_wait_seconds", c.waits[p], "project", p)
+	}
+	w.header("teamcity_build_duration_seconds", "histogram", "Duration of finished builds by project.")
+	for _, p := range sortedKeys(c.durations) {
+		w.histogram("teamcity_build_duration_seconds", c.durations[p], "project", p)
+	}
+}
+
+// agentState returns the availability state of agent a
+func agentState(a agent.Agent) string {
+	switch {
+	case !a.Authorized:
+		return "unauthorized"
+	case !a.Connected:
+		return "disconnected"
+	case !a.Enabled:
+		return "disabled"
+	case a.Build != nil:
+		return "busy"
+	}
+	return "idle"
+}
+
+// sortedKeys returns the keys of a map with string keys, sorted
+func sortedKeys(m interface{}) []string {
+	var ks []string
+	switch mt := m.(type) {
+	case map[string]float64:
+		for k := range mt {
+			ks = append(ks, k)
+		}
+	case map[string]map[string]float64:
+		for k := range mt {
+			ks = append(ks, k)
+		}
+	case map[string]*histogram:
+		for k := range mt {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+	return ks
+}
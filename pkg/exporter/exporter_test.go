@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestCollect tests the metrics collected over two polls
+func TestCollect(t *testing.T) {
+	defer func() { now = time.Now }()
+	st := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return st }
+	polls := 0
+	finished := []string{
+		`{"build":[{"id":1,"buildTypeId":"Payments_Build","status":"SUCCESS","finishDate":"20240101T115930+0000"}]}`,
+		`{"build":[
+			{"id":3,"buildTypeId":"Payments_Build","status":"FAILURE","queuedDate":"20240101T120000+0000","startDate":"20240101T120100+0000","finishDate":"20240101T121100+0000"},
+			{"id":2,"buildTypeId":"Orders_Build","status":"SUCCESS","queuedDate":"20240101T120000+0000","startDate":"20240101T120020+0000","finishDate":"20240101T120050+0000"},
+			{"id":1,"buildTypeId":"Payments_Build","status":"SUCCESS","finishDate":"20240101T115930+0000"}]}`,
+	}
+	routes := map[string]string{
+		"/httpAuth/app/rest/buildTypes": `{"buildType":[{"id":"Payments_Build","projectId":"Payments"},{"id":"Orders_Build","projectId":"Orders"}]}`,
+		"/httpAuth/app/rest/buildQueue": `{"build":[
+			{"id":10,"buildTypeId":"Payments_Build","queuedDate":"20240101T115500+0000"},
+			{"id":11,"buildTypeId":"Payments_Build","queuedDate":"20240101T115900+0000"}]}`,
+		"/httpAuth/app/rest/agents": `{"agent":[
+			{"id":1,"name":"a1","connected":true,"enabled":true,"authorized":true,"pool":{"name":"Default"},"build":{"id":5}},
+			{"id":2,"name":"a2","connected":true,"enabled":true,"authorized":true,"pool":{"name":"Default"}},
+			{"id":3,"name":"a3","connected":false,"enabled":true,"authorized":true,"pool":{"name":"Default"}}]}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/httpAuth/app/rest/builds" {
+			if strings.Contains(r.URL.Query().Get("locator"), "running:true") {
+				w.Write([]byte(`{"build":[{"id":5,"buildTypeId":"Orders_Build"}]}`))
+				return
+			}
+			w.Write([]byte(finished[polls]))
+			polls++
+			return
+		}
+		rd, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rd))
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), WaitBuckets: []float64{30, 60}, DurationBuckets: []float64{60, 600}}
+	if _, err := c.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	st = st.Add(15 * time.Minute)
+	bd, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(bd)
+	want := []string{
+		`teamcity_up 1`,
+		`teamcity_queue_length{project="Payments"} 2`,
+		`teamcity_queue_oldest_wait_seconds{project="Payments"} 1200`,
+		`teamcity_running_builds{project="Orders"} 1`,
+		`teamcity_agents{pool="Default",state="busy"} 1`,
+		`teamcity_agents{pool="Default",state="disconnected"} 1`,
+		`teamcity_agents{pool="Default",state="idle"} 1`,
+		`teamcity_builds_finished_total{project="Orders",status="success"} 1`,
+		`teamcity_builds_finished_total{project="Payments",status="failure"} 1`,
+		`teamcity_build_queue_wait_seconds_bucket{project="Orders",le="30"} 1`,
+		`teamcity_build_queue_wait_seconds_bucket{project="Payments",le="60"} 1`,
+		`teamcity_build_duration_seconds_bucket{project="Payments",le="60"} 0`,
+		`teamcity_build_duration_seconds_bucket{project="Payments",le="600"} 1`,
+		`teamcity_build_duration_seconds_bucket{project="Payments",le="+Inf"} 1`,
+		`teamcity_build_duration_seconds_sum{project="Payments"} 600`,
+		"# TYPE teamcity_build_duration_seconds histogram",
+	}
+	for _, l := range want {
+		if !strings.Contains(out, l+"\n") {
+			t.Errorf("missing %q in:\n%s", l, out)
+		}
+	}
+	if strings.Contains(out, `status="success"} 2`) || strings.Contains(out, `project="Payments",status="success"`) {
+		t.Errorf("build finished before the first poll was counted:\n%s", out)
+	}
+}
+
+// TestCollectCache tests that scrapes within CacheTTL do not poll TeamCity
+func TestCollectCache(t *testing.T) {
+	defer func() { now = time.Now }()
+	st := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return st }
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), CacheTTL: time.Minute}
+	c.Collect()
+	n := requests
+	st = st.Add(30 * time.Second)
+	c.Collect()
+	if requests != n {
+		t.Errorf("scrape within CacheTTL polled TeamCity")
+	}
+	st = st.Add(time.Minute)
+	c.Collect()
+	if requests == n {
+		t.Errorf("scrape after CacheTTL did not poll TeamCity")
+	}
+}
+
+// TestCollectDown tests that a failed poll reports teamcity_up 0
+func TestCollectDown(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	bd, err := c.Collect()
+	if err == nil {
+		t.Error("expected error")
+	}
+	if !strings.Contains(string(bd), "teamcity_up 0\n") {
+		t.Errorf("missing teamcity_up 0 in:\n%s", bd)
+	}
+}
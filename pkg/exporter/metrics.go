@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// histogram is a cumulative histogram with fixed upper bounds
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram returns an empty histogram with upper bounds bs
+func newHistogram(bs []float64) *histogram {
+	return &histogram{bounds: bs, counts: make([]uint64, len(bs))}
+}
+
+// observe adds value v to the histogram
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// writer writes metrics in the Prometheus text exposition format
+type writer struct {
+	b bytes.Buffer
+}
+
+// header writes the HELP and TYPE lines of metric n
+func (w *writer) header(n string, t string, h string) {
+	w.b.WriteString("# HELP " + n + " " + h + "\n")
+	w.b.WriteString("# TYPE " + n + " " + t + "\n")
+}
+
+// sample writes a sample of metric n with value v and label pairs ls
+func (w *writer) sample(n string, v float64, ls ...string) {
+	w.b.WriteString(n)
+	if len(ls) > 0 {
+		w.b.WriteString("{")
+		for i := 0; i+1 < len(ls); i += 2 {
+			if i > 0 {
+				w.b.WriteString(",")
+			}
+			w.b.WriteString(ls[i] + `="` + escapeLabel(ls[i+1]) + `"`)
+		}
+		w.b.WriteString("}")
+	}
+	w.b.WriteString(" " + formatValue(v) + "\n")
+}
+
+// histogram writes the buckets, sum and count of histogram h for metric n
+func (w *writer) histogram(n string, h *histogram, ls ...string) {
+	for i, b := range h.bounds {
+		w.sample(n+"_bucket", float64(h.counts[i]), append(ls[:len(ls):len(ls)], "le", formatValue(b))...)
+	}
+	w.sample(n+"_bucket", float64(h.count), append(ls[:len(ls):len(ls)], "le", "+Inf")...)
+	w.sample(n+"_sum", h.sum, ls...)
+	w.sample(n+"_count", float64(h.count), ls...)
+}
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes label value v
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,298 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// SnapshotVersion is the current maintenance snapshot format version
+const SnapshotVersion = 1
+
+// Freeze and thaw steps, recorded in the journal as they complete
+const (
+	StepSnapshot        = "snapshot"
+	StepDisableTriggers = "disableTriggers"
+	StepPauseTypes      = "pauseTypes"
+	StepQueue           = "queue"
+	StepWaitRunning     = "waitRunning"
+	StepResumeTypes     = "resumeTypes"
+	StepRestoreTriggers = "restoreTriggers"
+)
+
+// Config contains config data
+type Config struct {
+	Client *teamcity.Client
+	// Journal is the file freeze progress is written to after every step
+	Journal string
+	// CancelQueue cancels queued builds in scope instead of waiting for them to start
+	CancelQueue  bool
+	CancelReason string
+	// Timeout applies to each of the queue drain and running build waits
+	Timeout time.Duration
+}
+
+// Scope selects the buildTypes a freeze applies to
+type Scope struct {
+	// Project limits the freeze to a project, empty freezes the whole server
+	Project string `json:"project"`
+}
+
+// Snapshot contains everything required to thaw a freeze
+type Snapshot struct {
+	Version   int                    `json:"version"`
+	Server    string                 `json:"server"`
+	Scope     Scope                  `json:"scope"`
+	Started   time.Time              `json:"started"`
+	Triggers  *build.TriggerSnapshot `json:"triggers"`
+	Paused    map[string]bool        `json:"paused"`
+	Completed []string               `json:"completed"`
+}
+
+// Done checks if step st has completed
+func (s *Snapshot) Done(st string) bool {
+	for _, c := range s.Completed {
+		if c == st {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseJournal parses a maintenance snapshot from journal file f
+func ParseJournal(f string) (*Snapshot, error) {
+	bd, rerr := ioutil.ReadFile(f)
+	if rerr != nil {
+		return nil, rerr
+	}
+	s := &Snapshot{}
+	jerr := json.Unmarshal(bd, s)
+	if jerr != nil {
+		return nil, jerr
+	}
+	if s.Version != SnapshotVersion {
+		return nil, errors.New("unsupported maintenance journal version")
+	}
+	return s, nil
+}
+
+// writeJournal atomically writes snapshot s to the journal file
+func (c *Config) writeJournal(s *Snapshot) error {
+	if c.Journal == "" {
+		return nil
+	}
+	jd, jerr := json.MarshalIndent(s, "", "  ")
+	if jerr != nil {
+		return jerr
+	}
+	tf := c.Journal + ".tmp"
+	werr := ioutil.WriteFile(tf, jd, 0600)
+	if werr != nil {
+		return werr
+	}
+	return os.Rename(tf, c.Journal)
+}
+
+// complete marks step st as completed and writes the journal
+func (c *Config) complete(s *Snapshot, st string) error {
+	s.Completed = append(s.Completed, st)
+	return c.writeJournal(s)
+}
+
+// scopeTypes returns the buildTypes in scope sc. Every step of a freeze
+// works on these buildTypes, which are recorded in the snapshot.
+func (c *Config) scopeTypes(sc Scope) ([]build.Type, error) {
+	bc := &build.Config{Client: c.Client}
+	if sc.Project == "" {
+		return bc.Types()
+	}
+	return bc.TypesForProjectTree(sc.Project)
+}
+
+// inScope checks if build b is of a buildType in snapshot s
+func inScope(s *Snapshot, b build.Build) bool {
+	_, ok := s.Paused[b.BuildTypeID]
+	return ok
+}
+
+// Freeze snapshots triggers and paused state for scope sc, disables triggers,
+// pauses buildTypes, drains or cancels the queue and waits for running builds.
+// If the journal file exists, the freeze resumes after the last completed step.
+func (c *Config) Freeze(sc Scope) (*Snapshot, error) {
+	var s *Snapshot
+	if c.Journal != "" {
+		if _, err := os.Stat(c.Journal); err == nil {
+			js, jerr := ParseJournal(c.Journal)
+			if jerr != nil {
+				return nil, jerr
+			}
+			if js.Scope != sc || !teamcity.SameHost(js.Server, c.Client.Host) {
+				return nil, errors.New("journal " + c.Journal + " belongs to a different freeze")
+			}
+			if js.Done(StepResumeTypes) || js.Done(StepRestoreTriggers) {
+				return nil, errors.New("journal " + c.Journal + " has a thaw in progress")
+			}
+			s = js
+		}
+	}
+	if s == nil {
+		s = &Snapshot{
+			Version: SnapshotVersion,
+			Server:  c.Client.Host,
+			Scope:   sc,
+			Started: time.Now().UTC(),
+		}
+	}
+	bc := &build.Config{Client: c.Client}
+	if !s.Done(StepSnapshot) {
+		ts, err := c.scopeTypes(sc)
+		if err != nil {
+			return s, err
+		}
+		tss, err := bc.TypesTriggerSnapshot(sc.Project, ts)
+		if err != nil {
+			return s, err
+		}
+		s.Triggers = tss
+		s.Paused = make(map[string]bool)
+		for _, t := range ts {
+			s.Paused[t.ID] = t.Paused
+		}
+		if err := c.complete(s, StepSnapshot); err != nil {
+			return s, err
+		}
+	}
+	if !s.Done(StepDisableTriggers) {
+		if err := c.disableTriggers(s); err != nil {
+			return s, err
+		}
+		if err := c.complete(s, StepDisableTriggers); err != nil {
+			return s, err
+		}
+	}
+	if !s.Done(StepPauseTypes) {
+		var erstrs []string
+		for id, p := range s.Paused {
+			if p {
+				continue
+			}
+			if err := bc.PauseType(id); err != nil && !teamcity.IsNotFound(err) {
+				erstrs = append(erstrs, err.Error())
+			}
+		}
+		if len(erstrs) > 0 {
+			return s, errors.New(strings.Join(erstrs, "; "))
+		}
+		if err := c.complete(s, StepPauseTypes); err != nil {
+			return s, err
+		}
+	}
+	if !s.Done(StepQueue) {
+		var err error
+		if c.CancelQueue {
+			err = c.cancelQueue(s)
+		} else {
+			err = c.drainQueue(s)
+		}
+		if err != nil {
+			return s, err
+		}
+		if err := c.complete(s, StepQueue); err != nil {
+			return s, err
+		}
+	}
+	if !s.Done(StepWaitRunning) {
+		err := bc.WaitForBuilds(func(b build.Build) bool { return inScope(s, b) }, c.Timeout)
+		if err != nil {
+			return s, err
+		}
+		if err := c.complete(s, StepWaitRunning); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// disableTriggers disables every enabled trigger in snapshot s
+func (c *Config) disableTriggers(s *Snapshot) error {
+	return (&build.Config{Client: c.Client}).DisableSnapshotTriggers(s.Triggers)
+}
+
+// scopeFilter returns a queue filter for buildTypes in snapshot s
+func scopeFilter(s *Snapshot) *queue.QueueFilter {
+	return &queue.QueueFilter{
+		Project: s.Scope.Project,
+		Match: func(b build.Build) bool {
+			return inScope(s, b)
+		},
+	}
+}
+
+// cancelQueue cancels all queued builds in scope
+func (c *Config) cancelQueue(s *Snapshot) error {
+	qc := &queue.Config{Client: c.Client, CancelReason: c.CancelReason}
+	_, err := qc.ClearQueueFiltered(scopeFilter(s))
+	return err
+}
+
+// drainQueue waits for all queued builds in scope to leave the queue
+func (c *Config) drainQueue(s *Snapshot) error {
+	qc := &queue.Config{Client: c.Client}
+	return build.WaitUntil(func() (bool, error) {
+		bs, err := qc.ActiveQueueFiltered(scopeFilter(s))
+		if err != nil {
+			return false, err
+		}
+		return len(bs) == 0, nil
+	}, c.Timeout)
+}
+
+// Thaw resumes buildTypes paused by the freeze and restores triggers from snapshot s.
+// On success the journal file is removed.
+func (c *Config) Thaw(s *Snapshot) ([]build.TriggerDrift, error) {
+	if !teamcity.SameHost(s.Server, c.Client.Host) {
+		return nil, errors.New("snapshot was taken on " + s.Server + ", not " + c.Client.Host)
+	}
+	bc := &build.Config{Client: c.Client}
+	if !s.Done(StepResumeTypes) && s.Done(StepSnapshot) {
+		var erstrs []string
+		for id, p := range s.Paused {
+			if p {
+				continue
+			}
+			if err := bc.ResumeType(id); err != nil && !teamcity.IsNotFound(err) {
+				erstrs = append(erstrs, err.Error())
+			}
+		}
+		if len(erstrs) > 0 {
+			return nil, errors.New(strings.Join(erstrs, "; "))
+		}
+		if err := c.complete(s, StepResumeTypes); err != nil {
+			return nil, err
+		}
+	}
+	var ds []build.TriggerDrift
+	if !s.Done(StepRestoreTriggers) && s.Triggers != nil {
+		var err error
+		ds, err = bc.RestoreTriggerSnapshot(s.Triggers)
+		if err != nil {
+			return ds, err
+		}
+		if err := c.complete(s, StepRestoreTriggers); err != nil {
+			return ds, err
+		}
+	}
+	if c.Journal != "" {
+		if err := os.Remove(c.Journal); err != nil && !os.IsNotExist(err) {
+			return ds, err
+		}
+	}
+	return ds, nil
+}
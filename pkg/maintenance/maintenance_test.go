@@ -0,0 +1,182 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/teamcitytest"
+)
+
+// stubServer is a minimal stateful TeamCity stand-in for freeze and thaw
+type stubServer struct {
+	mu       sync.Mutex
+	paused   map[string]bool
+	triggers map[string][]build.Trigger
+	fail     string
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := strings.TrimPrefix(r.URL.Path, "/httpAuth/app/rest")
+	if s.fail != "" && strings.HasSuffix(p, s.fail) && r.Method == "PUT" {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case p == "/buildTypes":
+		var ts []build.Type
+		for _, id := range []string{"bt1", "bt2"} {
+			ts = append(ts, build.Type{ID: id, Paused: s.paused[id]})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"buildType": ts})
+	case p == "/buildQueue" || p == "/builds":
+		w.Write([]byte(`{"count":0}`))
+	case strings.HasSuffix(p, "/triggers"):
+		id := strings.TrimSuffix(strings.TrimPrefix(p, "/buildTypes/id:"), "/triggers")
+		json.NewEncoder(w).Encode(map[string]interface{}{"trigger": s.triggers[id]})
+	case strings.HasSuffix(p, "/paused"):
+		id := strings.TrimSuffix(strings.TrimPrefix(p, "/buildTypes/id:"), "/paused")
+		bd, _ := ioutil.ReadAll(r.Body)
+		s.paused[id] = string(bd) == "true"
+	case strings.HasSuffix(p, "/disabled"):
+		ps := strings.Split(strings.TrimPrefix(p, "/buildTypes/id:"), "/")
+		bd, _ := ioutil.ReadAll(r.Body)
+		for i, t := range s.triggers[ps[0]] {
+			if t.ID == ps[2] {
+				s.triggers[ps[0]][i].Disabled = string(bd) == "true"
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// TestFreezeThaw tests a freeze interrupted mid-way, resumed from the journal and thawed
+func TestFreezeThaw(t *testing.T) {
+	ss := &stubServer{
+		paused: map[string]bool{"bt2": true},
+		triggers: map[string][]build.Trigger{
+			"bt1": {{ID: "t1"}, {ID: "t2", Disabled: true}},
+			"bt2": {{ID: "t3"}},
+		},
+		fail: "bt1/paused",
+	}
+	ts := httptest.NewServer(ss)
+	defer ts.Close()
+	f := "/tmp/go-teamcity-test-maintenance-journal.json"
+	os.Remove(f)
+	defer os.Remove(f)
+	c := &Config{
+		Client:  teamcity.New(ts.URL, "", ""),
+		Journal: f,
+		Timeout: time.Second * 5,
+	}
+	if _, err := c.Freeze(Scope{}); err == nil {
+		t.Fatal("expected freeze to fail on injected error")
+	}
+	js, err := ParseJournal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !js.Done(StepDisableTriggers) || js.Done(StepPauseTypes) {
+		t.Fatalf("unexpected journal steps: %v", js.Completed)
+	}
+	ss.mu.Lock()
+	ss.fail = ""
+	ss.mu.Unlock()
+	s, err := c.Freeze(Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Done(StepWaitRunning) {
+		t.Errorf("freeze did not complete: %v", s.Completed)
+	}
+	if !ss.paused["bt1"] || ss.triggers["bt1"][0].Disabled != true || ss.triggers["bt2"][0].Disabled != true {
+		t.Errorf("server not frozen: paused %v, triggers %v", ss.paused, ss.triggers)
+	}
+	if s.Triggers.BuildTypes[0].Triggers[0].Disabled {
+		t.Error("resumed freeze overwrote the original trigger snapshot")
+	}
+	if _, err := c.Thaw(s); err != nil {
+		t.Fatal(err)
+	}
+	if ss.paused["bt1"] || !ss.paused["bt2"] {
+		t.Errorf("paused state not restored: %v", ss.paused)
+	}
+	if ss.triggers["bt1"][0].Disabled || !ss.triggers["bt1"][1].Disabled || ss.triggers["bt2"][0].Disabled {
+		t.Errorf("triggers not restored: %v", ss.triggers)
+	}
+	if _, err := os.Stat(f); !os.IsNotExist(err) {
+		t.Error("journal not removed after thaw")
+	}
+}
+
+// TestFreezeProjectScope tests that a project freeze covers the whole project tree and nothing else
+func TestFreezeProjectScope(t *testing.T) {
+	vcs := []teamcitytest.Trigger{{ID: "vcs", Type: "vcsTrigger"}}
+	ts := teamcitytest.NewServer(teamcitytest.State{
+		Projects: []teamcitytest.Project{
+			{ID: "Payments", Name: "Payments"},
+			{ID: "Payments_Api", Name: "API", ParentProjectID: "Payments"},
+			{ID: "Payments_Api_V2", Name: "V2", ParentProjectID: "Payments_Api"},
+			{ID: "Orders", Name: "Orders"},
+		},
+		BuildTypes: []teamcitytest.BuildType{
+			{ID: "Payments_Build", Name: "Build", ProjectID: "Payments", Triggers: vcs},
+			{ID: "Payments_Api_Build", Name: "Build", ProjectID: "Payments_Api", Triggers: vcs},
+			{ID: "Payments_Api_V2_Build", Name: "Build", ProjectID: "Payments_Api_V2", Triggers: vcs},
+			{ID: "Orders_Build", Name: "Build", ProjectID: "Orders", Triggers: vcs},
+		},
+		Builds: []teamcitytest.Build{
+			{ID: 1, BuildTypeID: "Orders_Build", State: teamcitytest.StateRunning},
+			{ID: 2, BuildTypeID: "Payments_Build"},
+			{ID: 3, BuildTypeID: "Payments_Api_V2_Build"},
+			{ID: 4, BuildTypeID: "Orders_Build"},
+		},
+	})
+	defer ts.Close()
+	c := &Config{Client: ts.Client(), CancelQueue: true, Timeout: time.Second}
+	s, err := c.Freeze(Scope{Project: "Payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Paused) != 3 {
+		t.Errorf("frozen buildTypes = %v", s.Paused)
+	}
+	st := ts.State()
+	for _, bt := range st.BuildTypes {
+		frozen := bt.ProjectID != "Orders"
+		if bt.Paused != frozen || bt.Triggers[0].Disabled != frozen {
+			t.Errorf("%s paused %v, trigger disabled %v, want %v", bt.ID, bt.Paused, bt.Triggers[0].Disabled, frozen)
+		}
+	}
+	// cancelled queued builds are also deleted
+	var ids []int
+	for _, b := range st.Builds {
+		if b.Canceled == nil {
+			ids = append(ids, b.ID)
+		}
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 4 {
+		t.Errorf("builds left after freeze = %v, want [1 4]", ids)
+	}
+	s.Server += "/"
+	if _, err := c.Thaw(s); err != nil {
+		t.Fatal(err)
+	}
+	for _, bt := range ts.State().BuildTypes {
+		if bt.Paused || bt.Triggers[0].Disabled {
+			t.Errorf("%s not thawed: %+v", bt.ID, bt)
+		}
+	}
+}
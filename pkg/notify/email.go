@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// now returns the current time, overridden by tests
+var now = time.Now
+
+// Email sends messages as plain text mail through an SMTP server
+type Email struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	// Auth is optional, such as smtp.PlainAuth
+	Auth smtp.Auth
+	From string
+	To   []string
+	// SubjectPrefix is prepended to every subject, such as "[teamcity] "
+	SubjectPrefix string
+	// Timeout bounds connecting to the server and sending a message, DefaultTimeout if zero
+	Timeout time.Duration
+}
+
+// Notify mails message m to every recipient
+func (e *Email) Notify(m Message) error {
+	if len(e.To) == 0 {
+		return errors.New("no email recipients")
+	}
+	s := m.Subject
+	if s == "" {
+		s = strings.SplitN(m.Text, "\n", 2)[0]
+	}
+	var b strings.Builder
+	b.WriteString("From: " + headerValue(e.From) + "\r\n")
+	b.WriteString("To: " + headerValue(strings.Join(e.To, ", ")) + "\r\n")
+	b.WriteString("Subject: " + headerValue(e.SubjectPrefix+s) + "\r\n")
+	b.WriteString("Date: " + now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	for _, l := range strings.Split(m.Text, "\n") {
+		b.WriteString(strings.TrimRight(l, "\r") + "\r\n")
+	}
+	return e.send([]byte(b.String()))
+}
+
+// send sends mail msg like smtp.SendMail, giving up after the timeout
+func (e *Email) send(msg []byte) error {
+	t := e.Timeout
+	if t <= 0 {
+		t = DefaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", e.Addr, t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if derr := conn.SetDeadline(time.Now().Add(t)); derr != nil {
+		return derr
+	}
+	host, _, _ := net.SplitHostPort(e.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(e.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.From); err != nil {
+		return err
+	}
+	for _, r := range e.To {
+		if err := c.Rcpt(r); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// headerValue strips line breaks that would end a mail header
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message levels, used for colours and subject prefixes
+const (
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// DefaultTimeout is the timeout of webhook requests when a notifier has none
+const DefaultTimeout = 10 * time.Second
+
+// Message is a rendered notification
+type Message struct {
+	Level   string
+	Subject string
+	Text    string
+}
+
+// Notifier sends messages to a channel
+type Notifier interface {
+	Notify(m Message) error
+}
+
+// Multi sends each message to every notifier
+type Multi []Notifier
+
+// Notify sends message m to every notifier, returning the combined errors
+func (ns Multi) Notify(m Message) error {
+	var erstrs []string
+	for _, n := range ns {
+		if err := n.Notify(m); err != nil {
+			erstrs = append(erstrs, err.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
+
+// postJSON posts JSON body bd to URL u
+func postJSON(u string, bd []byte, t time.Duration) error {
+	if t <= 0 {
+		t = DefaultTimeout
+	}
+	hc := &http.Client{Timeout: t}
+	res, err := hc.Post(u, "application/json", bytes.NewReader(bd))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	rb, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New("POST " + u + ": " + strconv.Itoa(res.StatusCode) + " " + strings.TrimSpace(string(rb)))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hook is a webhook receiver recording the JSON bodies it receives
+func hook(t *testing.T, status int, bodies *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bd, _ := ioutil.ReadAll(r.Body)
+		var m map[string]interface{}
+		if err := json.Unmarshal(bd, &m); err != nil {
+			t.Error(err)
+		}
+		*bodies = append(*bodies, m)
+		w.WriteHeader(status)
+	}))
+}
+
+// TestWebhooks tests the Slack and Teams payloads and error handling through Multi
+func TestWebhooks(t *testing.T) {
+	var slack, teams, broken []map[string]interface{}
+	ss := hook(t, http.StatusOK, &slack)
+	defer ss.Close()
+	ts := hook(t, http.StatusOK, &teams)
+	defer ts.Close()
+	bs := hook(t, http.StatusNotFound, &broken)
+	defer bs.Close()
+	m := Message{Level: LevelError, Subject: "2 builds failed", Text: "- A #1\n- B #2"}
+	ns := Multi{
+		&Slack{URL: ss.URL, Channel: "#ci"},
+		&Teams{URL: ts.URL},
+		&Slack{URL: bs.URL},
+	}
+	err := ns.Notify(m)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected error from broken webhook, got %v", err)
+	}
+	if len(slack) != 1 || slack[0]["text"] != "*2 builds failed*\n- A #1\n- B #2" || slack[0]["channel"] != "#ci" || slack[0]["icon_emoji"] != ":red_circle:" {
+		t.Errorf("unexpected slack payload %v", slack)
+	}
+	if len(teams) != 1 || teams[0]["@type"] != "MessageCard" || teams[0]["title"] != "2 builds failed" ||
+		teams[0]["themeColor"] != "D70000" || teams[0]["text"] != "- A #1  \n- B #2" {
+		t.Errorf("unexpected teams payload %v", teams)
+	}
+	if len(broken) != 1 {
+		t.Errorf("broken webhook got %d requests", len(broken))
+	}
+}
+
+// smtpServer accepts one SMTP session and sends the received data on the returned channel
+func smtpServer(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		tc := textproto.NewConn(c)
+		defer tc.Close()
+		tc.PrintfLine("220 localhost ESMTP")
+		var rcpts []string
+		for {
+			l, err := tc.ReadLine()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(l, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				tc.PrintfLine("250 localhost")
+			case "RCPT":
+				rcpts = append(rcpts, l)
+				tc.PrintfLine("250 OK")
+			case "DATA":
+				tc.PrintfLine("354 go ahead")
+				lines, err := tc.ReadDotLines()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ch <- strings.Join(rcpts, "\n") + "\n\n" + strings.Join(lines, "\n")
+				tc.PrintfLine("250 OK")
+			case "QUIT":
+				tc.PrintfLine("221 bye")
+				return
+			default:
+				tc.PrintfLine("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+// TestEmail tests mail sent through a local SMTP server
+func TestEmail(t *testing.T) {
+	now = func() time.Time { return time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	addr, ch := smtpServer(t)
+	e := &Email{Addr: addr, From: "teamcity@example.com", To: []string{"ops@example.com", "dev@example.com"}, SubjectPrefix: "[teamcity] "}
+	if err := e.Notify(Message{Subject: "Queue\nbacklog", Text: "12 builds are queued.\nThe oldest has waited 5m0s."}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-ch
+	for _, want := range []string{
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<dev@example.com>",
+		"To: ops@example.com, dev@example.com",
+		"Subject: [teamcity] Queue backlog",
+		"Date: Fri, 01 May 2020 12:00:00 +0000",
+		"\n\n12 builds are queued.\nThe oldest has waited 5m0s.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("mail does not contain %q:\n%s", want, got)
+		}
+	}
+	if err := (&Email{Addr: addr}).Notify(Message{Text: "x"}); err == nil {
+		t.Error("expected error without recipients")
+	}
+}
+
+// TestEmailTimeout tests that a server that never answers does not block Notify
+func TestEmailTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			defer c.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+	e := &Email{Addr: l.Addr().String(), From: "teamcity@example.com", To: []string{"ops@example.com"}, Timeout: 100 * time.Millisecond}
+	st := time.Now()
+	if err := e.Notify(Message{Text: "x"}); err == nil {
+		t.Error("expected timeout error")
+	}
+	if d := time.Since(st); d > time.Second {
+		t.Errorf("Notify returned after %v", d)
+	}
+}
@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Slack posts messages to a Slack-compatible incoming webhook, which
+// Mattermost and Rocket.Chat also accept
+type Slack struct {
+	URL string
+	// Channel and Username override the webhook defaults if set
+	Channel  string
+	Username string
+	Timeout  time.Duration
+}
+
+// slackPayload is the incoming webhook body
+type slackPayload struct {
+	Text      string `json:"text"`
+	Channel   string `json:"channel,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+}
+
+// slackIcons maps message levels to icons
+var slackIcons = map[string]string{
+	LevelInfo:    ":information_source:",
+	LevelWarning: ":warning:",
+	LevelError:   ":red_circle:",
+}
+
+// Notify posts message m to the webhook
+func (s *Slack) Notify(m Message) error {
+	t := m.Text
+	if m.Subject != "" {
+		t = "*" + m.Subject + "*\n" + t
+	}
+	bd, err := json.Marshal(slackPayload{
+		Text:      t,
+		Channel:   s.Channel,
+		Username:  s.Username,
+		IconEmoji: slackIcons[m.Level],
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(s.URL, bd, s.Timeout)
+}
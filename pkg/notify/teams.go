@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Teams posts messages as MessageCards to a Microsoft Teams incoming webhook
+type Teams struct {
+	URL     string
+	Timeout time.Duration
+}
+
+// messageCard is the legacy actionable message card format
+type messageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Text       string `json:"text"`
+}
+
+// teamsColors maps message levels to card theme colours
+var teamsColors = map[string]string{
+	LevelInfo:    "0078D7",
+	LevelWarning: "FFA500",
+	LevelError:   "D70000",
+}
+
+// Notify posts message m to the webhook
+func (t *Teams) Notify(m Message) error {
+	s := m.Subject
+	if s == "" {
+		s = strings.SplitN(m.Text, "\n", 2)[0]
+	}
+	// card text is markdown, where single newlines do not break lines
+	bd, err := json.Marshal(messageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    s,
+		ThemeColor: teamsColors[m.Level],
+		Title:      m.Subject,
+		Text:       strings.Replace(m.Text, "\n", "  \n", -1),
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(t.URL, bd, t.Timeout)
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/maintenance"
+)
+
+// Maintenance event actions
+const (
+	MaintenanceFrozen         = "frozen"
+	MaintenanceThawed         = "thawed"
+	MaintenanceBuildsFinished = "buildsFinished"
+)
+
+// Default subject and text templates, which can be passed to Render to
+// build variants
+const (
+	BuildFailuresSubject = `{{len .}} build{{if ne (len .) 1}}s{{end}} failed`
+	BuildFailuresText    = `{{range .}}- {{.BuildTypeID}} #{{.Number}}{{if .BranchName}} ({{.BranchName}}){{end}}{{if .StatusText}}: {{.StatusText}}{{end}}{{if .WebURL}} {{.WebURL}}{{end}}
+{{end}}`
+	QueueBacklogSubject = `Build queue backlog{{if .Project}} in {{.Project}}{{end}}: {{.Length}} builds`
+	QueueBacklogText    = `{{.Length}} builds are queued{{if .Threshold}}, above the threshold of {{.Threshold}}{{end}}.
+{{if .OldestWait}}The oldest has waited {{.OldestWait}}.
+{{end}}`
+	MaintenanceSubject = `{{if eq .Action "frozen"}}Maintenance freeze started{{else if eq .Action "thawed"}}Maintenance freeze ended{{else}}Running builds finished{{end}}{{if .Project}} in {{.Project}}{{else}} on {{.Server}}{{end}}`
+	MaintenanceText    = `{{if eq .Action "frozen"}}Triggers are disabled and {{.Paused}} buildTypes are paused.
+{{else if eq .Action "thawed"}}Triggers and {{.Paused}} paused buildTypes are restored.
+{{range .Drift}}- {{.}}
+{{end}}{{else}}No builds are running{{if .Project}} in {{.Project}}{{end}}.
+{{end}}`
+)
+
+// Backlog contains queue backlog data
+type Backlog struct {
+	Project    string
+	Length     int
+	Threshold  int
+	OldestWait time.Duration
+}
+
+// MaintenanceEvent contains maintenance data
+type MaintenanceEvent struct {
+	Action  string
+	Server  string
+	Project string
+	// Paused is the number of buildTypes paused by the freeze
+	Paused int
+	// Drift lists trigger changes found when thawing
+	Drift []build.TriggerDrift
+}
+
+// NewMaintenanceEvent returns a maintenance event for action a of freeze snapshot s
+func NewMaintenanceEvent(a string, s *maintenance.Snapshot, ds []build.TriggerDrift) MaintenanceEvent {
+	e := MaintenanceEvent{Action: a, Server: s.Server, Project: s.Scope.Project, Drift: ds}
+	for _, p := range s.Paused {
+		if !p {
+			e.Paused++
+		}
+	}
+	return e
+}
+
+// Render executes subject and text templates st and tt with data d
+func Render(level string, st string, tt string, d interface{}) (Message, error) {
+	s, err := execute(st, d)
+	if err != nil {
+		return Message{}, err
+	}
+	t, err := execute(tt, d)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Level: level, Subject: s, Text: strings.TrimRight(t, "\n")}, nil
+}
+
+// execute executes template text t with data d
+func execute(t string, d interface{}) (string, error) {
+	tp, err := template.New("").Parse(t)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tp.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// BuildFailures returns a message listing failed builds bs
+func BuildFailures(bs []build.Build) (Message, error) {
+	return Render(LevelError, BuildFailuresSubject, BuildFailuresText, bs)
+}
+
+// QueueBacklog returns a message about queue backlog b
+func QueueBacklog(b Backlog) (Message, error) {
+	b.OldestWait = b.OldestWait.Round(time.Second)
+	return Render(LevelWarning, QueueBacklogSubject, QueueBacklogText, b)
+}
+
+// Maintenance returns a message about maintenance event e
+func Maintenance(e MaintenanceEvent) (Message, error) {
+	return Render(LevelInfo, MaintenanceSubject, MaintenanceText, e)
+}
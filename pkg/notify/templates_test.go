@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/maintenance"
+)
+
+// TestTemplates tests the default messages
+func TestTemplates(t *testing.T) {
+	bf, err := BuildFailures([]build.Build{
+		{BuildTypeID: "Payments_Build", Number: "41", BranchName: "main", StatusText: "Tests failed: 2", WebURL: "https://tc/build/1"},
+		{BuildTypeID: "Orders_Build", Number: "7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb, err := QueueBacklog(Backlog{Project: "Payments", Length: 12, Threshold: 10, OldestWait: 5*time.Minute + 300*time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &maintenance.Snapshot{Server: "https://tc", Scope: maintenance.Scope{Project: "Payments"},
+		Paused: map[string]bool{"Payments_Build": false, "Payments_Deploy": true}}
+	fr, err := Maintenance(NewMaintenanceEvent(MaintenanceFrozen, s, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	th, err := Maintenance(NewMaintenanceEvent(MaintenanceThawed, s, []build.TriggerDrift{{Kind: "removed", BuildTypeID: "Payments_Build", TriggerID: "T1"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr, err := Maintenance(MaintenanceEvent{Action: MaintenanceBuildsFinished, Server: "https://tc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		got  Message
+		want Message
+	}{
+		{bf, Message{LevelError, "2 builds failed", "- Payments_Build #41 (main): Tests failed: 2 https://tc/build/1\n- Orders_Build #7"}},
+		{qb, Message{LevelWarning, "Build queue backlog in Payments: 12 builds", "12 builds are queued, above the threshold of 10.\nThe oldest has waited 5m0s."}},
+		{fr, Message{LevelInfo, "Maintenance freeze started in Payments", "Triggers are disabled and 1 buildTypes are paused."}},
+		{th, Message{LevelInfo, "Maintenance freeze ended in Payments", "Triggers and 1 paused buildTypes are restored.\n- removed: Payments_Build/T1"}},
+		{wr, Message{LevelInfo, "Running builds finished on https://tc", "No builds are running."}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %+v, want %+v", tt.got, tt.want)
+		}
+	}
+	if _, err := Render(LevelInfo, "{{.Missing", "", nil); err == nil {
+		t.Error("expected template parse error")
+	}
+}
@@ -0,0 +1,160 @@
+package projectspec
+
+import (
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// Export returns a spec describing project p and all of its subprojects.
+// Inherited parameters and settings, and password parameters, are left out.
+func (c *Config) Export(p string) (*Spec, error) {
+	bc := &build.Config{Client: c.Client}
+	ps, err := bc.Projects()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[string][]string)
+	for _, pd := range ps {
+		children[pd.ParentProjectID] = append(children[pd.ParentProjectID], pd.ID)
+	}
+	ts, err := bc.Types()
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string][]build.Type)
+	for _, t := range ts {
+		types[t.ProjectID] = append(types[t.ProjectID], t)
+	}
+	pr, err := bc.GetProject("id:" + p)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spec{Version: Version, Parent: pr.ParentProjectID}
+	ep, err := exportProject(bc, pr, children, types)
+	if err != nil {
+		return nil, err
+	}
+	s.Project = *ep
+	s.Normalize()
+	return s, nil
+}
+
+// exportProject returns the spec for project pr and its subprojects
+func exportProject(bc *build.Config, pr *build.Project, children map[string][]string, types map[string][]build.Type) (*ProjectSpec, error) {
+	ps := &ProjectSpec{
+		ID:          pr.ID,
+		Name:        pr.Name,
+		Description: pr.Description,
+	}
+	ps.Parameters, ps.passwords = parameterMap(pr.Parameters.ParameterProperties)
+	for _, t := range types[pr.ID] {
+		ts, err := exportType(bc, t)
+		if err != nil {
+			return nil, err
+		}
+		ps.BuildTypes = append(ps.BuildTypes, *ts)
+	}
+	for _, id := range children[pr.ID] {
+		cp, err := bc.GetProject("id:" + id)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := exportProject(bc, cp, children, types)
+		if err != nil {
+			return nil, err
+		}
+		ps.Projects = append(ps.Projects, *cs)
+	}
+	return ps, nil
+}
+
+// exportType returns the spec for buildType t
+func exportType(bc *build.Config, t build.Type) (*TypeSpec, error) {
+	ts := &TypeSpec{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Paused:      t.Paused,
+	}
+	tps, err := bc.TypeTemplates(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tp := range tps {
+		ts.Templates = append(ts.Templates, tp.ID)
+	}
+	pps, err := bc.TypeParameters(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	ts.Parameters, ts.passwords = parameterMap(pps)
+	es, err := bc.VCSRootEntries(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range es {
+		if !e.Inherited {
+			ts.VCSRoots = append(ts.VCSRoots, VCSRootSpec{ID: e.VCSRoot.ID, CheckoutRules: e.CheckoutRules})
+		}
+	}
+	trs, err := bc.BuildTriggers(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tr := range trs {
+		if tr.Inherited {
+			continue
+		}
+		var props []build.Property
+		for _, p := range tr.Properties.Property {
+			props = append(props, build.Property{Name: p.Name, Value: p.Value})
+		}
+		ts.Triggers = append(ts.Triggers, SettingSpec{ID: tr.ID, Type: tr.Type, Disabled: tr.Disabled, Properties: propertyMap(props)})
+	}
+	sds, err := bc.SnapshotDependencies(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	ts.SnapshotDependencies = dependencySpecs(sds)
+	ads, err := bc.ArtifactDependencies(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	ts.ArtifactDependencies = dependencySpecs(ads)
+	return ts, nil
+}
+
+// parameterMap converts parameters to a map without inherited or password parameters,
+// it also returns the names of the password parameters
+func parameterMap(pps []build.ParameterPropery) (map[string]string, map[string]bool) {
+	var ps []build.Property
+	var pws map[string]bool
+	for _, p := range pps {
+		if p.Password() {
+			if pws == nil {
+				pws = make(map[string]bool)
+			}
+			pws[p.Name] = true
+			continue
+		}
+		if !p.Inherited {
+			ps = append(ps, build.Property{Name: p.Name, Value: p.Value})
+		}
+	}
+	return propertyMap(ps), pws
+}
+
+// dependencySpecs converts dependencies to specs without inherited dependencies
+func dependencySpecs(ds []build.Dependency) []SettingSpec {
+	var ss []SettingSpec
+	for _, d := range ds {
+		if d.Inherited {
+			continue
+		}
+		s := SettingSpec{ID: d.ID, Type: d.Type, Disabled: d.Disabled, Properties: propertyMap(d.Properties.Property)}
+		if d.SourceBuildType != nil {
+			s.SourceBuildType = d.SourceBuildType.ID
+		}
+		ss = append(ss, s)
+	}
+	return ss
+}
@@ -0,0 +1,126 @@
+package projectspec
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// paymentsRoutes contains the GET responses of a server with a Payments project
+var paymentsRoutes = map[string]string{
+	"/httpAuth/app/rest/projects": `{"project":[
+		{"id":"_Root","name":"<Root project>"},
+		{"id":"Payments","name":"Payments","parentProjectId":"_Root"},
+		{"id":"Payments_Api","name":"Api","parentProjectId":"Payments"},
+		{"id":"Orders","name":"Orders","parentProjectId":"_Root"}]}`,
+	"/httpAuth/app/rest/buildTypes": `{"buildType":[
+		{"id":"Payments_Build","name":"Build","projectId":"Payments"},
+		{"id":"Orders_Build","name":"Build","projectId":"Orders"}]}`,
+	"/httpAuth/app/rest/projects/id:Payments": `{"id":"Payments","name":"Payments","parentProjectId":"_Root","description":"Payment services",
+		"parameters":{"property":[{"name":"env.TEAM","value":"payments"},{"name":"env.ROOT","value":"x","inherited":true},
+			{"name":"env.API_KEY","value":"","type":{"rawValue":"password display='hidden'"}}]}}`,
+	"/httpAuth/app/rest/projects/id:Payments_Api":               `{"id":"Payments_Api","name":"Api","parentProjectId":"Payments"}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/templates": `{"buildType":[{"id":"Go_Build"}]}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/parameters": `{"property":[{"name":"env.GOOS","value":"linux"},{"name":"env.TEAM","value":"payments","inherited":true},
+		{"name":"secure.TOKEN","value":"","type":{"rawValue":"password"}}]}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/vcs-root-entries": `{"vcs-root-entry":[
+		{"id":"Payments_Git","vcs-root":{"id":"Payments_Git"},"checkout-rules":"+:src"}]}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/triggers": `{"trigger":[
+		{"id":"TRIGGER_1","type":"vcsTrigger","properties":{"property":[{"name":"branchFilter","value":"+:*"}]}},
+		{"id":"TRIGGER_2","type":"schedulingTrigger","inherited":true}]}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/snapshot-dependencies": `{"snapshot-dependency":[
+		{"id":"Orders_Build","type":"snapshot_dependency","source-buildType":{"id":"Orders_Build"}}]}`,
+	"/httpAuth/app/rest/buildTypes/id:Payments_Build/artifact-dependencies": `{"count":0}`,
+}
+
+// newStub returns a server answering GETs from routes and recording every other request in calls
+func newStub(routes map[string]string, calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			bd, _ := ioutil.ReadAll(r.Body)
+			*calls = append(*calls, r.Method+" "+r.URL.Path+" "+string(bd))
+			w.Write([]byte(`{}`))
+			return
+		}
+		rd, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rd))
+	}))
+}
+
+// TestExport tests the spec exported for a project subtree
+func TestExport(t *testing.T) {
+	ts := newStub(paymentsRoutes, nil)
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	s, err := c.Export("Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yd, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `version: 1
+parent: _Root
+project:
+  id: Payments
+  name: Payments
+  description: Payment services
+  parameters:
+    env.TEAM: payments
+  buildTypes:
+  - id: Payments_Build
+    name: Build
+    templates:
+    - Go_Build
+    parameters:
+      env.GOOS: linux
+    vcsRoots:
+    - id: Payments_Git
+      checkoutRules: +:src
+    triggers:
+    - id: TRIGGER_1
+      type: vcsTrigger
+      properties:
+        branchFilter: +:*
+    snapshotDependencies:
+    - id: Orders_Build
+      type: snapshot_dependency
+      sourceBuildType: Orders_Build
+  projects:
+  - id: Payments_Api
+    name: Api
+`
+	if string(yd) != want {
+		t.Errorf("exported spec:\n%s\nwant:\n%s", yd, want)
+	}
+	rs, err := Unmarshal(yd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, _ := Marshal(rs)
+	if string(rd) != string(yd) {
+		t.Errorf("round trip changed spec:\n%s", rd)
+	}
+}
+
+// TestUnmarshalRejectsBadSpecs tests that unknown fields and versions are rejected
+func TestUnmarshalRejectsBadSpecs(t *testing.T) {
+	bad := []string{
+		"version: 2\nproject:\n  id: Payments\n",
+		"version: 1\nproject:\n  name: Payments\n",
+		"version: 1\nproject:\n  id: Payments\n  colour: blue\n",
+	}
+	for _, b := range bad {
+		if _, err := Unmarshal([]byte(b)); err == nil {
+			t.Errorf("expected error for spec %q", b)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package projectspec
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// Change actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change kinds
+const (
+	KindProject            = "project"
+	KindBuildType          = "buildType"
+	KindField              = "field"
+	KindParameter          = "parameter"
+	KindTemplate           = "template"
+	KindVCSRoot            = "vcsRoot"
+	KindTrigger            = "trigger"
+	KindSnapshotDependency = "snapshotDependency"
+	KindArtifactDependency = "artifactDependency"
+)
+
+// Change contains a single planned change to the server
+type Change struct {
+	Action    string `json:"action"`
+	Kind      string `json:"kind"`
+	Project   string `json:"project"`
+	BuildType string `json:"buildType,omitempty"`
+	ID        string `json:"id"`
+	Value     string `json:"value,omitempty"`
+	apply     func(*build.Config) error
+}
+
+// String returns a one line description of the change
+func (ch Change) String() string {
+	var s string
+	switch ch.Action {
+	case ActionCreate:
+		s = "+ "
+	case ActionUpdate:
+		s = "~ "
+	case ActionDelete:
+		s = "- "
+	}
+	s += ch.Kind + " " + ch.Project
+	if ch.BuildType != "" {
+		s += "/" + ch.BuildType
+	}
+	if ch.ID != "" && ch.ID != ch.Project && ch.ID != ch.BuildType {
+		s += " " + ch.ID
+	}
+	if ch.Value != "" {
+		s += " = " + strconv.Quote(ch.Value)
+	}
+	return s
+}
+
+// planner collects changes in the order they must be applied
+type planner struct {
+	projects       []Change
+	types          []Change
+	updates        []Change
+	settings       []Change
+	deletes        []Change
+	typeDeletes    []Change
+	projectDeletes []Change
+}
+
+// changes returns all collected changes in apply order
+func (pl *planner) changes() []Change {
+	var cs []Change
+	cs = append(cs, pl.projects...)
+	cs = append(cs, pl.types...)
+	cs = append(cs, pl.updates...)
+	cs = append(cs, pl.settings...)
+	cs = append(cs, pl.deletes...)
+	cs = append(cs, pl.typeDeletes...)
+	cs = append(cs, pl.projectDeletes...)
+	return cs
+}
+
+// Plan returns the changes needed to make the server match spec s.
+// Nothing is changed on the server.
+func (c *Config) Plan(s *Spec) ([]Change, error) {
+	s.Normalize()
+	var have *ProjectSpec
+	cur, err := c.Export(s.Project.ID)
+	if err != nil && !teamcity.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		have = &cur.Project
+	}
+	parent := s.Parent
+	if parent == "" {
+		parent = "_Root"
+	}
+	pl := &planner{}
+	pl.project(parent, &s.Project, have)
+	return pl.changes(), nil
+}
+
+// Apply applies changes returned by Plan in order, stopping at the first error
+func (c *Config) Apply(cs []Change) error {
+	bc := &build.Config{Client: c.Client}
+	for _, ch := range cs {
+		if ch.apply == nil {
+			return errors.New("change cannot be applied, it was not created by Plan: " + ch.String())
+		}
+		if err := ch.apply(bc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import plans and applies spec s, returning the applied changes
+func (c *Config) Import(s *Spec) ([]Change, error) {
+	cs, err := c.Plan(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Apply(cs); err != nil {
+		return cs, err
+	}
+	return cs, nil
+}
+
+// project plans project want in parent project parent against current state have
+func (pl *planner) project(parent string, want *ProjectSpec, have *ProjectSpec) {
+	p := want.ID
+	if have == nil {
+		n := want.Name
+		pl.projects = append(pl.projects, Change{Action: ActionCreate, Kind: KindProject, Project: p, ID: p, Value: n,
+			apply: func(bc *build.Config) error {
+				_, err := bc.CreateProject(parent, p, n)
+				return err
+			}})
+		have = &ProjectSpec{ID: p, Name: n}
+	}
+	if want.Name != have.Name {
+		pl.projects = append(pl.projects, projectField(p, "name", want.Name))
+	}
+	if want.Description != have.Description {
+		pl.projects = append(pl.projects, projectField(p, "description", want.Description))
+	}
+	pl.parameters(p, "", want.Parameters, have.Parameters, have.passwords)
+	ht := make(map[string]*TypeSpec)
+	for i := range have.BuildTypes {
+		ht[have.BuildTypes[i].ID] = &have.BuildTypes[i]
+	}
+	for i := range want.BuildTypes {
+		t := &want.BuildTypes[i]
+		pl.buildType(p, t, ht[t.ID])
+		delete(ht, t.ID)
+	}
+	var tids []string
+	for id := range ht {
+		tids = append(tids, id)
+	}
+	sort.Strings(tids)
+	for _, id := range tids {
+		id := id
+		pl.typeDeletes = append(pl.typeDeletes, Change{Action: ActionDelete, Kind: KindBuildType, Project: p, BuildType: id, ID: id,
+			apply: func(bc *build.Config) error { return bc.DeleteType(id) }})
+	}
+	hp := make(map[string]*ProjectSpec)
+	for i := range have.Projects {
+		hp[have.Projects[i].ID] = &have.Projects[i]
+	}
+	for i := range want.Projects {
+		cp := &want.Projects[i]
+		pl.project(p, cp, hp[cp.ID])
+		delete(hp, cp.ID)
+	}
+	var ids []string
+	for id := range hp {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		id := id
+		pl.projectDeletes = append(pl.projectDeletes, Change{Action: ActionDelete, Kind: KindProject, Project: id, ID: id,
+			apply: func(bc *build.Config) error { return bc.DeleteProject(id) }})
+	}
+}
+
+// projectField returns a change setting field f of project p to v
+func projectField(p string, f string, v string) Change {
+	return Change{Action: ActionUpdate, Kind: KindField, Project: p, ID: f, Value: v,
+		apply: func(bc *build.Config) error { return bc.SetProjectField(p, f, v) }}
+}
+
+// typeField returns a change setting field f of buildType id in project p to v
+func typeField(p string, id string, f string, v string) Change {
+	return Change{Action: ActionUpdate, Kind: KindField, Project: p, BuildType: id, ID: f, Value: v,
+		apply: func(bc *build.Config) error { return bc.SetTypeField(id, f, v) }}
+}
+
+// buildType plans buildType want in project p against current state have
+func (pl *planner) buildType(p string, want *TypeSpec, have *TypeSpec) {
+	id := want.ID
+	if have == nil {
+		n := want.Name
+		pl.types = append(pl.types, Change{Action: ActionCreate, Kind: KindBuildType, Project: p, BuildType: id, ID: id, Value: n,
+			apply: func(bc *build.Config) error {
+				_, err := bc.CreateType(p, id, n)
+				return err
+			}})
+		have = &TypeSpec{ID: id, Name: n}
+	}
+	if want.Name != have.Name {
+		pl.updates = append(pl.updates, typeField(p, id, "name", want.Name))
+	}
+	if want.Description != have.Description {
+		pl.updates = append(pl.updates, typeField(p, id, "description", want.Description))
+	}
+	if want.Paused != have.Paused {
+		ps := want.Paused
+		pl.updates = append(pl.updates, Change{Action: ActionUpdate, Kind: KindField, Project: p, BuildType: id, ID: "paused", Value: strconv.FormatBool(ps),
+			apply: func(bc *build.Config) error { return bc.SetTypePaused(id, ps) }})
+	}
+	ht := make(map[string]bool)
+	for _, t := range have.Templates {
+		ht[t] = true
+	}
+	for _, t := range want.Templates {
+		t := t
+		if ht[t] {
+			delete(ht, t)
+			continue
+		}
+		pl.updates = append(pl.updates, Change{Action: ActionCreate, Kind: KindTemplate, Project: p, BuildType: id, ID: t,
+			apply: func(bc *build.Config) error { return bc.AttachTemplate(id, t) }})
+	}
+	var tids []string
+	for t := range ht {
+		tids = append(tids, t)
+	}
+	sort.Strings(tids)
+	for _, t := range tids {
+		t := t
+		pl.deletes = append(pl.deletes, Change{Action: ActionDelete, Kind: KindTemplate, Project: p, BuildType: id, ID: t,
+			apply: func(bc *build.Config) error { return bc.DetachTemplate(id, t) }})
+	}
+	pl.parameters(p, id, want.Parameters, have.Parameters, have.passwords)
+	pl.vcsRoots(p, id, want.VCSRoots, have.VCSRoots)
+	pl.triggers(p, id, want.Triggers, have.Triggers)
+	pl.dependencies(p, id, KindSnapshotDependency, want.SnapshotDependencies, have.SnapshotDependencies)
+	pl.dependencies(p, id, KindArtifactDependency, want.ArtifactDependencies, have.ArtifactDependencies)
+}
+
+// parameters plans the parameters of project p, or of buildType id if set.
+// Password parameters pws are left alone, the server does not return their values.
+func (pl *planner) parameters(p string, id string, want map[string]string, have map[string]string, pws map[string]bool) {
+	var ns []string
+	for n := range want {
+		if !pws[n] {
+			ns = append(ns, n)
+		}
+	}
+	sort.Strings(ns)
+	for _, n := range ns {
+		n, v := n, want[n]
+		hv, ok := have[n]
+		if ok && hv == v {
+			continue
+		}
+		a := ActionUpdate
+		if !ok {
+			a = ActionCreate
+		}
+		ch := Change{Action: a, Kind: KindParameter, Project: p, BuildType: id, ID: n, Value: v}
+		if id == "" {
+			ch.apply = func(bc *build.Config) error { return bc.SetProjectParameter(p, n, v) }
+		} else {
+			ch.apply = func(bc *build.Config) error { return bc.SetTypeParameter(id, n, v) }
+		}
+		pl.updates = append(pl.updates, ch)
+	}
+	ns = nil
+	for n := range have {
+		if _, ok := want[n]; !ok {
+			ns = append(ns, n)
+		}
+	}
+	sort.Strings(ns)
+	for _, n := range ns {
+		n := n
+		ch := Change{Action: ActionDelete, Kind: KindParameter, Project: p, BuildType: id, ID: n}
+		if id == "" {
+			ch.apply = func(bc *build.Config) error { return bc.DeleteProjectParameter(p, n) }
+		} else {
+			ch.apply = func(bc *build.Config) error { return bc.DeleteTypeParameter(id, n) }
+		}
+		pl.deletes = append(pl.deletes, ch)
+	}
+}
+
+// vcsRoots plans the VCS roots attached to buildType id
+func (pl *planner) vcsRoots(p string, id string, want []VCSRootSpec, have []VCSRootSpec) {
+	hr := make(map[string]VCSRootSpec)
+	for _, r := range have {
+		hr[r.ID] = r
+	}
+	for _, r := range want {
+		r := r
+		h, ok := hr[r.ID]
+		delete(hr, r.ID)
+		if !ok {
+			pl.updates = append(pl.updates, Change{Action: ActionCreate, Kind: KindVCSRoot, Project: p, BuildType: id, ID: r.ID, Value: r.CheckoutRules,
+				apply: func(bc *build.Config) error { return bc.AddVCSRootEntry(id, r.ID, r.CheckoutRules) }})
+			continue
+		}
+		if h.CheckoutRules != r.CheckoutRules {
+			pl.updates = append(pl.updates, Change{Action: ActionUpdate, Kind: KindVCSRoot, Project: p, BuildType: id, ID: r.ID, Value: r.CheckoutRules,
+				apply: func(bc *build.Config) error { return bc.SetVCSRootEntryCheckoutRules(id, r.ID, r.CheckoutRules) }})
+		}
+	}
+	var ids []string
+	for rid := range hr {
+		ids = append(ids, rid)
+	}
+	sort.Strings(ids)
+	for _, rid := range ids {
+		rid := rid
+		pl.deletes = append(pl.deletes, Change{Action: ActionDelete, Kind: KindVCSRoot, Project: p, BuildType: id, ID: rid,
+			apply: func(bc *build.Config) error { return bc.DeleteVCSRootEntry(id, rid) }})
+	}
+}
+
+// triggers plans the triggers of buildType id
+func (pl *planner) triggers(p string, id string, want []SettingSpec, have []SettingSpec) {
+	diffSettings(want, have, func(a string, s SettingSpec) {
+		ch := Change{Action: a, Kind: KindTrigger, Project: p, BuildType: id, ID: s.ID, Value: s.Type}
+		t := build.Trigger{ID: s.ID, Type: s.Type, Disabled: s.Disabled}
+		for _, pr := range propertyList(s.Properties) {
+			t.Properties.Property = append(t.Properties.Property, build.TriggerProperty{Name: pr.Name, Value: pr.Value})
+		}
+		switch a {
+		case ActionCreate:
+			ch.apply = func(bc *build.Config) error {
+				_, err := bc.AddBuildTrigger(id, t)
+				return err
+			}
+			pl.settings = append(pl.settings, ch)
+		case ActionUpdate:
+			ch.apply = func(bc *build.Config) error {
+				_, err := bc.UpdateBuildTrigger(id, t)
+				return err
+			}
+			pl.settings = append(pl.settings, ch)
+		case ActionDelete:
+			ch.Value = ""
+			ch.apply = func(bc *build.Config) error { return bc.DeleteBuildTrigger(id, s.ID) }
+			pl.deletes = append(pl.deletes, ch)
+		}
+	})
+}
+
+// dependencies plans the snapshot or artifact dependencies of buildType id
+func (pl *planner) dependencies(p string, id string, k string, want []SettingSpec, have []SettingSpec) {
+	diffSettings(want, have, func(a string, s SettingSpec) {
+		ch := Change{Action: a, Kind: k, Project: p, BuildType: id, ID: s.ID, Value: s.SourceBuildType}
+		d := build.Dependency{ID: s.ID, Type: s.Type, Disabled: s.Disabled, Properties: build.Properties{Property: propertyList(s.Properties)}}
+		if s.SourceBuildType != "" {
+			d.SourceBuildType = &build.TypeRef{ID: s.SourceBuildType}
+		}
+		switch a {
+		case ActionCreate:
+			ch.apply = func(bc *build.Config) error {
+				var err error
+				if k == KindSnapshotDependency {
+					_, err = bc.AddSnapshotDependency(id, d)
+				} else {
+					_, err = bc.AddArtifactDependency(id, d)
+				}
+				return err
+			}
+			pl.settings = append(pl.settings, ch)
+		case ActionUpdate:
+			ch.apply = func(bc *build.Config) error {
+				var err error
+				if k == KindSnapshotDependency {
+					_, err = bc.UpdateSnapshotDependency(id, d)
+				} else {
+					_, err = bc.UpdateArtifactDependency(id, d)
+				}
+				return err
+			}
+			pl.settings = append(pl.settings, ch)
+		case ActionDelete:
+			ch.Value = ""
+			ch.apply = func(bc *build.Config) error {
+				if k == KindSnapshotDependency {
+					return bc.DeleteSnapshotDependency(id, s.ID)
+				}
+				return bc.DeleteArtifactDependency(id, s.ID)
+			}
+			pl.deletes = append(pl.deletes, ch)
+		}
+	})
+}
+
+// diffSettings calls fn with the action needed for every setting that differs
+func diffSettings(want []SettingSpec, have []SettingSpec, fn func(string, SettingSpec)) {
+	hs := make(map[string]SettingSpec)
+	for _, s := range have {
+		hs[s.ID] = s
+	}
+	for _, s := range want {
+		h, ok := hs[s.ID]
+		delete(hs, s.ID)
+		if !ok {
+			fn(ActionCreate, s)
+		} else if !equalSetting(s, h) {
+			fn(ActionUpdate, s)
+		}
+	}
+	for _, s := range have {
+		if _, ok := hs[s.ID]; ok {
+			fn(ActionDelete, s)
+		}
+	}
+}
+
+// equalSetting returns true if settings a and b are equivalent
+func equalSetting(a SettingSpec, b SettingSpec) bool {
+	if a.Type != b.Type || a.SourceBuildType != b.SourceBuildType || a.Disabled != b.Disabled {
+		return false
+	}
+	if len(a.Properties) == 0 && len(b.Properties) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Properties, b.Properties)
+}
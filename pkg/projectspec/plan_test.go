@@ -0,0 +1,121 @@
+package projectspec
+
+import (
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestPlanAndApply tests the changes planned and the requests sent applying them
+func TestPlanAndApply(t *testing.T) {
+	var calls []string
+	ts := newStub(paymentsRoutes, &calls)
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	s, err := Unmarshal([]byte(`version: 1
+project:
+  id: Payments
+  name: Payments
+  description: Payment services
+  parameters:
+    env.API_KEY: ""
+    env.TEAM: payments
+    env.TIER: "1"
+  buildTypes:
+  - id: Payments_Build
+    name: Build
+    paused: true
+    templates:
+    - Go_Build
+    parameters:
+      env.GOOS: darwin
+    vcsRoots:
+    - id: Payments_Git
+      checkoutRules: +:src
+    snapshotDependencies:
+    - id: Orders_Build
+      type: snapshot_dependency
+      sourceBuildType: Orders_Build
+  - id: Payments_Deploy
+    name: Deploy
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := c.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("Plan changed the server: %v", calls)
+	}
+	want := []string{
+		`+ buildType Payments/Payments_Deploy = "Deploy"`,
+		`+ parameter Payments env.TIER = "1"`,
+		`~ field Payments/Payments_Build paused = "true"`,
+		`~ parameter Payments/Payments_Build env.GOOS = "darwin"`,
+		`- trigger Payments/Payments_Build TRIGGER_1`,
+		`- project Payments_Api`,
+	}
+	if len(cs) != len(want) {
+		t.Fatalf("plan = %v, want %v", cs, want)
+	}
+	for i := range want {
+		if cs[i].String() != want[i] {
+			t.Errorf("change[%d] = %s, want %s", i, cs[i], want[i])
+		}
+	}
+	if err := c.Apply(cs); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		`POST /httpAuth/app/rest/projects/id:Payments/buildTypes {"id":"Payments_Deploy","name":"Deploy"}`,
+		`PUT /httpAuth/app/rest/projects/id:Payments/parameters/env.TIER 1`,
+		`PUT /httpAuth/app/rest/buildTypes/id:Payments_Build/paused true`,
+		`PUT /httpAuth/app/rest/buildTypes/id:Payments_Build/parameters/env.GOOS darwin`,
+		`DELETE /httpAuth/app/rest/buildTypes/id:Payments_Build/triggers/TRIGGER_1 `,
+		`DELETE /httpAuth/app/rest/projects/id:Payments_Api `,
+	}
+	if len(calls) != len(wantCalls) {
+		t.Fatalf("calls = %v, want %v", calls, wantCalls)
+	}
+	for i := range wantCalls {
+		if calls[i] != wantCalls[i] {
+			t.Errorf("call[%d] = %s, want %s", i, calls[i], wantCalls[i])
+		}
+	}
+}
+
+// TestPlanNewProject tests that a missing project is created with its contents
+func TestPlanNewProject(t *testing.T) {
+	ts := newStub(map[string]string{"/httpAuth/app/rest/projects": `{}`, "/httpAuth/app/rest/buildTypes": `{}`}, nil)
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	s := &Spec{Version: Version, Project: ProjectSpec{ID: "Billing", Name: "Billing",
+		BuildTypes: []TypeSpec{{ID: "Billing_Build", Name: "Build", Triggers: []SettingSpec{{ID: "T1", Type: "vcsTrigger"}}}}}}
+	cs, err := c.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`+ project Billing = "Billing"`,
+		`+ buildType Billing/Billing_Build = "Build"`,
+		`+ trigger Billing/Billing_Build T1 = "vcsTrigger"`,
+	}
+	if len(cs) != len(want) {
+		t.Fatalf("plan = %v, want %v", cs, want)
+	}
+	for i := range want {
+		if cs[i].String() != want[i] {
+			t.Errorf("change[%d] = %s, want %s", i, cs[i], want[i])
+		}
+	}
+}
+
+// TestApplyRejectsForeignChanges tests that changes not created by Plan are refused
+func TestApplyRejectsForeignChanges(t *testing.T) {
+	c := &Config{Client: teamcity.New("http://127.0.0.1:0", "", "")}
+	if err := c.Apply([]Change{{Action: ActionDelete, Kind: KindProject, Project: "Payments", ID: "Payments"}}); err == nil {
+		t.Error("expected error applying change without Plan")
+	}
+}
@@ -0,0 +1,166 @@
+package projectspec
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Version is the current project spec format version
+const Version = 1
+
+// Config contains config data
+type Config struct {
+	Client *teamcity.Client
+}
+
+// Spec contains a declarative description of a project subtree
+type Spec struct {
+	Version int `yaml:"version"`
+	// Parent is the ID of the project the root project is created in
+	Parent  string      `yaml:"parent,omitempty"`
+	Project ProjectSpec `yaml:"project"`
+}
+
+// ProjectSpec contains a declarative description of a project
+type ProjectSpec struct {
+	ID          string            `yaml:"id"`
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Parameters  map[string]string `yaml:"parameters,omitempty"`
+	BuildTypes  []TypeSpec        `yaml:"buildTypes,omitempty"`
+	Projects    []ProjectSpec     `yaml:"projects,omitempty"`
+	// passwords are the password parameters on the server, which are never exported or changed
+	passwords map[string]bool
+}
+
+// TypeSpec contains a declarative description of a buildType
+type TypeSpec struct {
+	ID                   string            `yaml:"id"`
+	Name                 string            `yaml:"name"`
+	Description          string            `yaml:"description,omitempty"`
+	Paused               bool              `yaml:"paused,omitempty"`
+	Templates            []string          `yaml:"templates,omitempty"`
+	Parameters           map[string]string `yaml:"parameters,omitempty"`
+	VCSRoots             []VCSRootSpec     `yaml:"vcsRoots,omitempty"`
+	Triggers             []SettingSpec     `yaml:"triggers,omitempty"`
+	SnapshotDependencies []SettingSpec     `yaml:"snapshotDependencies,omitempty"`
+	ArtifactDependencies []SettingSpec     `yaml:"artifactDependencies,omitempty"`
+	// passwords are the password parameters on the server, which are never exported or changed
+	passwords map[string]bool
+}
+
+// VCSRootSpec contains a VCS root reference
+type VCSRootSpec struct {
+	ID            string `yaml:"id"`
+	CheckoutRules string `yaml:"checkoutRules,omitempty"`
+}
+
+// SettingSpec contains a trigger or dependency
+type SettingSpec struct {
+	ID   string `yaml:"id"`
+	Type string `yaml:"type"`
+	// SourceBuildType is the buildType a dependency depends on
+	SourceBuildType string            `yaml:"sourceBuildType,omitempty"`
+	Disabled        bool              `yaml:"disabled,omitempty"`
+	Properties      map[string]string `yaml:"properties,omitempty"`
+}
+
+// Marshal returns the YAML encoding of spec s
+func Marshal(s *Spec) ([]byte, error) {
+	s.Normalize()
+	return yaml.Marshal(s)
+}
+
+// Unmarshal parses a YAML spec
+func Unmarshal(bd []byte) (*Spec, error) {
+	s := &Spec{}
+	yerr := yaml.UnmarshalStrict(bd, s)
+	if yerr != nil {
+		return nil, yerr
+	}
+	if s.Version != Version {
+		return nil, errors.New("unsupported project spec version " + strconv.Itoa(s.Version))
+	}
+	if s.Project.ID == "" {
+		return nil, errors.New("project spec has no project id")
+	}
+	s.Normalize()
+	return s, nil
+}
+
+// WriteFile writes spec s to file f as YAML
+func WriteFile(s *Spec, f string) error {
+	bd, err := Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f, bd, 0644)
+}
+
+// ReadFile reads a YAML spec from file f
+func ReadFile(f string) (*Spec, error) {
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(bd)
+}
+
+// Normalize sorts every list in the spec by ID so output is deterministic
+func (s *Spec) Normalize() {
+	s.Project.normalize()
+}
+
+// normalize sorts the project's build types and subprojects by ID
+func (p *ProjectSpec) normalize() {
+	sort.Slice(p.BuildTypes, func(i, j int) bool { return p.BuildTypes[i].ID < p.BuildTypes[j].ID })
+	sort.Slice(p.Projects, func(i, j int) bool { return p.Projects[i].ID < p.Projects[j].ID })
+	for i := range p.BuildTypes {
+		t := &p.BuildTypes[i]
+		sort.Strings(t.Templates)
+		sort.Slice(t.VCSRoots, func(i, j int) bool { return t.VCSRoots[i].ID < t.VCSRoots[j].ID })
+		sortSettings(t.Triggers)
+		sortSettings(t.SnapshotDependencies)
+		sortSettings(t.ArtifactDependencies)
+	}
+	for i := range p.Projects {
+		p.Projects[i].normalize()
+	}
+}
+
+// sortSettings sorts settings ss by ID
+func sortSettings(ss []SettingSpec) {
+	sort.Slice(ss, func(i, j int) bool { return ss[i].ID < ss[j].ID })
+}
+
+// propertyMap converts properties to a map, or nil if there are none
+func propertyMap(ps []build.Property) map[string]string {
+	if len(ps) == 0 {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, p := range ps {
+		m[p.Name] = p.Value
+	}
+	return m
+}
+
+// propertyList converts a property map to a list sorted by name
+func propertyList(m map[string]string) []build.Property {
+	var ns []string
+	for n := range m {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	var ps []build.Property
+	for _, n := range ns {
+		ps = append(ps, build.Property{Name: n, Value: m[n]})
+	}
+	return ps
+}
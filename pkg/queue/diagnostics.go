@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// AgentRef references a build agent
+type AgentRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// IncompatibleAgent contains an agent that cannot run a queued build
+type IncompatibleAgent struct {
+	Agent   AgentRef `json:"agent"`
+	Reasons []string `json:"reasons"`
+}
+
+// BuildDetails contains diagnostic data for a queued build
+type BuildDetails struct {
+	build.Build
+	WaitReason         string              `json:"waitReason"`
+	StartEstimate      string              `json:"startEstimate"`
+	CompatibleAgents   []AgentRef          `json:"compatibleAgents"`
+	IncompatibleAgents []IncompatibleAgent `json:"incompatibleAgents"`
+	// BlockingDependencies are the snapshot dependencies which have not finished
+	BlockingDependencies []build.Build `json:"blockingDependencies"`
+}
+
+// WaitReasonGroup contains the queued builds waiting for the same reason
+type WaitReasonGroup struct {
+	WaitReason string `json:"waitReason"`
+	IDs        []int  `json:"ids"`
+}
+
+// detailFields are the build fields requested for queued build details
+const detailFields = "id,buildTypeId,state,branchName,queuedDate,href,webUrl,waitReason,startEstimate," +
+	"triggered(type,date,user(id,username,name)),compatibleAgents(agent(id,name))," +
+	"snapshot-dependencies(build(id,buildTypeId,number,state,status,href,webUrl))"
+
+// QueuedBuildDetails returns why queued build i is waiting and which agents can run it
+func (c *Config) QueuedBuildDetails(i int) (*BuildDetails, error) {
+	type queuedBuild struct {
+		build.Build
+		WaitReason       string `json:"waitReason"`
+		StartEstimate    string `json:"startEstimate"`
+		CompatibleAgents struct {
+			Agent []AgentRef `json:"agent"`
+		} `json:"compatibleAgents"`
+		SnapshotDependencies struct {
+			Build []build.Build `json:"build"`
+		} `json:"snapshot-dependencies"`
+	}
+	qb := &queuedBuild{}
+	u := "/httpAuth/app/rest/buildQueue/id:" + strconv.Itoa(i) + "?fields=" + url.QueryEscape(detailFields)
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &qb)
+	if jerr != nil {
+		return nil, jerr
+	}
+	bd := &BuildDetails{
+		Build:            qb.Build,
+		WaitReason:       qb.WaitReason,
+		StartEstimate:    qb.StartEstimate,
+		CompatibleAgents: qb.CompatibleAgents.Agent,
+	}
+	for _, d := range qb.SnapshotDependencies.Build {
+		if d.State != "finished" {
+			bd.BlockingDependencies = append(bd.BlockingDependencies, d)
+		}
+	}
+	ias, err := c.IncompatibleAgents(qb.BuildTypeID)
+	if err != nil {
+		return bd, err
+	}
+	bd.IncompatibleAgents = ias
+	return bd, nil
+}
+
+// IncompatibleAgents returns the agents which cannot run buildType id and why
+func (c *Config) IncompatibleAgents(id string) ([]IncompatibleAgent, error) {
+	type agents struct {
+		Agent []AgentRef `json:"agent"`
+	}
+	type compatibilities struct {
+		Compatibility []struct {
+			BuildType struct {
+				ID string `json:"id"`
+			} `json:"buildType"`
+			IncompatibleReasons struct {
+				Data []string `json:"data"`
+			} `json:"incompatibleReasons"`
+		} `json:"compatibility"`
+	}
+	as := &agents{}
+	l := "incompatible:(buildType:(id:" + id + ")),authorized:true"
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/agents?locator="+url.QueryEscape(l), nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &as)
+	if jerr != nil {
+		return nil, jerr
+	}
+	var ias []IncompatibleAgent
+	for _, a := range as.Agent {
+		cs := &compatibilities{}
+		u := "/httpAuth/app/rest/agents/id:" + strconv.Itoa(a.ID) + "/incompatibleBuildTypes"
+		rd, err := c.Client.HTTPRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		jerr := json.Unmarshal(rd, &cs)
+		if jerr != nil {
+			return nil, jerr
+		}
+		ia := IncompatibleAgent{Agent: a}
+		for _, ct := range cs.Compatibility {
+			if ct.BuildType.ID == id {
+				ia.Reasons = ct.IncompatibleReasons.Data
+			}
+		}
+		ias = append(ias, ia)
+	}
+	return ias, nil
+}
+
+// WaitReasons groups the current queue by wait reason, largest group first
+func (c *Config) WaitReasons() ([]WaitReasonGroup, error) {
+	type queuedBuilds struct {
+		Build []struct {
+			ID         int    `json:"id"`
+			WaitReason string `json:"waitReason"`
+		} `json:"build"`
+	}
+	qb := &queuedBuilds{}
+	u := "/httpAuth/app/rest/buildQueue?fields=" + url.QueryEscape("build(id,waitReason)")
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &qb)
+	if jerr != nil {
+		return nil, jerr
+	}
+	gi := make(map[string]int)
+	var gs []WaitReasonGroup
+	for _, b := range qb.Build {
+		wr := b.WaitReason
+		if wr == "" {
+			wr = "Unknown"
+		}
+		i, ok := gi[wr]
+		if !ok {
+			i = len(gs)
+			gi[wr] = i
+			gs = append(gs, WaitReasonGroup{WaitReason: wr})
+		}
+		gs[i].IDs = append(gs[i].IDs, b.ID)
+	}
+	sort.SliceStable(gs, func(i, j int) bool {
+		return len(gs[i].IDs) > len(gs[j].IDs)
+	})
+	return gs, nil
+}
+
+// WaitReasonsSummary returns a human readable summary of wait reason groups
+func WaitReasonsSummary(gs []WaitReasonGroup) string {
+	var n int
+	for _, g := range gs {
+		n += len(g.IDs)
+	}
+	bd := "Queued Builds: " + strconv.Itoa(n) + "\n"
+	for _, g := range gs {
+		bd += strconv.Itoa(len(g.IDs)) + ": " + g.WaitReason + "\n"
+	}
+	return bd
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestQueuedBuildDetails tests QueuedBuildDetails and WaitReasons against a stub server
+func TestQueuedBuildDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/httpAuth/app/rest/buildQueue/id:7":
+			w.Write([]byte(`{"id":7,"buildTypeId":"bt1","state":"queued","waitReason":"Build dependencies have not been built yet",
+				"compatibleAgents":{"count":1,"agent":[{"id":1,"name":"linux-1"}]},
+				"snapshot-dependencies":{"count":2,"build":[{"id":5,"state":"running"},{"id":6,"state":"finished"}]}}`))
+		case "/httpAuth/app/rest/agents":
+			w.Write([]byte(`{"count":1,"agent":[{"id":2,"name":"windows-1"}]}`))
+		case "/httpAuth/app/rest/agents/id:2/incompatibleBuildTypes":
+			w.Write([]byte(`{"compatibility":[{"buildType":{"id":"bt1"},"incompatibleReasons":{"data":["Unmet requirement: teamcity.agent.jvm.os.name contains Linux"]}}]}`))
+		case "/httpAuth/app/rest/buildQueue":
+			w.Write([]byte(`{"build":[{"id":7,"waitReason":"Build dependencies have not been built yet"},
+				{"id":8,"waitReason":"There are no idle compatible agents"},{"id":9,"waitReason":"There are no idle compatible agents"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	bd, err := c.QueuedBuildDetails(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bd.CompatibleAgents) != 1 || len(bd.BlockingDependencies) != 1 || bd.BlockingDependencies[0].ID != 5 {
+		t.Errorf("unexpected details: %+v", bd)
+	}
+	if len(bd.IncompatibleAgents) != 1 || len(bd.IncompatibleAgents[0].Reasons) != 1 {
+		t.Errorf("unexpected incompatible agents: %+v", bd.IncompatibleAgents)
+	}
+	gs, err := c.WaitReasons()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gs) != 2 || gs[0].WaitReason != "There are no idle compatible agents" || len(gs[0].IDs) != 2 {
+		t.Errorf("unexpected wait reason groups: %+v", gs)
+	}
+	t.Log(WaitReasonsSummary(gs))
+}
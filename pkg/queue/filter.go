@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"strings"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// QueueFilter selects queued builds. Empty fields match everything.
+type QueueFilter struct {
+	// Project matches builds in the project and its subprojects
+	Project string
+	// BuildType matches builds for a single buildType ID
+	BuildType string
+	// Branch matches the build branch name
+	Branch string
+	// User matches the username that triggered the build. Builds without
+	// a triggering user, such as VCS or schedule triggered builds, never match.
+	User string
+	// QueuedBefore matches builds queued before the cutoff time
+	QueuedBefore time.Time
+	// Locator is appended as-is to the buildQueue locator
+	Locator string
+	// Match is an additional predicate applied to each queued build
+	Match func(build.Build) bool
+}
+
+// ClearResult contains the outcome of clearing the queue
+type ClearResult struct {
+	DryRun bool `json:"dryRun"`
+	// Builds are the queued builds that matched the filter
+	Builds []build.Build `json:"builds"`
+	// Cancelled are the cancelled IDs, or the IDs that would be cancelled in a dry run
+	Cancelled []int          `json:"cancelled"`
+	Failed    []ClearFailure `json:"failed"`
+	// Skipped builds left the queue before they could be cancelled
+	Skipped []int `json:"skipped"`
+	// NotAudited are cancelled builds whose audit record could not be written
+	NotAudited []ClearFailure `json:"notAudited,omitempty"`
+}
+
+// ClearFailure contains a queued build that could not be cancelled
+type ClearFailure struct {
+	ID    int    `json:"id"`
+	Error string `json:"error"`
+}
+
+// QueueLocator returns the buildQueue locator for the server-side parts of the filter
+func (f *QueueFilter) QueueLocator() string {
+	if f == nil {
+		return ""
+	}
+	var ls []string
+	if f.Project != "" {
+		ls = append(ls, "affectedProject:(id:"+f.Project+")")
+	}
+	if f.BuildType != "" {
+		ls = append(ls, "buildType:(id:"+f.BuildType+")")
+	}
+	if f.User != "" {
+		ls = append(ls, "user:(username:"+f.User+")")
+	}
+	if f.Locator != "" {
+		ls = append(ls, f.Locator)
+	}
+	return strings.Join(ls, ",")
+}
+
+// Matches checks if queued build b matches the client-side parts of the filter
+func (f *QueueFilter) Matches(b build.Build) bool {
+	if f == nil {
+		return true
+	}
+	if f.BuildType != "" && b.BuildTypeID != f.BuildType {
+		return false
+	}
+	if f.Branch != "" && b.BranchName != f.Branch {
+		return false
+	}
+	if f.User != "" && b.Triggered.User.Username != f.User {
+		return false
+	}
+	if !f.QueuedBefore.IsZero() {
+		qd, err := build.ParseTime(b.QueuedDate)
+		if err != nil || !qd.Before(f.QueuedBefore) {
+			return false
+		}
+	}
+	if f.Match != nil && !f.Match(b) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// failingSink fails to write every audit record
+type failingSink struct{}
+
+// Audit returns an error
+func (failingSink) Audit(r teamcity.AuditRecord) error {
+	return errors.New("disk full")
+}
+
+// TestQueueFilter tests QueueLocator and Matches
+func TestQueueFilter(t *testing.T) {
+	f := &QueueFilter{Project: "Proj", User: "alice", Locator: "personal:false"}
+	if l := f.QueueLocator(); l != "affectedProject:(id:Proj),user:(username:alice),personal:false" {
+		t.Errorf("unexpected locator %s", l)
+	}
+	alice := build.Build{}
+	alice.Triggered.User.Username = "alice"
+	if !f.Matches(alice) {
+		t.Error("expected build triggered by alice to match")
+	}
+	if f.Matches(build.Build{}) {
+		t.Error("expected build without a triggering user not to match a user filter")
+	}
+	var nf *QueueFilter
+	if nf.QueueLocator() != "" || !nf.Matches(build.Build{}) {
+		t.Error("nil filter should match everything")
+	}
+	cutoff := time.Date(2019, 2, 25, 12, 0, 0, 0, time.UTC)
+	f = &QueueFilter{Branch: "main", QueuedBefore: cutoff}
+	if !f.Matches(build.Build{BranchName: "main", QueuedDate: "20190225T110000+0000"}) {
+		t.Error("expected build queued before cutoff to match")
+	}
+	if f.Matches(build.Build{BranchName: "main", QueuedDate: "20190225T130000+0000"}) {
+		t.Error("expected build queued after cutoff not to match")
+	}
+	if f.Matches(build.Build{BranchName: "feature", QueuedDate: "20190225T110000+0000"}) {
+		t.Error("expected build on another branch not to match")
+	}
+}
+
+// TestClearQueueFiltered tests ClearQueueFiltered reporting against a stub server
+func TestClearQueueFiltered(t *testing.T) {
+	var mu sync.Mutex
+	var cancelled []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/httpAuth/app/rest/buildQueue":
+			if !strings.Contains(r.URL.Query().Get("locator"), "buildType:(id:bt1)") {
+				t.Errorf("missing buildType locator: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"count":3,"build":[{"id":1,"buildTypeId":"bt1"},{"id":2,"buildTypeId":"bt1"},{"id":3,"buildTypeId":"bt1"}]}`))
+		case r.Method == "POST" && r.URL.Path == "/httpAuth/app/rest/buildQueue/id:1":
+			mu.Lock()
+			cancelled = append(cancelled, "1")
+			mu.Unlock()
+		case r.Method == "POST" && r.URL.Path == "/httpAuth/app/rest/buildQueue/id:3":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case r.Method == "DELETE":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), DryRun: true}
+	f := &QueueFilter{BuildType: "bt1"}
+	cr, err := c.ClearQueueFiltered(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Cancelled) != 3 || len(cancelled) != 0 {
+		t.Errorf("dry run cancelled %v, reported %v", cancelled, cr.Cancelled)
+	}
+	c.DryRun = false
+	cr, err = c.ClearQueueFiltered(f)
+	if err == nil {
+		t.Error("expected error for failed cancellation")
+	}
+	sort.Ints(cr.Cancelled)
+	if len(cr.Cancelled) != 1 || cr.Cancelled[0] != 1 {
+		t.Errorf("cancelled %v, want [1]", cr.Cancelled)
+	}
+	if len(cr.Skipped) != 1 || cr.Skipped[0] != 2 {
+		t.Errorf("skipped %v, want [2]", cr.Skipped)
+	}
+	if len(cr.Failed) != 1 || cr.Failed[0].ID != 3 {
+		t.Errorf("failed %v, want [3]", cr.Failed)
+	}
+	c.Client.Audit = failingSink{}
+	cr, _ = c.ClearQueueFiltered(f)
+	if len(cr.Cancelled) != 1 || cr.Cancelled[0] != 1 || len(cr.NotAudited) != 1 || cr.NotAudited[0].ID != 1 {
+		t.Errorf("unaudited cancel reported as %+v", cr)
+	}
+	if len(cr.Failed) != 1 || cr.Failed[0].ID != 3 {
+		t.Errorf("failed %v, want [3]", cr.Failed)
+	}
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+)
+
+// Less reports whether queued build a should run before queued build b
+type Less func(a, b build.Build) bool
+
+// PriorityClass groups buildTypes that should run before lower priority classes.
+// TeamCity does not expose its priority classes through the REST API, so
+// classes are applied by reordering the builds queued at the time; they are
+// not kept on the server.
+type PriorityClass struct {
+	Name       string   `json:"name"`
+	Priority   int      `json:"priority"`
+	BuildTypes []string `json:"buildTypes"`
+}
+
+// queueBuildRef references a queued build by ID
+type queueBuildRef struct {
+	ID int `json:"id"`
+}
+
+// SetQueuePosition moves queued build i to position p, starting at 1
+func (c *Config) SetQueuePosition(i int, p int) error {
+	jd, jerr := json.Marshal(queueBuildRef{ID: i})
+	if jerr != nil {
+		return jerr
+	}
+	u := "/httpAuth/app/rest/buildQueue/order/" + strconv.Itoa(p)
+	_, err := c.Client.HTTPRequestWithType("PUT", u, jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MoveToTop moves queued build i to the top of the queue
+func (c *Config) MoveToTop(i int) error {
+	return c.SetQueuePosition(i, 1)
+}
+
+// SetQueueOrder sets the queue order to IDs ids. Queued builds not in ids
+// are left after the given builds.
+func (c *Config) SetQueueOrder(ids []int) error {
+	type queueOrder struct {
+		Build []queueBuildRef `json:"build"`
+	}
+	qo := &queueOrder{}
+	for _, i := range ids {
+		qo.Build = append(qo.Build, queueBuildRef{ID: i})
+	}
+	jd, jerr := json.Marshal(qo)
+	if jerr != nil {
+		return jerr
+	}
+	_, err := c.Client.HTTPRequestWithType("PUT", "/httpAuth/app/rest/buildQueue/order", jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reorder sorts the queue with comparator l and returns the new order.
+// Builds that compare equal keep their current order.
+// If DryRun is set, the new order is returned but not applied.
+func (c *Config) Reorder(l Less) ([]int, error) {
+	bs, err := c.ActiveQueue()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bs, func(i, j int) bool {
+		return l(bs[i], bs[j])
+	})
+	var ids []int
+	for _, b := range bs {
+		ids = append(ids, b.ID)
+	}
+	if c.DryRun || len(ids) == 0 {
+		return ids, nil
+	}
+	return ids, c.SetQueueOrder(ids)
+}
+
+// ApplyPriorityClasses reorders the current queue once so builds in higher
+// priority classes run first. Builds queued later are placed by TeamCity as
+// usual, so call it again, for example on a timer, to keep the order.
+func (c *Config) ApplyPriorityClasses(pcs []PriorityClass) ([]int, error) {
+	return c.Reorder(ByPriorityClass(pcs))
+}
+
+// Chain returns a comparator that applies ls in order until one of them decides
+func Chain(ls ...Less) Less {
+	return func(a, b build.Build) bool {
+		for _, l := range ls {
+			if l(a, b) {
+				return true
+			}
+			if l(b, a) {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// OldestFirst orders builds by queued date, oldest first
+func OldestFirst(a, b build.Build) bool {
+	ad, aerr := build.ParseTime(a.QueuedDate)
+	bd, berr := build.ParseTime(b.QueuedDate)
+	if aerr != nil || berr != nil {
+		return aerr == nil && berr != nil
+	}
+	return ad.Before(bd)
+}
+
+// BranchPrefixFirst orders builds on branches starting with any of prefixes first
+func BranchPrefixFirst(prefixes ...string) Less {
+	m := func(b build.Build) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(b.BranchName, p) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(a, b build.Build) bool {
+		return m(a) && !m(b)
+	}
+}
+
+// ByPriorityClass orders builds by the priority of their buildType's class,
+// buildTypes without a class have priority 0
+func ByPriorityClass(pcs []PriorityClass) Less {
+	pr := make(map[string]int)
+	for _, pc := range pcs {
+		for _, bt := range pc.BuildTypes {
+			pr[bt] = pc.Priority
+		}
+	}
+	return func(a, b build.Build) bool {
+		return pr[a.BuildTypeID] > pr[b.BuildTypeID]
+	}
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestReorder tests Reorder with a release-first, oldest-first policy
+func TestReorder(t *testing.T) {
+	var order string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/buildQueue":
+			w.Write([]byte(`{"build":[
+				{"id":1,"buildTypeId":"pr","branchName":"pull/1","queuedDate":"20190225T100000+0000"},
+				{"id":2,"buildTypeId":"rel","branchName":"release/2.0","queuedDate":"20190225T120000+0000"},
+				{"id":3,"buildTypeId":"pr","branchName":"pull/2","queuedDate":"20190225T090000+0000"},
+				{"id":4,"buildTypeId":"rel","branchName":"release/1.9","queuedDate":"20190225T110000+0000"}]}`))
+		case r.Method == "PUT" && r.URL.Path == "/httpAuth/app/rest/buildQueue/order":
+			bd, _ := ioutil.ReadAll(r.Body)
+			order = string(bd)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	ids, err := c.Reorder(Chain(BranchPrefixFirst("release/"), OldestFirst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{4, 2, 3, 1}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("order = %v, want %v", ids, want)
+		}
+	}
+	if order != `{"build":[{"id":4},{"id":2},{"id":3},{"id":1}]}` {
+		t.Errorf("unexpected order request %s", order)
+	}
+	order = ""
+	c.DryRun = true
+	ids, err = c.ApplyPriorityClasses([]PriorityClass{{Name: "release", Priority: 10, BuildTypes: []string{"rel"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[0] != 2 || ids[1] != 4 || order != "" {
+		t.Errorf("priority order = %v, request %q", ids, order)
+	}
+}
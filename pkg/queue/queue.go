@@ -2,6 +2,9 @@ package queue
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/url"
 	"strconv"
 
 	"github.com/robertlestak/go-teamcity/pkg/build"
@@ -12,15 +15,30 @@ import (
 type Config struct {
 	Client       *teamcity.Client
 	CancelReason string
+	// DryRun reports the builds ClearQueue would cancel, or the order Reorder
+	// and ApplyPriorityClasses would set, without changing the queue
+	DryRun bool
 }
 
+// queueFields are the build fields requested for queued builds
+const queueFields = "count,build(id,buildTypeId,state,branchName,queuedDate,href,webUrl,triggered(type,date,user(id,username,name)))"
+
 // ActiveQueue returns list of all queued builds
 func (c *Config) ActiveQueue() ([]build.Build, error) {
+	return c.ActiveQueueFiltered(nil)
+}
+
+// ActiveQueueFiltered returns list of queued builds matching filter f
+func (c *Config) ActiveQueueFiltered(f *QueueFilter) ([]build.Build, error) {
 	type queuedBuilds struct {
 		Build []build.Build `json:"build"`
 	}
 	qb := &queuedBuilds{}
-	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildQueue", nil)
+	u := "/httpAuth/app/rest/buildQueue?fields=" + url.QueryEscape(queueFields)
+	if l := f.QueueLocator(); l != "" {
+		u += "&locator=" + url.QueryEscape(l)
+	}
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +46,13 @@ func (c *Config) ActiveQueue() ([]build.Build, error) {
 	if jerr != nil {
 		return nil, jerr
 	}
-	return qb.Build, nil
+	var bs []build.Build
+	for _, b := range qb.Build {
+		if f.Matches(b) {
+			bs = append(bs, b)
+		}
+	}
+	return bs, nil
 }
 
 // ActiveIDs returns just IDs for queued builds
@@ -44,11 +68,18 @@ func (c *Config) ActiveIDs() ([]int, error) {
 	return i, nil
 }
 
-// CancelBuild cancels a given build ID
+// CancelBuild cancels a given queued build ID
 func (c *Config) CancelBuild(i int, cr string) ([]byte, error) {
-	crs := "<buildCancelRequest comment='" + cr + "' readdIntoQueue='false'/>"
-	c.Client.ContentType = "application/xml"
-	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/builds/id:"+strconv.Itoa(i), []byte(crs))
+	type buildCancelRequest struct {
+		XMLName        xml.Name `xml:"buildCancelRequest"`
+		Comment        string   `xml:"comment,attr"`
+		ReaddIntoQueue bool     `xml:"readdIntoQueue,attr"`
+	}
+	crs, xerr := xml.Marshal(buildCancelRequest{Comment: cr})
+	if xerr != nil {
+		return nil, xerr
+	}
+	rd, err := c.Client.HTTPRequestWithType("POST", "/httpAuth/app/rest/buildQueue/id:"+strconv.Itoa(i), crs, c.Client.Accept, "application/xml")
 	if err != nil {
 		return nil, err
 	}
@@ -80,34 +111,73 @@ func (c *Config) CancelAndDeleteBuild(i int, cr string) ([]byte, error) {
 	return od, nil
 }
 
+// cancelResult contains the result of a single cancel and delete request
+type cancelResult struct {
+	ID  int
+	Err error
+}
+
 // cancelAndDeleteWorker concurrent worker for mass cancel and delete requests
-func cancelAndDeleteWorker(c *Config, req chan int, res chan int) {
+func cancelAndDeleteWorker(c *Config, req chan int, res chan cancelResult) {
 	for r := range req {
-		c.CancelAndDeleteBuild(r, c.CancelReason)
-		res <- r
+		_, err := c.CancelBuild(r, c.CancelReason)
+		// a cancel that was made but not audited still goes on to the delete
+		if err == nil || teamcity.IsAuditError(err) {
+			// the cancelled build may already have been cleaned up
+			_, derr := c.DeleteBuild(r)
+			if derr != nil && !teamcity.IsNotFound(derr) && (err == nil || !teamcity.IsAuditError(derr)) {
+				err = derr
+			}
+		}
+		res <- cancelResult{ID: r, Err: err}
 	}
 }
 
 // ClearQueue clears all builds in queue
 func (c *Config) ClearQueue() error {
-	ids, err := c.ActiveIDs()
+	_, err := c.ClearQueueFiltered(nil)
+	return err
+}
+
+// ClearQueueFiltered clears all queued builds matching filter f.
+// If DryRun is set, the matching builds are reported but not cancelled.
+func (c *Config) ClearQueueFiltered(f *QueueFilter) (*ClearResult, error) {
+	bs, err := c.ActiveQueueFiltered(f)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(ids) == 0 {
-		return nil
+	cr := &ClearResult{DryRun: c.DryRun, Builds: bs}
+	if c.DryRun || len(bs) == 0 {
+		for _, b := range bs {
+			cr.Cancelled = append(cr.Cancelled, b.ID)
+		}
+		return cr, nil
 	}
-	req := make(chan int, len(ids))
-	res := make(chan int, len(ids))
-	for i := 0; i <= 100; i++ {
+	req := make(chan int, len(bs))
+	res := make(chan cancelResult, len(bs))
+	for i := 0; i <= 100 && i < len(bs); i++ {
 		go cancelAndDeleteWorker(c, req, res)
 	}
-	for j := 0; j < len(ids); j++ {
-		req <- ids[j]
+	for j := 0; j < len(bs); j++ {
+		req <- bs[j].ID
 	}
 	close(req)
-	for a := 0; a < len(ids); a++ {
-		<-res
+	for a := 0; a < len(bs); a++ {
+		r := <-res
+		switch {
+		case r.Err == nil:
+			cr.Cancelled = append(cr.Cancelled, r.ID)
+		case teamcity.IsAuditError(r.Err):
+			cr.Cancelled = append(cr.Cancelled, r.ID)
+			cr.NotAudited = append(cr.NotAudited, ClearFailure{ID: r.ID, Error: r.Err.Error()})
+		case teamcity.IsNotFound(r.Err):
+			cr.Skipped = append(cr.Skipped, r.ID)
+		default:
+			cr.Failed = append(cr.Failed, ClearFailure{ID: r.ID, Error: r.Err.Error()})
+		}
+	}
+	if len(cr.Failed) > 0 {
+		return cr, errors.New(strconv.Itoa(len(cr.Failed)) + " of " + strconv.Itoa(len(bs)) + " queued builds could not be cancelled")
 	}
-	return nil
+	return cr, nil
 }
@@ -2,26 +2,56 @@ package queue
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/robertlestak/go-teamcity/pkg/cassette"
 	"github.com/robertlestak/go-teamcity/pkg/teamcity"
 )
 
+// testClient returns a client replaying cassette testdata/n.json, or recording
+// it from TEAMCITY_HOST when TEAMCITY_RECORD is set
+func testClient(t *testing.T, n string) (*teamcity.Client, *cassette.Cassette) {
+	cs, err := cassette.Open(filepath.Join("testdata", n+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := teamcity.New(cs.Host(os.Getenv("TEAMCITY_HOST")), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc.Transport = cs
+	return tc, cs
+}
+
+// saveCassette saves cassette cs if it was recorded
+func saveCassette(t *testing.T, cs *cassette.Cassette) {
+	if err := cs.Save(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestActiveQueue(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "active_queue")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
-	_, err := c.ActiveQueue()
+	bs, err := c.ActiveQueue()
 	if err != nil {
 		t.Error(err)
 	}
+	if cs.Mode() == cassette.ModeReplay && (len(bs) != 2 || bs[0].ID != 4214 || bs[0].BranchName != "feature/refunds" ||
+		bs[0].Triggered.User.Username != "jdoe" || bs[1].BuildTypeID != "Payments_Build") {
+		t.Errorf("unexpected queue %+v", bs)
+	}
 }
 
 func TestActiveIDs(t *testing.T) {
-	tc := teamcity.New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	tc, cs := testClient(t, "active_ids")
+	defer saveCassette(t, cs)
 	c := &Config{Client: tc}
 	ids, err := c.ActiveIDs()
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("Current Queue IDs: %d", len(ids))
+	if cs.Mode() == cassette.ModeReplay && (len(ids) != 2 || ids[0] != 4214 || ids[1] != 4215) {
+		t.Errorf("queue IDs = %v, want [4214 4215]", ids)
+	}
 }
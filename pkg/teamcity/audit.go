@@ -0,0 +1,148 @@
+package teamcity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditOK is the Result of a request that succeeded
+const AuditOK = "ok"
+
+// MaxAuditBody is the longest request body kept in an AuditRecord
+const MaxAuditBody = 256
+
+// AuditRecord is a record of a request that changed, or tried to change, the server
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// OSUser is the local user running the process
+	OSUser string `json:"osUser,omitempty"`
+	// User is the TeamCity user the request was made as
+	User     string `json:"user,omitempty"`
+	Host     string `json:"host"`
+	Method   string `json:"method"`
+	Resource string `json:"resource"`
+	// Digest is the hex encoded SHA-256 of the request body, empty if there was none
+	Digest string `json:"digest,omitempty"`
+	// Body is the request body if it is at most MaxAuditBody bytes and the
+	// resource does not look like it holds a secret
+	Body string `json:"body,omitempty"`
+	// Status is the HTTP status, 0 if no response was received
+	Status int `json:"status,omitempty"`
+	// Result is AuditOK or the error the request returned
+	Result string `json:"result"`
+}
+
+// AuditError is returned with the response of a request that succeeded
+// but whose audit record could not be written
+type AuditError struct {
+	Record AuditRecord
+	Err    error
+}
+
+// Error returns the error message
+func (e *AuditError) Error() string {
+	return e.Record.Method + " " + e.Record.Resource + " succeeded but was not audited: " + e.Err.Error()
+}
+
+// IsAuditError checks if err only reports a failed audit record
+func IsAuditError(err error) bool {
+	_, ok := err.(*AuditError)
+	return ok
+}
+
+// AuditSink receives a record of every request other than GET a client sends
+type AuditSink interface {
+	Audit(r AuditRecord) error
+}
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// osUser returns the local username, replaced in tests
+var osUser = func() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// tokenUsers caches the TeamCity usernames of access tokens by host and token
+var tokenUsers = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Digest returns the hex encoded SHA-256 of body b, or "" if b is empty
+func Digest(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// auditBody returns body b of a request to u as kept in an audit record
+func auditBody(u string, b []byte) string {
+	l := strings.ToLower(u)
+	if len(b) > MaxAuditBody || strings.Contains(l, "secure") || strings.Contains(l, "password") {
+		return ""
+	}
+	return string(b)
+}
+
+// audit writes a record of request m to u with body b that returned status st
+// and error err. If only writing the record fails an *AuditError is returned.
+func (c *Client) audit(m string, u string, b []byte, st int, err error) error {
+	r := AuditRecord{
+		Time:     now().UTC(),
+		OSUser:   osUser(),
+		User:     c.auditUser(),
+		Host:     c.Host,
+		Method:   m,
+		Resource: u,
+		Digest:   Digest(b),
+		Body:     auditBody(u, b),
+		Status:   st,
+		Result:   AuditOK,
+	}
+	if err != nil {
+		r.Result = err.Error()
+	}
+	if aerr := c.Audit.Audit(r); aerr != nil {
+		return &AuditError{Record: r, Err: aerr}
+	}
+	return nil
+}
+
+// auditUser returns the TeamCity user requests are made as. With token
+// auth the user is looked up once per token and is empty if that fails.
+func (c *Client) auditUser() string {
+	if c.Token == "" {
+		return c.User
+	}
+	k := c.Host + "\x00" + c.Token
+	tokenUsers.Lock()
+	n, ok := tokenUsers.m[k]
+	tokenUsers.Unlock()
+	if ok {
+		return n
+	}
+	type currentUser struct {
+		Username string `json:"username"`
+	}
+	cu := &currentUser{}
+	rd, err := c.HTTPRequestWithType("GET", "/httpAuth/app/rest/users/current", nil, "application/json", "")
+	if err != nil || json.Unmarshal(rd, cu) != nil {
+		return ""
+	}
+	tokenUsers.Lock()
+	tokenUsers.m[k] = cu.Username
+	tokenUsers.Unlock()
+	return cu.Username
+}
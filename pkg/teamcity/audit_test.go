@@ -0,0 +1,92 @@
+package teamcity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sink collects audit records
+type sink struct {
+	rs  []AuditRecord
+	err error
+}
+
+// Audit appends record r
+func (s *sink) Audit(r AuditRecord) error {
+	s.rs = append(s.rs, r)
+	return s.err
+}
+
+// TestAudit tests the records written for mutating requests
+func TestAudit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/httpAuth/app/rest/users/current":
+			w.Write([]byte(`{"username":"deploy-bot"}`))
+		case r.Method == "DELETE":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("true"))
+		}
+	}))
+	defer ts.Close()
+	t0 := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	defer func(n func() time.Time, u func() string) { now, osUser = n, u }(now, osUser)
+	now = func() time.Time { return t0 }
+	osUser = func() string { return "alice" }
+
+	s := &sink{}
+	c := New(ts.URL, "ci", "secret")
+	c.Audit = s
+	if _, err := c.HTTPRequest("GET", "/httpAuth/app/rest/buildQueue", nil); err != nil {
+		t.Fatal(err)
+	}
+	u := "/httpAuth/app/rest/buildTypes/id:Payments_Build/paused"
+	if _, err := c.HTTPRequestWithType("PUT", u, []byte("true"), "text/plain", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.HTTPRequest("DELETE", "/httpAuth/app/rest/builds/id:9", nil); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if len(s.rs) != 2 {
+		t.Fatalf("audited %d requests, want 2: %+v", len(s.rs), s.rs)
+	}
+	want := AuditRecord{Time: t0, OSUser: "alice", User: "ci", Host: ts.URL, Method: "PUT", Resource: u,
+		Digest: "b5bea41b6c623f7c09f1bf24dcae58ebab3c0cdd90ad966bc43a45b44867e12b", Body: "true", Status: 200, Result: AuditOK}
+	if s.rs[0] != want {
+		t.Errorf("record = %+v, want %+v", s.rs[0], want)
+	}
+	if r := s.rs[1]; r.Status != http.StatusNotFound || r.Digest != "" || r.Result == AuditOK {
+		t.Errorf("failed request record = %+v", r)
+	}
+
+	tc := &Client{Host: ts.URL, Token: "t0ken", Audit: s}
+	tc.DryRun = NewPlan(nil)
+	if _, err := tc.HTTPRequest("DELETE", "/httpAuth/app/rest/builds/id:9", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.rs) != 2 {
+		t.Errorf("dry run request was audited: %+v", s.rs[2:])
+	}
+	tc.DryRun = nil
+	s.err = errors.New("disk full")
+	bd, err := tc.HTTPRequestWithType("PUT", u, []byte("false"), "text/plain", "text/plain")
+	if !IsAuditError(err) || err.(*AuditError).Err.Error() != "disk full" {
+		t.Errorf("expected audit error, got %v", err)
+	}
+	if string(bd) != "true" {
+		t.Errorf("response not returned with audit error: %q", bd)
+	}
+	if _, err := tc.HTTPRequestWithType("PUT", "/httpAuth/app/rest/vcs-roots/id:r/properties/secure:password", []byte("pw"), "text/plain", "text/plain"); !IsAuditError(err) {
+		t.Errorf("expected audit error, got %v", err)
+	}
+	if r := s.rs[len(s.rs)-1]; r.Body != "" || r.Digest == "" {
+		t.Errorf("secret body kept in record: %+v", r)
+	}
+	if r := s.rs[len(s.rs)-1]; r.User != "deploy-bot" {
+		t.Errorf("token user = %s", r.User)
+	}
+}
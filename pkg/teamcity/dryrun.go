@@ -0,0 +1,88 @@
+package teamcity
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PlannedRequest is a mutating request skipped in dry-run mode
+type PlannedRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// String returns the request as "METHOD URL body"
+func (r PlannedRequest) String() string {
+	s := r.Method + " " + r.URL
+	if r.Body != "" {
+		s += " " + r.Body
+	}
+	return s
+}
+
+// Plan collects the requests a client in dry-run mode would have sent.
+// Set it as the DryRun of a Client.
+type Plan struct {
+	// Log receives a line for each request as it is planned, if set
+	Log      io.Writer
+	mu       sync.Mutex
+	requests []PlannedRequest
+}
+
+// NewPlan returns an empty plan logging planned requests to w, which may be nil
+func NewPlan(w io.Writer) *Plan {
+	return &Plan{Log: w}
+}
+
+// add appends request r to the plan and logs it
+func (p *Plan) add(r PlannedRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, r)
+	if p.Log != nil {
+		fmt.Fprintln(p.Log, "dry run: "+r.String())
+	}
+}
+
+// Requests returns the planned requests in the order they were made
+func (p *Plan) Requests() []PlannedRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PlannedRequest(nil), p.requests...)
+}
+
+// String returns the planned requests, one per line
+func (p *Plan) String() string {
+	var ls []string
+	for _, r := range p.Requests() {
+		ls = append(ls, r.String()+"\n")
+	}
+	return strings.Join(ls, "")
+}
+
+// plan records non-GET request m to u with body b, Accept a and Content-Type ct
+// and returns a synthetic response. The body is echoed back when its type
+// matches the accepted type, as TeamCity does for created and updated
+// resources, otherwise JSON requests get an empty object.
+func (p *Plan) plan(m string, u string, b []byte, a string, ct string) []byte {
+	p.add(PlannedRequest{Method: m, URL: u, ContentType: ct, Body: string(b)})
+	if len(b) > 0 && mediaType(a) == mediaType(ct) {
+		return b
+	}
+	if mediaType(a) == "application/json" && m != "DELETE" {
+		return []byte("{}")
+	}
+	return nil
+}
+
+// mediaType returns content type t without parameters
+func mediaType(t string) string {
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
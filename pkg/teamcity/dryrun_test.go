@@ -0,0 +1,68 @@
+package teamcity
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestDryRun tests that only GET requests are sent and the rest are planned
+func TestDryRun(t *testing.T) {
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"count":0}`))
+	}))
+	defer ts.Close()
+	var log bytes.Buffer
+	c := New(ts.URL, "", "")
+	c.DryRun = NewPlan(&log)
+
+	if rd, err := c.HTTPRequest("GET", "/httpAuth/app/rest/buildQueue", nil); err != nil || string(rd) != `{"count":0}` {
+		t.Errorf("GET = %s, %v", rd, err)
+	}
+	tests := []struct {
+		m, u, b, a, ct string
+		want           string
+	}{
+		{"PUT", "/httpAuth/app/rest/buildTypes/id:Payments_Build/paused", "true", "text/plain", "text/plain", "true"},
+		{"POST", "/httpAuth/app/rest/agentPools", `{"name":"linux"}`, "application/json", "application/json", `{"name":"linux"}`},
+		{"POST", "/httpAuth/app/rest/buildQueue/id:3", `<buildCancelRequest comment="x"/>`, "application/json", "application/xml", "{}"},
+		{"DELETE", "/httpAuth/app/rest/builds/id:3", "", "application/json", "", ""},
+	}
+	for _, tt := range tests {
+		var b []byte
+		if tt.b != "" {
+			b = []byte(tt.b)
+		}
+		rd, err := c.HTTPRequestWithType(tt.m, tt.u, b, tt.a, tt.ct)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.m, tt.u, err)
+		}
+		if string(rd) != tt.want {
+			t.Errorf("%s %s = %q, want %q", tt.m, tt.u, rd, tt.want)
+		}
+	}
+	if want := []string{"GET /httpAuth/app/rest/buildQueue"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	ps := c.DryRun.Requests()
+	if len(ps) != len(tests) {
+		t.Fatalf("planned %d requests, want %d", len(ps), len(tests))
+	}
+	want := PlannedRequest{Method: "PUT", URL: "/httpAuth/app/rest/buildTypes/id:Payments_Build/paused", ContentType: "text/plain", Body: "true"}
+	if ps[0] != want {
+		t.Errorf("planned %+v, want %+v", ps[0], want)
+	}
+	if c.DryRun.String() != "PUT /httpAuth/app/rest/buildTypes/id:Payments_Build/paused true\n"+
+		"POST /httpAuth/app/rest/agentPools {\"name\":\"linux\"}\n"+
+		"POST /httpAuth/app/rest/buildQueue/id:3 <buildCancelRequest comment=\"x\"/>\n"+
+		"DELETE /httpAuth/app/rest/builds/id:3\n" {
+		t.Errorf("plan:\n%s", c.DryRun.String())
+	}
+	if !bytes.HasPrefix(log.Bytes(), []byte("dry run: PUT ")) || bytes.Count(log.Bytes(), []byte("\n")) != len(tests) {
+		t.Errorf("log:\n%s", log.String())
+	}
+}
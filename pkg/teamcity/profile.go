@@ -0,0 +1,203 @@
+package teamcity
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Auth types
+const (
+	AuthBasic = "basic"
+	AuthToken = "token"
+)
+
+// Profiles contains named TeamCity servers, similar to a kubeconfig
+type Profiles struct {
+	// Current is the profile used when no name is given
+	Current  string    `yaml:"current"`
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// Profile contains the connection settings of a TeamCity server
+type Profile struct {
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+	// Auth is AuthBasic, the default, or AuthToken
+	Auth           string      `yaml:"auth,omitempty"`
+	User           string      `yaml:"user,omitempty"`
+	DefaultProject string      `yaml:"defaultProject,omitempty"`
+	Credentials    Credentials `yaml:"credentials"`
+}
+
+// Credentials describes where the password or token of a profile comes from.
+// Exactly one source must be set.
+type Credentials struct {
+	// Value is the secret itself
+	Value string `yaml:"value,omitempty"`
+	// Env is the name of an environment variable holding the secret
+	Env string `yaml:"env,omitempty"`
+	// File is a file holding the secret
+	File string `yaml:"file,omitempty"`
+	// Command is run without a shell and its output is the secret,
+	// for example [pass, show, teamcity/prod]
+	Command []string `yaml:"command,omitempty"`
+}
+
+// ProfilesFile returns the profiles file path, from TEAMCITY_PROFILES
+// or teamcity/profiles.yaml in the user config dir
+func ProfilesFile() (string, error) {
+	if f := os.Getenv("TEAMCITY_PROFILES"); f != "" {
+		return f, nil
+	}
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "teamcity", "profiles.yaml"), nil
+}
+
+// LoadProfiles reads profiles from file f
+func LoadProfiles(f string) (*Profiles, error) {
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	ps := &Profiles{}
+	yerr := yaml.UnmarshalStrict(bd, ps)
+	if yerr != nil {
+		return nil, errors.New(f + ": " + yerr.Error())
+	}
+	return ps, nil
+}
+
+// Profile returns profile n, or the current profile if n is empty
+func (ps *Profiles) Profile(n string) (*Profile, error) {
+	if n == "" {
+		n = ps.Current
+	}
+	if n == "" {
+		return nil, errors.New("no profile given and no current profile set")
+	}
+	for i := range ps.Profiles {
+		if ps.Profiles[i].Name == n {
+			return &ps.Profiles[i], nil
+		}
+	}
+	return nil, errors.New("profile " + n + " not found")
+}
+
+// Client returns a client for the profile, resolving its credentials
+func (p *Profile) Client() (*Client, error) {
+	if p.Host == "" {
+		return nil, errors.New("profile " + p.Name + " has no host")
+	}
+	s, err := p.Credentials.Resolve()
+	if err != nil {
+		return nil, errors.New("profile " + p.Name + ": " + err.Error())
+	}
+	c := New(p.Host, p.User, "")
+	c.DefaultProject = p.DefaultProject
+	switch p.Auth {
+	case "", AuthBasic:
+		c.Pass = s
+	case AuthToken:
+		c.Token = s
+	default:
+		return nil, errors.New("profile " + p.Name + ": unknown auth type " + p.Auth)
+	}
+	return c, nil
+}
+
+// Resolve returns the secret from the configured source. It is an error if
+// no source or more than one is configured, or the source resolves to an
+// empty secret.
+func (cr Credentials) Resolve() (string, error) {
+	set := map[string]bool{
+		"value":   cr.Value != "",
+		"env":     cr.Env != "",
+		"file":    cr.File != "",
+		"command": len(cr.Command) > 0,
+	}
+	var srcs []string
+	for n, ok := range set {
+		if ok {
+			srcs = append(srcs, n)
+		}
+	}
+	if len(srcs) > 1 {
+		sort.Strings(srcs)
+		return "", errors.New("credentials have more than one source set: " + strings.Join(srcs, ", "))
+	}
+	switch {
+	case cr.Value != "":
+		return cr.Value, nil
+	case cr.Env != "":
+		v := os.Getenv(cr.Env)
+		if v == "" {
+			return "", errors.New("credentials env var " + cr.Env + " is not set")
+		}
+		return v, nil
+	case cr.File != "":
+		f := cr.File
+		if strings.HasPrefix(f, "~/") {
+			h, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			f = filepath.Join(h, f[2:])
+		}
+		bd, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		v := strings.TrimSpace(string(bd))
+		if v == "" {
+			return "", errors.New("credentials file " + cr.File + " is empty")
+		}
+		return v, nil
+	case len(cr.Command) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(cr.Command[0], cr.Command[1:]...)
+		cmd.Stderr = &stderr
+		bd, err := cmd.Output()
+		if err != nil {
+			return "", errors.New("credentials command " + cr.Command[0] + ": " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+		}
+		v := strings.TrimRight(string(bd), "\r\n")
+		if v == "" {
+			return "", errors.New("credentials command " + cr.Command[0] + " printed nothing")
+		}
+		return v, nil
+	}
+	return "", errors.New("no credentials configured, set value, env, file or command")
+}
+
+// NewFromProfile returns a client for profile n from the profiles file,
+// or for the current profile if n is empty. TEAMCITY_PROFILE selects the
+// profile when n is empty.
+func NewFromProfile(n string) (*Client, error) {
+	if n == "" {
+		n = os.Getenv("TEAMCITY_PROFILE")
+	}
+	f, err := ProfilesFile()
+	if err != nil {
+		return nil, err
+	}
+	ps, err := LoadProfiles(f)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ps.Profile(n)
+	if err != nil {
+		return nil, err
+	}
+	return p.Client()
+}
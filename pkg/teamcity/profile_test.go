@@ -0,0 +1,116 @@
+package teamcity
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeProfiles writes profiles file content pd to a temp dir and points TEAMCITY_PROFILES at it
+func writeProfiles(t *testing.T, d string, pd string) {
+	f := filepath.Join(d, "profiles.yaml")
+	if err := ioutil.WriteFile(f, []byte(pd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEAMCITY_PROFILES", f)
+}
+
+// TestNewFromProfile tests credential sources and auth types
+func TestNewFromProfile(t *testing.T) {
+	d, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	defer os.Unsetenv("TEAMCITY_PROFILES")
+	sf := filepath.Join(d, "secret")
+	if err := ioutil.WriteFile(sf, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEST_TEAMCITY_PASS", "from-env")
+	defer os.Unsetenv("TEST_TEAMCITY_PASS")
+	writeProfiles(t, d, `current: uat
+profiles:
+- name: uat
+  host: https://uat.example.com
+  user: ci
+  defaultProject: Payments
+  credentials:
+    env: TEST_TEAMCITY_PASS
+- name: prod
+  host: https://prod.example.com
+  user: ci
+  credentials:
+    file: `+sf+`
+- name: build
+  host: https://build.example.com
+  auth: token
+  credentials:
+    command: [echo, from-command]
+`)
+	tests := []struct {
+		name, host, pass, token, project string
+	}{
+		{"", "https://uat.example.com", "from-env", "", "Payments"},
+		{"prod", "https://prod.example.com", "from-file", "", ""},
+		{"build", "https://build.example.com", "", "from-command", ""},
+	}
+	for _, tt := range tests {
+		c, err := NewFromProfile(tt.name)
+		if err != nil {
+			t.Fatalf("profile %q: %v", tt.name, err)
+		}
+		if c.Host != tt.host || c.Pass != tt.pass || c.Token != tt.token || c.DefaultProject != tt.project {
+			t.Errorf("profile %q: unexpected client %+v", tt.name, c)
+		}
+	}
+	if _, err := NewFromProfile("staging"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+// TestResolveErrors tests that missing or empty credentials are errors
+func TestResolveErrors(t *testing.T) {
+	d, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	ef := filepath.Join(d, "empty")
+	if err := ioutil.WriteFile(ef, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("TEST_TEAMCITY_UNSET")
+	for _, cr := range []Credentials{
+		{},
+		{Env: "TEST_TEAMCITY_UNSET"},
+		{File: ef},
+		{Command: []string{"true"}},
+		{Value: "secret", Command: []string{"echo", "other"}},
+		{Env: "TEST_TEAMCITY_UNSET", File: ef},
+	} {
+		if v, err := cr.Resolve(); err == nil {
+			t.Errorf("%+v resolved to %q, expected error", cr, v)
+		}
+	}
+}
+
+// TestTokenAuth tests that a token is sent as a bearer token
+func TestTokenAuth(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+	c := New(ts.URL, "", "")
+	c.Token = "abc123"
+	if _, err := c.HTTPRequest("GET", "/httpAuth/app/rest/server", nil); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer abc123" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
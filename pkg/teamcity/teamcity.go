@@ -1,17 +1,63 @@
 package teamcity
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // Client is a TeamCity client
 type Client struct {
-	Host        string
-	User        string
-	Pass        string
-	Accept      string
-	ContentType string
+	Host string
+	User string
+	Pass string
+	// Token is an access token sent as a bearer token instead of User and Pass
+	Token string
+	// DefaultProject is the project tools operate on when none is given
+	DefaultProject string
+	Accept         string
+	ContentType    string
+	// Transport makes the HTTP requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// DryRun, if set, puts the client in dry-run mode: requests other than
+	// GET are added to the plan instead of being sent
+	DryRun *Plan
+	// Audit, if set, receives a record of every request other than GET.
+	// Requests planned in dry-run mode are not audited. If the record of a
+	// successful request cannot be written, the response is returned with
+	// an *AuditError.
+	Audit AuditSink
+}
+
+// HTTPError is returned when TeamCity responds with a non-2xx status
+type HTTPError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Body       []byte
+}
+
+// Error returns the error string
+func (e *HTTPError) Error() string {
+	s := e.Method + " " + e.URL + ": " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	if len(e.Body) > 0 {
+		s += ": " + string(bytes.TrimSpace(e.Body))
+	}
+	return s
+}
+
+// IsNotFound checks if err is a TeamCity 404 response
+func IsNotFound(err error) bool {
+	he, ok := err.(*HTTPError)
+	return ok && he.StatusCode == http.StatusNotFound
+}
+
+// SameHost checks if hosts a and b are the same server, ignoring trailing slashes
+func SameHost(a string, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
 }
 
 // New returns a new TeamCity client
@@ -25,27 +71,69 @@ func New(h string, u string, p string) *Client {
 
 // HTTPRequest is a generic HTTP Request to TeamCity
 func (c *Client) HTTPRequest(m string, u string, b []byte) ([]byte, error) {
-	hc := &http.Client{}
-	req, rerr := http.NewRequest("GET", c.Host+u, nil)
+	if c.Accept == "" {
+		c.Accept = "application/json"
+	}
+	return c.HTTPRequestWithType(m, u, b, c.Accept, c.ContentType)
+}
+
+// HTTPRequestWithType is a generic HTTP Request to TeamCity with
+// Accept a and Content-Type ct set for this request only
+func (c *Client) HTTPRequestWithType(m string, u string, b []byte, a string, ct string) ([]byte, error) {
+	var br io.Reader
+	if b != nil {
+		br = bytes.NewReader(b)
+	}
+	req, rerr := http.NewRequest(m, c.Host+u, br)
 	if rerr != nil {
 		return nil, rerr
 	}
-	if c.Accept == "" {
-		c.Accept = "application/json"
+	if a == "" {
+		a = "application/json"
+	}
+	if c.DryRun != nil && req.Method != "GET" && req.Method != "HEAD" {
+		return c.DryRun.plan(req.Method, u, b, a, ct), nil
 	}
-	req.Header.Set("Accept", c.Accept)
-	if c.ContentType != "" {
-		req.Header.Set("Content-Type", c.ContentType)
+	req.Header.Set("Accept", a)
+	if ct != "" {
+		req.Header.Set("Content-Type", ct)
 	}
-	req.SetBasicAuth(c.User, c.Pass)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		req.SetBasicAuth(c.User, c.Pass)
+	}
+	bd, st, err := c.send(req)
+	if err == nil && (st < 200 || st > 299) {
+		err = &HTTPError{
+			StatusCode: st,
+			Method:     m,
+			URL:        u,
+			Body:       bd,
+		}
+	}
+	if c.Audit != nil && req.Method != "GET" && req.Method != "HEAD" {
+		// the request has been made either way, so a failed audit
+		// record is only reported if the request itself succeeded, as
+		// an *AuditError returned with the response
+		if aerr := c.audit(req.Method, u, b, st, err); aerr != nil && err == nil {
+			err = aerr
+		}
+	}
+	return bd, err
+}
+
+// send makes request req and returns the response body and status
+func (c *Client) send(req *http.Request) ([]byte, int, error) {
+	hc := &http.Client{Transport: c.Transport}
 	res, err := hc.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer res.Body.Close()
 	bd, ierr := ioutil.ReadAll(res.Body)
 	if ierr != nil {
-		return nil, ierr
+		return nil, res.StatusCode, ierr
 	}
-	return bd, nil
+	return bd, res.StatusCode, nil
 }
@@ -1,20 +1,37 @@
 package teamcity
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/cassette"
 )
 
 func TestNew(t *testing.T) {
-	c := New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	c := New(cassette.Host, "user", "pass")
 	if c.Host == "" || c.User == "" || c.Pass == "" {
 		t.Error(errors.New("Host, User, Pass required"))
 	}
 }
 
 func TestHTTPRequest(t *testing.T) {
-	c := New(os.Getenv("TEAMCITY_HOST"), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	cs, cerr := cassette.Open(filepath.Join("testdata", "http_request.json"))
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	defer func() {
+		if err := cs.Save(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := New(cs.Host(os.Getenv("TEAMCITY_HOST")), os.Getenv("TEAMCITY_USER"), os.Getenv("TEAMCITY_PASS"))
+	c.Transport = cs
 	rd, err := c.HTTPRequest("GET", "/httpAuth/app/rest/builds?locator=running:true", nil)
 	if err != nil {
 		t.Error(err)
@@ -22,4 +39,57 @@ func TestHTTPRequest(t *testing.T) {
 	if len(rd) == 0 {
 		t.Error(errors.New("No HTTP Response"))
 	}
+	if cs.Mode() != cassette.ModeReplay {
+		return
+	}
+	type builds struct {
+		Count int `json:"count"`
+		Build []struct {
+			ID                 int `json:"id"`
+			PercentageComplete int `json:"percentageComplete"`
+		} `json:"build"`
+	}
+	bs := &builds{}
+	if err := json.Unmarshal(rd, bs); err != nil {
+		t.Fatal(err)
+	}
+	if bs.Count != 1 || len(bs.Build) != 1 || bs.Build[0].ID != 4211 || bs.Build[0].PercentageComplete != 62 {
+		t.Errorf("unexpected response %s", rd)
+	}
+}
+
+// TestHTTPRequestWithType tests that the method, body and types are sent and errors returned
+func TestHTTPRequestWithType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/httpAuth/app/rest/builds/id:9" {
+			http.Error(w, "No build found", http.StatusNotFound)
+			return
+		}
+		bd, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("Accept") + " " + r.Header.Get("Content-Type") + " " + string(bd)))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, "", "")
+	rd, err := c.HTTPRequestWithType("PUT", "/httpAuth/app/rest/buildTypes/id:bt1/paused", []byte("true"), "text/plain", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rd) != "PUT text/plain text/plain true" {
+		t.Errorf("server received %q", rd)
+	}
+	rd, err = c.HTTPRequest("POST", "/httpAuth/app/rest/buildQueue", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rd) != "POST application/json  {}" {
+		t.Errorf("server received %q", rd)
+	}
+	rd, err = c.HTTPRequest("GET", "/httpAuth/app/rest/builds/id:9", nil)
+	he, ok := err.(*HTTPError)
+	if !ok || !IsNotFound(err) || he.Method != "GET" || he.URL != "/httpAuth/app/rest/builds/id:9" {
+		t.Fatalf("expected not found HTTPError, got %v", err)
+	}
+	if string(rd) != "No build found\n" || he.Error() != "GET /httpAuth/app/rest/builds/id:9: 404 Not Found: No build found" {
+		t.Errorf("unexpected error body %q: %v", rd, he)
+	}
 }
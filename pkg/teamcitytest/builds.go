@@ -0,0 +1,613 @@
+package teamcitytest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build states
+const (
+	StateQueued   = "queued"
+	StateRunning  = "running"
+	StateFinished = "finished"
+)
+
+// Build is a seeded build. An empty State is queued.
+type Build struct {
+	ID                 int
+	BuildTypeID        string
+	Number             string
+	State              string
+	Status             string
+	StatusText         string
+	BranchName         string
+	PercentageComplete int
+	AgentID            int
+	// TriggeredBy is the username that triggered the build
+	TriggeredBy string
+	QueuedDate  time.Time
+	StartDate   time.Time
+	FinishDate  time.Time
+	Canceled    *Canceled
+}
+
+// Canceled contains cancellation data of a build
+type Canceled struct {
+	Comment string
+	User    string
+	Date    time.Time
+}
+
+// buildJSON is the REST representation of a build
+type buildJSON struct {
+	ID                 int            `json:"id"`
+	BuildTypeID        string         `json:"buildTypeId"`
+	Number             string         `json:"number,omitempty"`
+	Status             string         `json:"status,omitempty"`
+	StatusText         string         `json:"statusText,omitempty"`
+	State              string         `json:"state"`
+	BranchName         string         `json:"branchName,omitempty"`
+	PercentageComplete int            `json:"percentageComplete,omitempty"`
+	QueuedDate         string         `json:"queuedDate,omitempty"`
+	StartDate          string         `json:"startDate,omitempty"`
+	FinishDate         string         `json:"finishDate,omitempty"`
+	HREF               string         `json:"href"`
+	WebURL             string         `json:"webUrl"`
+	Triggered          *triggeredJSON `json:"triggered,omitempty"`
+	CanceledInfo       *canceledJSON  `json:"canceledInfo,omitempty"`
+	Agent              *agentRef      `json:"agent,omitempty"`
+}
+
+// triggeredJSON is the REST representation of a build trigger cause
+type triggeredJSON struct {
+	Type string   `json:"type"`
+	Date string   `json:"date,omitempty"`
+	User *userRef `json:"user,omitempty"`
+}
+
+// canceledJSON is the REST representation of build cancellation data
+type canceledJSON struct {
+	Text      string   `json:"text"`
+	Timestamp string   `json:"timestamp,omitempty"`
+	User      *userRef `json:"user,omitempty"`
+}
+
+// userRef references a user
+type userRef struct {
+	Username string `json:"username"`
+}
+
+// agentRef references an agent
+type agentRef struct {
+	ID int `json:"id"`
+}
+
+// builds is the REST build collection
+type builds struct {
+	Count int         `json:"count"`
+	Build []buildJSON `json:"build"`
+}
+
+// formatTime formats t as a TeamCity date, empty for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeFormat)
+}
+
+// buildJSON returns the REST representation of build b
+func (s *Server) buildJSON(b *Build) buildJSON {
+	id := strconv.Itoa(b.ID)
+	j := buildJSON{
+		ID:                 b.ID,
+		BuildTypeID:        b.BuildTypeID,
+		Number:             b.Number,
+		Status:             b.Status,
+		StatusText:         b.StatusText,
+		State:              b.State,
+		BranchName:         b.BranchName,
+		PercentageComplete: b.PercentageComplete,
+		QueuedDate:         formatTime(b.QueuedDate),
+		StartDate:          formatTime(b.StartDate),
+		FinishDate:         formatTime(b.FinishDate),
+		HREF:               "/app/rest/builds/id:" + id,
+		WebURL:             s.URL + "/viewLog.html?buildId=" + id,
+	}
+	if b.State == StateQueued {
+		j.HREF = "/app/rest/buildQueue/id:" + id
+		j.WebURL = s.URL + "/viewQueued.html?itemId=" + id
+	}
+	if b.TriggeredBy != "" {
+		j.Triggered = &triggeredJSON{Type: "user", Date: j.QueuedDate, User: &userRef{Username: b.TriggeredBy}}
+	}
+	if b.Canceled != nil {
+		j.CanceledInfo = &canceledJSON{Text: b.Canceled.Comment, Timestamp: formatTime(b.Canceled.Date)}
+		if b.Canceled.User != "" {
+			j.CanceledInfo.User = &userRef{Username: b.Canceled.User}
+		}
+	}
+	if b.AgentID != 0 {
+		j.Agent = &agentRef{ID: b.AgentID}
+	}
+	return j
+}
+
+// buildList returns builds bs as a REST collection
+func (s *Server) buildList(bs []*Build) builds {
+	l := builds{Build: []buildJSON{}}
+	for _, b := range bs {
+		l.Build = append(l.Build, s.buildJSON(b))
+	}
+	l.Count = len(l.Build)
+	return l
+}
+
+// buildDimensions are the supported builds locator dimensions
+var buildDimensions = []string{"id", "buildType", "affectedProject", "project", "branch", "status", "state", "running",
+	"canceled", "user", "agent", "sinceBuild", "finishDate", "count", "lookupLimit", "defaultFilter"}
+
+// queueDimensions are the supported buildQueue locator dimensions
+var queueDimensions = []string{"id", "buildType", "affectedProject", "project", "user", "count"}
+
+// findBuilds returns the builds matching locator l, newest first. Without a
+// state, running or id dimension only finished builds are returned, unless
+// defaultFilter is false.
+func (s *Server) findBuilds(l string) ([]*Build, error) {
+	ds, err := parseLocator(l)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(l, ds, buildDimensions...); err != nil {
+		return nil, err
+	}
+	df := ds["defaultFilter"] != "false"
+	state := ds["state"]
+	switch ds["running"] {
+	case "true":
+		state = StateRunning
+	case "false":
+		if state == "" {
+			state = StateFinished
+		}
+	case "any":
+		if state == "" {
+			state = "any"
+		}
+	}
+	if state == "" && df {
+		state = StateFinished
+	}
+	canceled := ds["canceled"]
+	if canceled == "" && df {
+		canceled = "false"
+	}
+	var bs []*Build
+	for _, b := range s.builds {
+		if ds["id"] != "" {
+			if strconv.Itoa(b.ID) == ds["id"] {
+				bs = append(bs, b)
+			}
+			continue
+		}
+		if state != "" && state != "any" && b.State != state {
+			continue
+		}
+		if canceled == "true" && b.Canceled == nil || canceled == "false" && b.Canceled != nil {
+			continue
+		}
+		ok, err := s.matchBuild(b, ds)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			bs = append(bs, b)
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].ID > bs[j].ID })
+	return limit(bs, ds["count"])
+}
+
+// findQueued returns the queued builds matching locator l in queue order
+func (s *Server) findQueued(l string) ([]*Build, error) {
+	ds, err := parseLocator(l)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(l, ds, queueDimensions...); err != nil {
+		return nil, err
+	}
+	var bs []*Build
+	for _, b := range s.builds {
+		if b.State != StateQueued {
+			continue
+		}
+		if ds["id"] != "" && strconv.Itoa(b.ID) != ds["id"] {
+			continue
+		}
+		ok, err := s.matchBuild(b, ds)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			bs = append(bs, b)
+		}
+	}
+	return limit(bs, ds["count"])
+}
+
+// matchBuild checks build b against the locator dimensions ds other than
+// id, state, running and canceled
+func (s *Server) matchBuild(b *Build, ds map[string]string) (bool, error) {
+	if v, ok := ds["buildType"]; ok && b.BuildTypeID != refID(v) {
+		return false, nil
+	}
+	if v, ok := ds["project"]; ok {
+		t := s.buildType(b.BuildTypeID)
+		if t == nil || t.ProjectID != refID(v) {
+			return false, nil
+		}
+	}
+	if v, ok := ds["affectedProject"]; ok {
+		t := s.buildType(b.BuildTypeID)
+		if t == nil || !s.inProject(t.ProjectID, refID(v)) {
+			return false, nil
+		}
+	}
+	if v, ok := ds["branch"]; ok {
+		bd, _ := parseLocator(v)
+		n := bd["name"]
+		if n == "" {
+			n = bd["id"]
+		}
+		if n != "" && b.BranchName != n {
+			return false, nil
+		}
+	}
+	if v, ok := ds["status"]; ok && !strings.EqualFold(b.Status, v) {
+		return false, nil
+	}
+	if v, ok := ds["user"]; ok {
+		ud, _ := parseLocator(v)
+		u := ud["username"]
+		if u == "" {
+			u = ud["id"]
+		}
+		if b.TriggeredBy != u {
+			return false, nil
+		}
+	}
+	if v, ok := ds["agent"]; ok && strconv.Itoa(b.AgentID) != refID(v) {
+		return false, nil
+	}
+	if v, ok := ds["sinceBuild"]; ok {
+		id, err := strconv.Atoi(refID(v))
+		if err != nil {
+			return false, badRequest("Bad sinceBuild locator '" + v + "'")
+		}
+		if b.ID <= id {
+			return false, nil
+		}
+	}
+	if v, ok := ds["finishDate"]; ok {
+		fd, _ := parseLocator(v)
+		t, err := time.Parse(timeFormat, fd["date"])
+		if err != nil {
+			return false, badRequest("Bad finishDate locator '" + v + "'")
+		}
+		if b.FinishDate.IsZero() {
+			return false, nil
+		}
+		switch fd["condition"] {
+		case "after":
+			if !b.FinishDate.After(t) {
+				return false, nil
+			}
+		case "before":
+			if !b.FinishDate.Before(t) {
+				return false, nil
+			}
+		default:
+			return false, badRequest("Unsupported finishDate condition '" + fd["condition"] + "'")
+		}
+	}
+	return true, nil
+}
+
+// limit returns the first n of bs if n is set
+func limit(bs []*Build, n string) ([]*Build, error) {
+	if n == "" {
+		return bs, nil
+	}
+	c, err := strconv.Atoi(n)
+	if err != nil {
+		return nil, badRequest("Bad count '" + n + "'")
+	}
+	if c < len(bs) {
+		bs = bs[:c]
+	}
+	return bs, nil
+}
+
+// build returns build id, or nil
+func (s *Server) build(id int) *Build {
+	for _, b := range s.builds {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+// serveBuilds answers requests under /builds
+func (s *Server) serveBuilds(r *request) (interface{}, error) {
+	if len(r.path) == 1 {
+		if r.method != "GET" {
+			return nil, errUnsupported
+		}
+		bs, err := s.findBuilds(r.query.Get("locator"))
+		if err != nil {
+			return nil, err
+		}
+		return s.buildList(bs), nil
+	}
+	if len(r.path) > 2 {
+		return nil, errUnsupported
+	}
+	l := r.path[1]
+	bs, err := s.findBuilds(l)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) == 0 {
+		return nil, notFound("build", l)
+	}
+	b := bs[0]
+	switch r.method {
+	case "GET":
+		return s.buildJSON(b), nil
+	case "POST":
+		if err := s.cancel(b, r.body); err != nil {
+			return nil, err
+		}
+		return s.buildJSON(b), nil
+	case "DELETE":
+		if b.State == StateRunning {
+			return nil, badRequest("Build " + strconv.Itoa(b.ID) + " is running")
+		}
+		s.removeBuild(b)
+		return nil, nil
+	}
+	return nil, errUnsupported
+}
+
+// serveQueue answers requests under /buildQueue
+func (s *Server) serveQueue(r *request) (interface{}, error) {
+	if len(r.path) == 1 {
+		switch r.method {
+		case "GET":
+			bs, err := s.findQueued(r.query.Get("locator"))
+			if err != nil {
+				return nil, err
+			}
+			return s.buildList(bs), nil
+		case "POST":
+			return s.trigger(r.body)
+		}
+		return nil, errUnsupported
+	}
+	if r.path[1] == "order" {
+		return s.order(r)
+	}
+	if len(r.path) > 2 {
+		return nil, errUnsupported
+	}
+	l := r.path[1]
+	bs, err := s.findQueued(l)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) == 0 {
+		return nil, notFound("queued build", l)
+	}
+	b := bs[0]
+	switch r.method {
+	case "GET":
+		return s.buildJSON(b), nil
+	case "POST", "DELETE":
+		if err := s.cancel(b, r.body); err != nil {
+			return nil, err
+		}
+		return s.buildJSON(b), nil
+	}
+	return nil, errUnsupported
+}
+
+// trigger queues the build described by JSON body bd
+func (s *Server) trigger(bd []byte) (interface{}, error) {
+	type triggerRequest struct {
+		BuildType struct {
+			ID string `json:"id"`
+		} `json:"buildType"`
+		BranchName string `json:"branchName"`
+	}
+	tr := &triggerRequest{}
+	if err := json.Unmarshal(bd, tr); err != nil {
+		return nil, badRequest("Invalid build request: " + err.Error())
+	}
+	b, err := s.queue(tr.BuildType.ID, tr.BranchName, "teamcitytest")
+	if err != nil {
+		return nil, err
+	}
+	return s.buildJSON(b), nil
+}
+
+// queue adds a build of buildType bt on branch br to the end of the queue
+func (s *Server) queue(bt string, br string, u string) (*Build, error) {
+	if t := s.buildType(bt); t == nil || t.Template {
+		return nil, notFound("build type", "id:"+bt)
+	}
+	b := &Build{ID: s.nextBuild, BuildTypeID: bt, State: StateQueued, BranchName: br, TriggeredBy: u, QueuedDate: s.now()}
+	s.nextBuild++
+	s.builds = append(s.builds, b)
+	return b, nil
+}
+
+// cancel cancels queued or running build b with the buildCancelRequest in body bd
+func (s *Server) cancel(b *Build, bd []byte) error {
+	type buildCancelRequest struct {
+		Comment string `xml:"comment,attr" json:"comment"`
+	}
+	cr := &buildCancelRequest{}
+	if len(strings.TrimSpace(string(bd))) > 0 {
+		var err error
+		if strings.HasPrefix(strings.TrimSpace(string(bd)), "{") {
+			err = json.Unmarshal(bd, cr)
+		} else {
+			err = xml.Unmarshal(bd, cr)
+		}
+		if err != nil {
+			return badRequest("Invalid buildCancelRequest: " + err.Error())
+		}
+	}
+	if b.State == StateFinished {
+		return badRequest("Build " + strconv.Itoa(b.ID) + " is already finished")
+	}
+	t := s.now()
+	if b.State == StateRunning {
+		b.StatusText = "Canceled"
+	}
+	b.State = StateFinished
+	b.Status = "UNKNOWN"
+	b.FinishDate = t
+	b.Canceled = &Canceled{Comment: cr.Comment, User: "teamcitytest", Date: t}
+	return nil
+}
+
+// removeBuild deletes build b
+func (s *Server) removeBuild(b *Build) {
+	for i, o := range s.builds {
+		if o == b {
+			s.builds = append(s.builds[:i], s.builds[i+1:]...)
+			return
+		}
+	}
+}
+
+// order answers requests under /buildQueue/order
+func (s *Server) order(r *request) (interface{}, error) {
+	type queueBuildRef struct {
+		ID int `json:"id"`
+	}
+	if r.method != "PUT" || len(r.path) > 3 {
+		return nil, errUnsupported
+	}
+	var ids []int
+	p := 1
+	if len(r.path) == 3 {
+		n, err := strconv.Atoi(r.path[2])
+		if err != nil || n < 1 {
+			return nil, badRequest("Bad queue position '" + r.path[2] + "'")
+		}
+		p = n
+		ref := &queueBuildRef{}
+		if err := json.Unmarshal(r.body, ref); err != nil {
+			return nil, badRequest("Invalid build reference: " + err.Error())
+		}
+		ids = []int{ref.ID}
+	} else {
+		o := &struct {
+			Build []queueBuildRef `json:"build"`
+		}{}
+		if err := json.Unmarshal(r.body, o); err != nil {
+			return nil, badRequest("Invalid queue order: " + err.Error())
+		}
+		for _, ref := range o.Build {
+			ids = append(ids, ref.ID)
+		}
+	}
+	var moved []*Build
+	for _, id := range ids {
+		b := s.build(id)
+		if b == nil || b.State != StateQueued {
+			return nil, notFound("queued build", "id:"+strconv.Itoa(id))
+		}
+		moved = append(moved, b)
+	}
+	var rest []*Build
+	for _, b := range s.builds {
+		if b.State == StateQueued && !containsBuild(moved, b) {
+			rest = append(rest, b)
+		}
+	}
+	if p > len(rest)+1 {
+		p = len(rest) + 1
+	}
+	queue := append(append(append([]*Build(nil), rest[:p-1]...), moved...), rest[p-1:]...)
+	// queued builds are kept after the others, in queue order
+	var bs []*Build
+	for _, b := range s.builds {
+		if b.State != StateQueued {
+			bs = append(bs, b)
+		}
+	}
+	s.builds = append(bs, queue...)
+	return s.buildList(queue), nil
+}
+
+// containsBuild checks if bs contains b
+func containsBuild(bs []*Build, b *Build) bool {
+	for _, o := range bs {
+		if o == b {
+			return true
+		}
+	}
+	return false
+}
+
+// QueueBuild queues a build of buildType bt on branch br and returns its ID
+func (s *Server) QueueBuild(bt string, br string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.queue(bt, br, "teamcitytest")
+	if err != nil {
+		return 0, err
+	}
+	return b.ID, nil
+}
+
+// StartBuild starts queued build id on agent a
+func (s *Server) StartBuild(id int, a int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.build(id)
+	if b == nil || b.State != StateQueued {
+		return notFound("queued build", "id:"+strconv.Itoa(id))
+	}
+	b.State = StateRunning
+	b.AgentID = a
+	b.StartDate = s.now()
+	if b.Number == "" {
+		b.Number = strconv.Itoa(b.ID)
+	}
+	return nil
+}
+
+// FinishBuild finishes running build id with status st, such as SUCCESS or FAILURE
+func (s *Server) FinishBuild(id int, st string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.build(id)
+	if b == nil || b.State != StateRunning {
+		return notFound("running build", "id:"+strconv.Itoa(id))
+	}
+	b.State = StateFinished
+	b.Status = st
+	b.PercentageComplete = 0
+	b.FinishDate = s.now()
+	return nil
+}
@@ -0,0 +1,609 @@
+package teamcitytest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// projectRef is the REST representation of a project in lists
+type projectRef struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	ParentProjectID string `json:"parentProjectId,omitempty"`
+	Description     string `json:"description,omitempty"`
+	Archived        bool   `json:"archived"`
+	HREF            string `json:"href"`
+	WebURL          string `json:"webUrl"`
+}
+
+// projectJSON is the full REST representation of a project
+type projectJSON struct {
+	projectRef
+	Parameters properties    `json:"parameters"`
+	Projects   projects      `json:"projects"`
+	BuildTypes buildTypeList `json:"buildTypes"`
+	Templates  buildTypeList `json:"templates"`
+}
+
+// projects is the REST project collection
+type projects struct {
+	Count   int          `json:"count"`
+	Project []projectRef `json:"project"`
+}
+
+// buildTypeJSON is the REST representation of a buildType
+type buildTypeJSON struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description,omitempty"`
+	Paused       bool        `json:"paused"`
+	TemplateFlag bool        `json:"templateFlag,omitempty"`
+	ProjectID    string      `json:"projectId"`
+	ProjectName  string      `json:"projectName"`
+	HREF         string      `json:"href"`
+	WebURL       string      `json:"webUrl"`
+	Project      *projectRef `json:"project,omitempty"`
+}
+
+// buildTypeList is the REST buildType collection
+type buildTypeList struct {
+	Count     int             `json:"count"`
+	BuildType []buildTypeJSON `json:"buildType"`
+}
+
+// triggerJSON is the REST representation of a trigger
+type triggerJSON struct {
+	ID         string     `json:"id,omitempty"`
+	Type       string     `json:"type"`
+	Disabled   bool       `json:"disabled"`
+	Properties properties `json:"properties"`
+}
+
+// triggers is the REST trigger collection
+type triggers struct {
+	Count   int           `json:"count"`
+	Trigger []triggerJSON `json:"trigger"`
+}
+
+// project returns project id, or nil
+func (s *Server) project(id string) *Project {
+	for _, p := range s.projects {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// findProject returns the project matching locator l
+func (s *Server) findProject(l string) (*Project, error) {
+	ds, err := parseLocator(l)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(l, ds, "id", "name"); err != nil {
+		return nil, err
+	}
+	for _, p := range s.projects {
+		if (ds["id"] == "" || p.ID == ds["id"]) && (ds["name"] == "" || p.Name == ds["name"]) {
+			return p, nil
+		}
+	}
+	return nil, notFound("project", l)
+}
+
+// inProject checks if project id is project p or one of its descendants
+func (s *Server) inProject(id string, p string) bool {
+	for id != "" {
+		if id == p {
+			return true
+		}
+		pr := s.project(id)
+		if pr == nil {
+			return false
+		}
+		id = pr.ParentProjectID
+	}
+	return false
+}
+
+// projectRef returns the list representation of project p
+func (s *Server) projectRef(p *Project) projectRef {
+	return projectRef{
+		ID:              p.ID,
+		Name:            p.Name,
+		ParentProjectID: p.ParentProjectID,
+		Description:     p.Description,
+		Archived:        p.Archived,
+		HREF:            "/app/rest/projects/id:" + p.ID,
+		WebURL:          s.URL + "/project.html?projectId=" + p.ID,
+	}
+}
+
+// projectJSON returns the full representation of project p
+func (s *Server) projectJSON(p *Project) projectJSON {
+	j := projectJSON{
+		projectRef: s.projectRef(p),
+		Parameters: propertiesOf(p.Parameters),
+		Projects:   projects{Project: []projectRef{}},
+		BuildTypes: buildTypeList{BuildType: []buildTypeJSON{}},
+		Templates:  buildTypeList{BuildType: []buildTypeJSON{}},
+	}
+	for _, c := range s.projects {
+		if c.ParentProjectID == p.ID && c.ID != RootProject {
+			j.Projects.Project = append(j.Projects.Project, s.projectRef(c))
+		}
+	}
+	j.Projects.Count = len(j.Projects.Project)
+	for _, t := range s.types {
+		if t.ProjectID != p.ID {
+			continue
+		}
+		if t.Template {
+			j.Templates.BuildType = append(j.Templates.BuildType, s.buildTypeJSON(t))
+		} else {
+			j.BuildTypes.BuildType = append(j.BuildTypes.BuildType, s.buildTypeJSON(t))
+		}
+	}
+	j.BuildTypes.Count = len(j.BuildTypes.BuildType)
+	j.Templates.Count = len(j.Templates.BuildType)
+	return j
+}
+
+// serveProjects answers requests under /projects
+func (s *Server) serveProjects(r *request) (interface{}, error) {
+	if len(r.path) == 1 {
+		switch r.method {
+		case "GET":
+			l := projects{Project: []projectRef{}}
+			for _, p := range s.projects {
+				l.Project = append(l.Project, s.projectRef(p))
+			}
+			l.Count = len(l.Project)
+			return l, nil
+		case "POST":
+			return s.createProject(r.body)
+		}
+		return nil, errUnsupported
+	}
+	p, err := s.findProject(r.path[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(r.path) == 2 {
+		switch r.method {
+		case "GET":
+			return s.projectJSON(p), nil
+		case "DELETE":
+			if p.ID == RootProject {
+				return nil, badRequest("The root project cannot be deleted")
+			}
+			s.deleteProject(p.ID)
+			return nil, nil
+		}
+		return nil, errUnsupported
+	}
+	switch r.path[2] {
+	case "parameters":
+		return serveParameters(r, r.path[3:], p.Parameters, nil)
+	case "buildTypes":
+		if len(r.path) > 3 {
+			return nil, errUnsupported
+		}
+		switch r.method {
+		case "GET":
+			l := buildTypeList{BuildType: []buildTypeJSON{}}
+			for _, t := range s.types {
+				if t.ProjectID == p.ID && !t.Template {
+					l.BuildType = append(l.BuildType, s.buildTypeJSON(t))
+				}
+			}
+			l.Count = len(l.BuildType)
+			return l, nil
+		case "POST":
+			return s.createBuildType(p, r.body)
+		}
+		return nil, errUnsupported
+	}
+	if len(r.path) > 3 {
+		return nil, errUnsupported
+	}
+	return serveField(r, map[string]*string{"name": &p.Name, "description": &p.Description}, map[string]*bool{"archived": &p.Archived})
+}
+
+// createProject creates the project described by JSON body bd
+func (s *Server) createProject(bd []byte) (interface{}, error) {
+	type locatorRef struct {
+		Locator string `json:"locator"`
+	}
+	type newProjectDescription struct {
+		ID            string      `json:"id"`
+		Name          string      `json:"name"`
+		ParentProject locatorRef  `json:"parentProject"`
+		SourceProject *locatorRef `json:"sourceProject"`
+	}
+	d := &newProjectDescription{}
+	if err := json.Unmarshal(bd, d); err != nil {
+		return nil, badRequest("Invalid project description: " + err.Error())
+	}
+	if d.SourceProject != nil {
+		return nil, errUnsupported
+	}
+	if d.Name == "" {
+		return nil, badRequest("Project name cannot be empty")
+	}
+	if d.ID == "" {
+		d.ID = strings.Replace(d.Name, " ", "", -1)
+	}
+	if s.project(d.ID) != nil {
+		return nil, badRequest("Project ID '" + d.ID + "' is already used")
+	}
+	parent := RootProject
+	if d.ParentProject.Locator != "" {
+		pp, err := s.findProject(d.ParentProject.Locator)
+		if err != nil {
+			return nil, err
+		}
+		parent = pp.ID
+	}
+	p := &Project{ID: d.ID, Name: d.Name, ParentProjectID: parent, Parameters: map[string]string{}}
+	s.projects = append(s.projects, p)
+	return s.projectJSON(p), nil
+}
+
+// deleteProject removes project id with its subprojects and buildTypes
+func (s *Server) deleteProject(id string) {
+	var ps []*Project
+	for _, p := range s.projects {
+		if !s.inProject(p.ID, id) {
+			ps = append(ps, p)
+		}
+	}
+	var ts []*BuildType
+	for _, t := range s.types {
+		if !s.inProject(t.ProjectID, id) {
+			ts = append(ts, t)
+		}
+	}
+	s.projects, s.types = ps, ts
+}
+
+// buildType returns buildType or template id, or nil
+func (s *Server) buildType(id string) *BuildType {
+	for _, t := range s.types {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// buildTypeJSON returns the REST representation of buildType t
+func (s *Server) buildTypeJSON(t *BuildType) buildTypeJSON {
+	j := buildTypeJSON{
+		ID:           t.ID,
+		Name:         t.Name,
+		Description:  t.Description,
+		Paused:       t.Paused,
+		TemplateFlag: t.Template,
+		ProjectID:    t.ProjectID,
+		HREF:         "/app/rest/buildTypes/id:" + t.ID,
+		WebURL:       s.URL + "/viewType.html?buildTypeId=" + t.ID,
+	}
+	if p := s.project(t.ProjectID); p != nil {
+		j.ProjectName = p.Name
+		pr := s.projectRef(p)
+		j.Project = &pr
+	}
+	return j
+}
+
+// findBuildTypes returns the buildTypes matching locator l. Templates are
+// only returned with templateFlag:true or an id.
+func (s *Server) findBuildTypes(l string) ([]*BuildType, error) {
+	ds, err := parseLocator(l)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(l, ds, "id", "name", "project", "affectedProject", "templateFlag", "paused"); err != nil {
+		return nil, err
+	}
+	var ts []*BuildType
+	for _, t := range s.types {
+		if ds["id"] != "" {
+			if t.ID == ds["id"] {
+				ts = append(ts, t)
+			}
+			continue
+		}
+		if tf := ds["templateFlag"]; tf != "any" && t.Template != (tf == "true") {
+			continue
+		}
+		if v, ok := ds["name"]; ok && t.Name != v {
+			continue
+		}
+		if v, ok := ds["project"]; ok && t.ProjectID != refID(v) {
+			continue
+		}
+		if v, ok := ds["affectedProject"]; ok && !s.inProject(t.ProjectID, refID(v)) {
+			continue
+		}
+		if v, ok := ds["paused"]; ok && strconv.FormatBool(t.Paused) != v {
+			continue
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// serveBuildTypes answers requests under /buildTypes
+func (s *Server) serveBuildTypes(r *request) (interface{}, error) {
+	if len(r.path) == 1 {
+		if r.method != "GET" {
+			return nil, errUnsupported
+		}
+		ts, err := s.findBuildTypes(r.query.Get("locator"))
+		if err != nil {
+			return nil, err
+		}
+		l := buildTypeList{BuildType: []buildTypeJSON{}}
+		for _, t := range ts {
+			l.BuildType = append(l.BuildType, s.buildTypeJSON(t))
+		}
+		l.Count = len(l.BuildType)
+		return l, nil
+	}
+	ts, err := s.findBuildTypes(r.path[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, notFound("build type", r.path[1])
+	}
+	t := ts[0]
+	if len(r.path) == 2 {
+		switch r.method {
+		case "GET":
+			return s.buildTypeJSON(t), nil
+		case "DELETE":
+			for i, o := range s.types {
+				if o == t {
+					s.types = append(s.types[:i], s.types[i+1:]...)
+					break
+				}
+			}
+			return nil, nil
+		}
+		return nil, errUnsupported
+	}
+	switch r.path[2] {
+	case "parameters":
+		return serveParameters(r, r.path[3:], t.Parameters, s.inheritedParameters(t.ProjectID))
+	case "triggers":
+		return s.serveTriggers(r, t)
+	}
+	if len(r.path) > 3 {
+		return nil, errUnsupported
+	}
+	return serveField(r, map[string]*string{"name": &t.Name, "description": &t.Description}, map[string]*bool{"paused": &t.Paused})
+}
+
+// createBuildType creates the buildType described by JSON body bd in project p
+func (s *Server) createBuildType(p *Project, bd []byte) (interface{}, error) {
+	type newBuildTypeDescription struct {
+		ID                     string `json:"id"`
+		Name                   string `json:"name"`
+		SourceBuildTypeLocator string `json:"sourceBuildTypeLocator"`
+	}
+	d := &newBuildTypeDescription{}
+	if err := json.Unmarshal(bd, d); err != nil {
+		return nil, badRequest("Invalid build type description: " + err.Error())
+	}
+	if d.Name == "" {
+		return nil, badRequest("Build type name cannot be empty")
+	}
+	if d.ID == "" {
+		d.ID = p.ID + "_" + strings.Replace(d.Name, " ", "", -1)
+	}
+	if s.buildType(d.ID) != nil {
+		return nil, badRequest("Build type ID '" + d.ID + "' is already used")
+	}
+	t := &BuildType{ID: d.ID, Name: d.Name, ProjectID: p.ID, Parameters: map[string]string{}}
+	if d.SourceBuildTypeLocator != "" {
+		ts, err := s.findBuildTypes(d.SourceBuildTypeLocator)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) == 0 {
+			return nil, notFound("build type", d.SourceBuildTypeLocator)
+		}
+		src := copyState(State{BuildTypes: []BuildType{*ts[0]}}).BuildTypes[0]
+		t.Description, t.Parameters, t.Triggers = src.Description, src.Parameters, src.Triggers
+	}
+	s.types = append(s.types, t)
+	return s.buildTypeJSON(t), nil
+}
+
+// inheritedParameters returns the parameters project p and its ancestors define
+func (s *Server) inheritedParameters(p string) map[string]string {
+	var chain []*Project
+	for pr := s.project(p); pr != nil; pr = s.project(pr.ParentProjectID) {
+		chain = append(chain, pr)
+	}
+	ps := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for n, v := range chain[i].Parameters {
+			ps[n] = v
+		}
+	}
+	return ps
+}
+
+// serveParameters answers requests for the parameters ps under path, with
+// parameters inh inherited from projects
+func serveParameters(r *request, path []string, ps map[string]string, inh map[string]string) (interface{}, error) {
+	if len(path) == 0 {
+		if r.method != "GET" {
+			return nil, errUnsupported
+		}
+		l := properties{Property: []property{}}
+		for _, p := range propertiesOf(inh).Property {
+			if _, ok := ps[p.Name]; !ok {
+				p.Inherited = true
+				l.Property = append(l.Property, p)
+			}
+		}
+		l.Property = append(l.Property, propertiesOf(ps).Property...)
+		l.Count = len(l.Property)
+		return l, nil
+	}
+	n := path[0]
+	if len(path) > 2 || len(path) == 2 && path[1] != "value" {
+		return nil, errUnsupported
+	}
+	switch r.method {
+	case "GET":
+		if v, ok := ps[n]; ok {
+			return v, nil
+		}
+		if v, ok := inh[n]; ok {
+			return v, nil
+		}
+		return nil, notFound("parameter", n)
+	case "PUT":
+		ps[n] = string(r.body)
+		return ps[n], nil
+	case "DELETE":
+		if _, ok := ps[n]; !ok {
+			return nil, notFound("parameter", n)
+		}
+		delete(ps, n)
+		return nil, nil
+	}
+	return nil, errUnsupported
+}
+
+// serveField answers GET and PUT requests for the text fields ss and boolean fields bs
+func serveField(r *request, ss map[string]*string, bs map[string]*bool) (interface{}, error) {
+	f := r.path[2]
+	if v, ok := ss[f]; ok {
+		switch r.method {
+		case "GET":
+			return *v, nil
+		case "PUT":
+			*v = string(r.body)
+			return *v, nil
+		}
+		return nil, errUnsupported
+	}
+	if v, ok := bs[f]; ok {
+		switch r.method {
+		case "GET":
+			return strconv.FormatBool(*v), nil
+		case "PUT":
+			b, err := boolValue(r.body)
+			if err != nil {
+				return nil, err
+			}
+			*v = b
+			return strconv.FormatBool(b), nil
+		}
+	}
+	return nil, errUnsupported
+}
+
+// triggerToJSON returns the REST representation of trigger t
+func triggerToJSON(t Trigger) triggerJSON {
+	return triggerJSON{ID: t.ID, Type: t.Type, Disabled: t.Disabled, Properties: propertiesOf(t.Properties)}
+}
+
+// triggerFromJSON parses a trigger from JSON body bd
+func triggerFromJSON(bd []byte) (Trigger, error) {
+	j := &triggerJSON{}
+	if err := json.Unmarshal(bd, j); err != nil {
+		return Trigger{}, badRequest("Invalid trigger: " + err.Error())
+	}
+	if j.Type == "" {
+		return Trigger{}, badRequest("Trigger type cannot be empty")
+	}
+	t := Trigger{ID: j.ID, Type: j.Type, Disabled: j.Disabled, Properties: map[string]string{}}
+	for _, p := range j.Properties.Property {
+		t.Properties[p.Name] = p.Value
+	}
+	return t, nil
+}
+
+// serveTriggers answers requests under /buildTypes/{locator}/triggers
+func (s *Server) serveTriggers(r *request, bt *BuildType) (interface{}, error) {
+	if len(r.path) == 3 {
+		switch r.method {
+		case "GET":
+			l := triggers{Trigger: []triggerJSON{}}
+			for _, t := range bt.Triggers {
+				l.Trigger = append(l.Trigger, triggerToJSON(t))
+			}
+			l.Count = len(l.Trigger)
+			return l, nil
+		case "POST":
+			t, err := triggerFromJSON(r.body)
+			if err != nil {
+				return nil, err
+			}
+			if t.ID == "" {
+				t.ID = s.triggerID()
+			}
+			for _, o := range bt.Triggers {
+				if o.ID == t.ID {
+					return nil, badRequest("Trigger with id '" + t.ID + "' already exists")
+				}
+			}
+			bt.Triggers = append(bt.Triggers, t)
+			return triggerToJSON(t), nil
+		}
+		return nil, errUnsupported
+	}
+	id := refID(r.path[3])
+	i := -1
+	for j, t := range bt.Triggers {
+		if t.ID == id {
+			i = j
+		}
+	}
+	if i < 0 {
+		return nil, notFound("trigger", r.path[3])
+	}
+	if len(r.path) == 5 && r.path[4] == "disabled" {
+		switch r.method {
+		case "GET":
+			return strconv.FormatBool(bt.Triggers[i].Disabled), nil
+		case "PUT":
+			d, err := boolValue(r.body)
+			if err != nil {
+				return nil, err
+			}
+			bt.Triggers[i].Disabled = d
+			return strconv.FormatBool(d), nil
+		}
+		return nil, errUnsupported
+	}
+	if len(r.path) > 4 {
+		return nil, errUnsupported
+	}
+	switch r.method {
+	case "GET":
+		return triggerToJSON(bt.Triggers[i]), nil
+	case "PUT":
+		t, err := triggerFromJSON(r.body)
+		if err != nil {
+			return nil, err
+		}
+		t.ID = id
+		bt.Triggers[i] = t
+		return triggerToJSON(t), nil
+	case "DELETE":
+		bt.Triggers = append(bt.Triggers[:i], bt.Triggers[i+1:]...)
+		return nil, nil
+	}
+	return nil, errUnsupported
+}
@@ -0,0 +1,421 @@
+package teamcitytest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// RootProject is the ID of the project every other project descends from
+const RootProject = "_Root"
+
+// timeFormat is the layout TeamCity uses for dates
+const timeFormat = "20060102T150405-0700"
+
+// restPrefixes are the REST API roots the server answers on
+var restPrefixes = []string{"/httpAuth/app/rest/", "/app/rest/"}
+
+// Project is a seeded project
+type Project struct {
+	ID              string
+	Name            string
+	ParentProjectID string
+	Description     string
+	Archived        bool
+	Parameters      map[string]string
+}
+
+// BuildType is a seeded buildType or template
+type BuildType struct {
+	ID          string
+	Name        string
+	ProjectID   string
+	Description string
+	Paused      bool
+	Template    bool
+	Parameters  map[string]string
+	Triggers    []Trigger
+}
+
+// Trigger is a seeded buildType trigger
+type Trigger struct {
+	ID         string
+	Type       string
+	Disabled   bool
+	Properties map[string]string
+}
+
+// State is the content of the fake server
+type State struct {
+	Projects   []Project
+	BuildTypes []BuildType
+	// Builds are queued, running and finished builds. Queued builds are in queue order.
+	Builds []Build
+}
+
+// Server is an in-memory TeamCity server implementing the builds, buildQueue,
+// buildTypes, projects and triggers REST endpoints the library uses.
+// Unsupported requests fail with 501 Not Implemented.
+type Server struct {
+	URL string
+	// Now returns the time used for build dates, time.Now if nil. Set it
+	// before making requests.
+	Now func() time.Time
+
+	srv       *httptest.Server
+	mu        sync.Mutex
+	projects  []*Project
+	types     []*BuildType
+	builds    []*Build
+	nextBuild int
+	nextTrig  int
+	requests  []string
+}
+
+// NewServer starts a fake server seeded with state st. The root project is
+// added if st does not contain it.
+func NewServer(st State) *Server {
+	s := &Server{nextBuild: 1, nextTrig: 1}
+	st = copyState(st)
+	hasRoot := false
+	for i := range st.Projects {
+		p := &st.Projects[i]
+		if p.ID == RootProject {
+			hasRoot = true
+		} else if p.ParentProjectID == "" {
+			p.ParentProjectID = RootProject
+		}
+		s.projects = append(s.projects, p)
+	}
+	if !hasRoot {
+		s.projects = append([]*Project{{ID: RootProject, Name: "<Root project>", Parameters: map[string]string{}}}, s.projects...)
+	}
+	for i := range st.BuildTypes {
+		t := &st.BuildTypes[i]
+		for j := range t.Triggers {
+			if t.Triggers[j].ID == "" {
+				t.Triggers[j].ID = s.triggerID()
+			}
+		}
+		s.types = append(s.types, t)
+	}
+	for i := range st.Builds {
+		b := &st.Builds[i]
+		if b.State == "" {
+			b.State = StateQueued
+		}
+		if b.ID >= s.nextBuild {
+			s.nextBuild = b.ID + 1
+		}
+		s.builds = append(s.builds, b)
+	}
+	for _, b := range s.builds {
+		if b.ID == 0 {
+			b.ID = s.nextBuild
+			s.nextBuild++
+		}
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client for the server
+func (s *Server) Client() *teamcity.Client {
+	return teamcity.New(s.URL, "teamcitytest", "teamcitytest")
+}
+
+// State returns a copy of the current server content
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var st State
+	for _, p := range s.projects {
+		st.Projects = append(st.Projects, *p)
+	}
+	for _, t := range s.types {
+		st.BuildTypes = append(st.BuildTypes, *t)
+	}
+	for _, b := range s.builds {
+		st.Builds = append(st.Builds, *b)
+	}
+	return copyState(st)
+}
+
+// Requests returns the requests received so far as "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// now returns the current server time
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// triggerID returns a new trigger ID
+func (s *Server) triggerID() string {
+	id := "TRIGGER_" + strconv.Itoa(s.nextTrig)
+	s.nextTrig++
+	return id
+}
+
+// errUnsupported is returned by handlers for requests the fake does not implement
+var errUnsupported = errors.New("unsupported")
+
+// apiError is an error response with an HTTP status
+type apiError struct {
+	status int
+	msg    string
+}
+
+// Error returns the error string
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+// notFound returns a 404 error for entity kind k matching locator l
+func notFound(k string, l string) error {
+	return &apiError{http.StatusNotFound, "No " + k + " found by locator '" + l + "'"}
+}
+
+// badRequest returns a 400 error with message m
+func badRequest(m string) error {
+	return &apiError{http.StatusBadRequest, m}
+}
+
+// request is a parsed REST request
+type request struct {
+	method string
+	path   []string
+	query  url.Values
+	body   []byte
+}
+
+// ServeHTTP answers a REST request from the in-memory state
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	bd, _ := ioutil.ReadAll(r.Body)
+	p := r.URL.EscapedPath()
+	rest := ""
+	for _, pre := range restPrefixes {
+		if strings.HasPrefix(p, pre) {
+			rest = strings.TrimPrefix(p, pre)
+			break
+		}
+	}
+	req := &request{method: r.Method, query: r.URL.Query(), body: bd}
+	for _, seg := range strings.Split(strings.Trim(rest, "/"), "/") {
+		us, err := url.PathUnescape(seg)
+		if err != nil {
+			us = seg
+		}
+		req.path = append(req.path, us)
+	}
+	var res interface{}
+	err := errUnsupported
+	switch {
+	case req.path[0] == "builds":
+		res, err = s.serveBuilds(req)
+	case req.path[0] == "buildQueue":
+		res, err = s.serveQueue(req)
+	case req.path[0] == "buildTypes":
+		res, err = s.serveBuildTypes(req)
+	case req.path[0] == "projects":
+		res, err = s.serveProjects(req)
+	}
+	if err == errUnsupported {
+		err = &apiError{http.StatusNotImplemented, "teamcitytest does not support " + r.Method + " " + r.URL.Path}
+	}
+	if err != nil {
+		st := http.StatusInternalServerError
+		if ae, ok := err.(*apiError); ok {
+			st = ae.status
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(st)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	switch v := res.(type) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case string:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(v))
+	default:
+		jd, jerr := json.Marshal(v)
+		if jerr != nil {
+			http.Error(w, jerr.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jd)
+	}
+}
+
+// parseLocator parses a locator such as "id:1,buildType:(id:A)" into its
+// dimensions. A locator without dimensions is an ID.
+func parseLocator(l string) (map[string]string, error) {
+	ds := make(map[string]string)
+	if l == "" {
+		return ds, nil
+	}
+	if !strings.ContainsAny(l, ":(),") {
+		ds["id"] = l
+		return ds, nil
+	}
+	var parts []string
+	depth, start := 0, 0
+	for i, ch := range l {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, badRequest("Bad locator '" + l + "': unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, l[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, badRequest("Bad locator '" + l + "': unbalanced parentheses")
+	}
+	parts = append(parts, l[start:])
+	for _, d := range parts {
+		c := strings.Index(d, ":")
+		if c < 0 {
+			return nil, badRequest("Bad locator '" + l + "': dimension '" + d + "' has no value")
+		}
+		v := d[c+1:]
+		if strings.HasPrefix(v, "(") && strings.HasSuffix(v, ")") {
+			v = v[1 : len(v)-1]
+		}
+		ds[d[:c]] = v
+	}
+	return ds, nil
+}
+
+// checkDimensions returns an error if locator dimensions ds contain one not in known
+func checkDimensions(l string, ds map[string]string, known ...string) error {
+	for d := range ds {
+		ok := false
+		for _, k := range known {
+			if d == k {
+				ok = true
+			}
+		}
+		if !ok {
+			return badRequest("Bad locator '" + l + "': dimension '" + d + "' is not supported by teamcitytest")
+		}
+	}
+	return nil
+}
+
+// refID returns the ID from a nested locator value such as "id:A" or "A"
+func refID(v string) string {
+	ds, err := parseLocator(v)
+	if err != nil {
+		return v
+	}
+	return ds["id"]
+}
+
+// boolValue parses a text/plain boolean body
+func boolValue(bd []byte) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(string(bd)))
+	if err != nil {
+		return false, badRequest("Invalid boolean value '" + string(bd) + "'")
+	}
+	return b, nil
+}
+
+// properties is the REST property collection
+type properties struct {
+	Count    int        `json:"count"`
+	Property []property `json:"property"`
+}
+
+// property is a REST name and value pair
+type property struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Inherited bool   `json:"inherited,omitempty"`
+}
+
+// propertiesOf returns map m as a property collection sorted by name
+func propertiesOf(m map[string]string) properties {
+	ps := properties{Property: []property{}}
+	var ns []string
+	for n := range m {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	for _, n := range ns {
+		ps.Property = append(ps.Property, property{Name: n, Value: m[n]})
+	}
+	ps.Count = len(ps.Property)
+	return ps
+}
+
+// copyMap returns a copy of m that is never nil
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// copyState returns a deep copy of st
+func copyState(st State) State {
+	var c State
+	for _, p := range st.Projects {
+		p.Parameters = copyMap(p.Parameters)
+		c.Projects = append(c.Projects, p)
+	}
+	for _, t := range st.BuildTypes {
+		t.Parameters = copyMap(t.Parameters)
+		var ts []Trigger
+		for _, tr := range t.Triggers {
+			tr.Properties = copyMap(tr.Properties)
+			ts = append(ts, tr)
+		}
+		t.Triggers = ts
+		c.BuildTypes = append(c.BuildTypes, t)
+	}
+	for _, b := range st.Builds {
+		if b.Canceled != nil {
+			cc := *b.Canceled
+			b.Canceled = &cc
+		}
+		c.Builds = append(c.Builds, b)
+	}
+	return c
+}
@@ -0,0 +1,258 @@
+package teamcitytest
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// seed returns a small server state with two project trees
+func seed() State {
+	t0 := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	return State{
+		Projects: []Project{
+			{ID: "Payments", Name: "Payments", Parameters: map[string]string{"env.REGION": "eu"}},
+			{ID: "Payments_Api", Name: "API", ParentProjectID: "Payments"},
+			{ID: "Orders", Name: "Orders"},
+		},
+		BuildTypes: []BuildType{
+			{ID: "Payments_Build", Name: "Build", ProjectID: "Payments", Triggers: []Trigger{{ID: "vcs", Type: "vcsTrigger"}}},
+			{ID: "Payments_Api_Build", Name: "Build", ProjectID: "Payments_Api", Parameters: map[string]string{"env.PORT": "8080"}},
+			{ID: "Orders_Build", Name: "Build", ProjectID: "Orders", Triggers: []Trigger{{Type: "schedulingTrigger", Properties: map[string]string{"hour": "3"}}}},
+		},
+		Builds: []Build{
+			{ID: 1, BuildTypeID: "Payments_Build", State: StateFinished, Status: "SUCCESS", QueuedDate: t0, StartDate: t0, FinishDate: t0.Add(time.Minute)},
+			{ID: 2, BuildTypeID: "Orders_Build", State: StateRunning, PercentageComplete: 40, AgentID: 7},
+			{ID: 3, BuildTypeID: "Payments_Api_Build", TriggeredBy: "alice", QueuedDate: t0},
+			{ID: 4, BuildTypeID: "Orders_Build", BranchName: "main", QueuedDate: t0},
+		},
+	}
+}
+
+// buildIDs returns the IDs of builds bs
+func buildIDs(bs []build.Build) []int {
+	var ids []int
+	for _, b := range bs {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// TestBuildsAndQueue tests build and queue queries and mutations through the library
+func TestBuildsAndQueue(t *testing.T) {
+	s := NewServer(seed())
+	defer s.Close()
+	bc := &build.Config{Client: s.Client()}
+	qc := &queue.Config{Client: s.Client(), CancelReason: "cleanup"}
+
+	rbs, err := bc.RunningBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rbs) != 1 || rbs[0].ID != 2 || rbs[0].PercentageComplete != 40 {
+		t.Errorf("unexpected running builds %+v", rbs)
+	}
+	qbs, err := qc.ActiveQueueFiltered(&queue.QueueFilter{Project: "Payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buildIDs(qbs); !reflect.DeepEqual(got, []int{3}) || qbs[0].Triggered.User.Username != "alice" {
+		t.Errorf("payments queue = %v", qbs)
+	}
+	if err := qc.MoveToTop(4); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := qc.ActiveIDs(); !reflect.DeepEqual(ids, []int{4, 3}) {
+		t.Errorf("queue order after MoveToTop = %v", ids)
+	}
+	cr, err := qc.ClearQueueFiltered(&queue.QueueFilter{Project: "Payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cr.Cancelled, []int{3}) {
+		t.Errorf("cancelled = %v", cr.Cancelled)
+	}
+	if ids, _ := qc.ActiveIDs(); !reflect.DeepEqual(ids, []int{4}) {
+		t.Errorf("queue after clear = %v", ids)
+	}
+	for _, b := range s.State().Builds {
+		if b.ID == 3 {
+			t.Errorf("cancelled build was not deleted: %+v", b)
+		}
+	}
+
+	if err := s.StartBuild(4, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FinishBuild(4, "FAILURE"); err != nil {
+		t.Fatal(err)
+	}
+	fbs, err := bc.BuildsFiltered("buildType:(id:Orders_Build),status:FAILURE,branch:main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fbs) != 1 || fbs[0].ID != 4 || fbs[0].FinishDate == "" {
+		t.Errorf("unexpected failed builds %+v", fbs)
+	}
+	abs, err := bc.BuildsFiltered("defaultFilter:false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buildIDs(abs); !reflect.DeepEqual(got, []int{4, 2, 1}) {
+		t.Errorf("all builds = %v", got)
+	}
+	since, err := bc.FinishedBuildsSince(time.Date(2020, 5, 1, 12, 0, 30, 0, time.UTC), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buildIDs(since); !reflect.DeepEqual(got, []int{4, 1}) {
+		t.Errorf("finished since = %v", got)
+	}
+}
+
+// TestProjectsAndTriggers tests project, buildType, parameter and trigger endpoints through the library
+func TestProjectsAndTriggers(t *testing.T) {
+	s := NewServer(seed())
+	defer s.Close()
+	bc := &build.Config{Client: s.Client()}
+
+	ts, err := bc.TypesForProjectTree("Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 2 || ts[1].ProjectName != "API" {
+		t.Errorf("payments types = %+v", ts)
+	}
+	ps, err := bc.TypeParameters("Payments_Api_Build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 || ps[0].Name != "env.REGION" || !ps[0].Inherited || ps[1].Name != "env.PORT" || ps[1].Inherited {
+		t.Errorf("type parameters = %+v", ps)
+	}
+
+	if _, err := bc.CreateProject("Payments", "Payments_Web", "Web"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.CopyBuildType("Payments_Build", "Payments_Web", "Payments_Web_Build", "Build", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.SetProjectParameter("Payments_Web", "env.CDN", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.PauseType("Payments_Web_Build"); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := bc.GetProject("id:Payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Projects.Count != 2 || pr.Parameters.ParameterProperties[0].Value != "eu" {
+		t.Errorf("unexpected project %+v", pr)
+	}
+
+	sn, err := bc.ProjectTriggerSnapshot("_Root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.DisableBuildTrigger("Payments_Build", "vcs"); err != nil {
+		t.Fatal(err)
+	}
+	nt, err := bc.AddBuildTrigger("Payments_Build", build.Trigger{Type: "vcsTrigger"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nt.ID == "" {
+		t.Error("added trigger has no ID")
+	}
+	ds, err := bc.RestoreTriggerSnapshot(sn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Kind != build.DriftTriggerChanged || ds[1].TriggerID != nt.ID {
+		t.Errorf("unexpected drift %+v", ds)
+	}
+
+	if err := bc.DeleteProject("Payments"); err != nil {
+		t.Fatal(err)
+	}
+	st := s.State()
+	if len(st.Projects) != 2 || len(st.BuildTypes) != 1 {
+		t.Errorf("delete left %d projects and %d buildTypes", len(st.Projects), len(st.BuildTypes))
+	}
+	st.BuildTypes[0].Triggers[0].Properties["hour"] = "4"
+	if h := s.State().BuildTypes[0].Triggers[0].Properties["hour"]; h != "3" {
+		t.Errorf("State shares trigger properties with the server, hour = %s", h)
+	}
+}
+
+// TestDryRun tests that a dry-run client plans mutations without changing the server
+func TestDryRun(t *testing.T) {
+	s := NewServer(seed())
+	defer s.Close()
+	c := s.Client()
+	c.DryRun = teamcity.NewPlan(nil)
+	f := filepath.Join(os.TempDir(), "go-teamcity-test-dry-run-triggers.json")
+	defer os.Remove(f)
+	st := s.State()
+
+	if err := (&queue.Config{Client: c}).ClearQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&build.Config{Client: c}).SaveBuildStateAndDisableAll("Payments_Build", f); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.State(), st) {
+		t.Errorf("dry run changed the server state")
+	}
+	var ps []string
+	for _, r := range c.DryRun.Requests() {
+		ps = append(ps, r.Method+" "+r.URL)
+	}
+	sort.Strings(ps)
+	want := []string{
+		"DELETE /httpAuth/app/rest/builds/id:3",
+		"DELETE /httpAuth/app/rest/builds/id:4",
+		"POST /httpAuth/app/rest/buildQueue/id:3",
+		"POST /httpAuth/app/rest/buildQueue/id:4",
+		"PUT /httpAuth/app/rest/buildTypes/id:Payments_Build/triggers/vcs/disabled",
+	}
+	if !reflect.DeepEqual(ps, want) {
+		t.Errorf("plan = %v, want %v", ps, want)
+	}
+}
+
+// TestErrors tests the status of unknown entities, locators and endpoints
+func TestErrors(t *testing.T) {
+	s := NewServer(State{})
+	defer s.Close()
+	c := s.Client()
+	tests := []struct {
+		m, u   string
+		status int
+	}{
+		{"GET", "/httpAuth/app/rest/buildTypes/id:Missing", http.StatusNotFound},
+		{"GET", "/httpAuth/app/rest/builds?locator=revision:abc", http.StatusBadRequest},
+		{"GET", "/httpAuth/app/rest/builds?locator=buildType:(id:A", http.StatusBadRequest},
+		{"GET", "/httpAuth/app/rest/agents", http.StatusNotImplemented},
+		{"DELETE", "/httpAuth/app/rest/projects/_Root", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		_, err := c.HTTPRequest(tt.m, tt.u, nil)
+		he, ok := err.(*teamcity.HTTPError)
+		if !ok || he.StatusCode != tt.status {
+			t.Errorf("%s %s: got %v, want status %d", tt.m, tt.u, err, tt.status)
+		}
+	}
+	if rs := s.Requests(); len(rs) != len(tests) || rs[0] != "GET /httpAuth/app/rest/buildTypes/id:Missing" {
+		t.Errorf("unexpected request log %v", rs)
+	}
+}
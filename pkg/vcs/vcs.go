@@ -0,0 +1,258 @@
+package vcs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// Config contains config data
+type Config struct {
+	Client *teamcity.Client
+	// DryRun reports the changes RewriteProperty would make without making them
+	DryRun bool
+}
+
+// Root contains VCS root data
+type Root struct {
+	ID                        string           `json:"id"`
+	Name                      string           `json:"name"`
+	VcsName                   string           `json:"vcsName"`
+	HREF                      string           `json:"href,omitempty"`
+	ModificationCheckInterval int              `json:"modificationCheckInterval,omitempty"`
+	Project                   *ProjectRef      `json:"project,omitempty"`
+	Properties                build.Properties `json:"properties"`
+}
+
+// ProjectRef references a project
+type ProjectRef struct {
+	ID string `json:"id"`
+}
+
+// PropertyChange contains a property value changed by RewriteProperty
+type PropertyChange struct {
+	RootID string `json:"rootId"`
+	Name   string `json:"name"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// rootFields are the VCS root fields requested for root data
+const rootFields = "id,name,vcsName,href,modificationCheckInterval,project(id),properties(count,property(name,value))"
+
+// Roots returns list of all VCS roots
+func (c *Config) Roots() ([]Root, error) {
+	return c.RootsFiltered("")
+}
+
+// RootsFiltered returns list of VCS roots matching VCS root locator l
+func (c *Config) RootsFiltered(l string) ([]Root, error) {
+	type roots struct {
+		Count int    `json:"count"`
+		Root  []Root `json:"vcs-root"`
+	}
+	rs := &roots{}
+	u := "/httpAuth/app/rest/vcs-roots?fields=" + url.QueryEscape("count,vcs-root("+rootFields+")")
+	if l != "" {
+		u += "&locator=" + url.QueryEscape(l)
+	}
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &rs)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return rs.Root, nil
+}
+
+// GetRoot gets VCS root data for root id
+func (c *Config) GetRoot(id string) (*Root, error) {
+	r := &Root{}
+	u := "/httpAuth/app/rest/vcs-roots/id:" + id + "?fields=" + url.QueryEscape(rootFields)
+	rd, err := c.Client.HTTPRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &r)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return r, nil
+}
+
+// CreateRoot creates VCS root r and returns the created root
+func (c *Config) CreateRoot(r *Root) (*Root, error) {
+	jd, jerr := json.Marshal(r)
+	if jerr != nil {
+		return nil, jerr
+	}
+	rd, err := c.Client.HTTPRequestWithType("POST", "/httpAuth/app/rest/vcs-roots", jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	nr := &Root{}
+	jerr = json.Unmarshal(rd, &nr)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return nr, nil
+}
+
+// UpdateRoot renames VCS root r if r.Name is set and replaces all of its
+// properties if r.Properties.Property is not nil. An empty, non-nil property
+// list removes every property.
+func (c *Config) UpdateRoot(r *Root) error {
+	if r.Name != "" {
+		if err := c.RenameRoot(r.ID, r.Name); err != nil {
+			return err
+		}
+	}
+	if r.Properties.Property != nil {
+		if err := c.SetRootProperties(r.ID, r.Properties); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameRoot sets the name of VCS root id to n
+func (c *Config) RenameRoot(id string, n string) error {
+	u := "/httpAuth/app/rest/vcs-roots/id:" + id + "/name"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(n), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetRootProperties replaces all properties of VCS root id with ps.
+// Properties missing from ps, such as the url or credentials, are removed.
+func (c *Config) SetRootProperties(id string, ps build.Properties) error {
+	jd, jerr := json.Marshal(ps)
+	if jerr != nil {
+		return jerr
+	}
+	u := "/httpAuth/app/rest/vcs-roots/id:" + id + "/properties"
+	_, err := c.Client.HTTPRequestWithType("PUT", u, jd, c.Client.Accept, "application/json")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetRootProperty sets property n of VCS root id to v
+func (c *Config) SetRootProperty(id string, n string, v string) error {
+	u := "/httpAuth/app/rest/vcs-roots/id:" + id + "/properties/" + url.PathEscape(n)
+	_, err := c.Client.HTTPRequestWithType("PUT", u, []byte(v), "text/plain", "text/plain")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteRoot deletes VCS root id
+func (c *Config) DeleteRoot(id string) error {
+	_, err := c.Client.HTTPRequest("DELETE", "/httpAuth/app/rest/vcs-roots/id:"+id, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RootTypes returns the buildTypes which use VCS root id
+func (c *Config) RootTypes(id string) ([]build.Type, error) {
+	type buildTypes struct {
+		Count int          `json:"count"`
+		Type  []build.Type `json:"buildType"`
+	}
+	bt := &buildTypes{}
+	l := "vcsRoot:(id:" + id + ")"
+	rd, err := c.Client.HTTPRequest("GET", "/httpAuth/app/rest/buildTypes?locator="+url.QueryEscape(l), nil)
+	if err != nil {
+		return nil, err
+	}
+	jerr := json.Unmarshal(rd, &bt)
+	if jerr != nil {
+		return nil, jerr
+	}
+	return bt.Type, nil
+}
+
+// CheckForChanges queues a check for changes on all instances of VCS root id
+func (c *Config) CheckForChanges(id string) error {
+	l := "vcsRoot:(id:" + id + ")"
+	u := "/httpAuth/app/rest/vcs-root-instances/checkingForChangesQueue?locator=" + url.QueryEscape(l)
+	_, err := c.Client.HTTPRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReplacePrefix returns a rewrite function replacing prefix o with n
+func ReplacePrefix(o string, n string) func(string) string {
+	return func(v string) string {
+		if strings.HasPrefix(v, o) {
+			return n + strings.TrimPrefix(v, o)
+		}
+		return v
+	}
+}
+
+// RewriteProperty rewrites property n with function fn on VCS roots ids,
+// or on all VCS roots if ids is empty, and returns the changed values.
+// If DryRun is set, the changes are returned but not made.
+func (c *Config) RewriteProperty(ids []string, n string, fn func(string) string) ([]PropertyChange, error) {
+	var rs []Root
+	if len(ids) == 0 {
+		var err error
+		rs, err = c.Roots()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, id := range ids {
+			r, err := c.GetRoot(id)
+			if err != nil {
+				return nil, err
+			}
+			rs = append(rs, *r)
+		}
+	}
+	var pcs []PropertyChange
+	var erstrs []string
+	for _, r := range rs {
+		found := false
+		for _, p := range r.Properties.Property {
+			if p.Name == n {
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		o := r.Properties.Get(n)
+		nv := fn(o)
+		if nv == o {
+			continue
+		}
+		pc := PropertyChange{RootID: r.ID, Name: n, Old: o, New: nv}
+		if !c.DryRun {
+			if err := c.SetRootProperty(r.ID, n, nv); err != nil {
+				erstrs = append(erstrs, r.ID+": "+err.Error())
+				continue
+			}
+		}
+		pcs = append(pcs, pc)
+	}
+	if len(erstrs) > 0 {
+		return pcs, errors.New(strings.Join(erstrs, "; "))
+	}
+	return pcs, nil
+}
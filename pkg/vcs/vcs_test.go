@@ -0,0 +1,80 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// TestRewriteProperty tests a Git host migration against a stub server
+func TestRewriteProperty(t *testing.T) {
+	puts := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/httpAuth/app/rest/vcs-roots":
+			w.Write([]byte(`{"count":3,"vcs-root":[
+				{"id":"Api_Git","vcsName":"jetbrains.git","properties":{"property":[{"name":"url","value":"git@old.example.com:team/api.git"}]}},
+				{"id":"Web_Git","vcsName":"jetbrains.git","properties":{"property":[{"name":"url","value":"git@github.com:team/web.git"}]}},
+				{"id":"Svn","vcsName":"svn","properties":{"property":[{"name":"svn-url","value":"https://svn.example.com"}]}}]}`))
+		case r.Method == "PUT":
+			bd, _ := ioutil.ReadAll(r.Body)
+			puts[r.URL.Path] = string(bd)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), DryRun: true}
+	fn := ReplacePrefix("git@old.example.com:", "git@git.example.com:")
+	pcs, err := c.RewriteProperty(nil, "url", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcs) != 1 || pcs[0].RootID != "Api_Git" || pcs[0].New != "git@git.example.com:team/api.git" {
+		t.Errorf("unexpected changes: %+v", pcs)
+	}
+	if len(puts) != 0 {
+		t.Errorf("dry run made changes: %v", puts)
+	}
+	c.DryRun = false
+	if _, err := c.RewriteProperty(nil, "url", fn); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts) != 1 || puts["/httpAuth/app/rest/vcs-roots/id:Api_Git/properties/url"] != "git@git.example.com:team/api.git" {
+		t.Errorf("unexpected updates: %v", puts)
+	}
+}
+
+// TestUpdateRoot tests that renaming a root leaves its properties alone
+func TestUpdateRoot(t *testing.T) {
+	var puts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			http.NotFound(w, r)
+			return
+		}
+		bd, _ := ioutil.ReadAll(r.Body)
+		puts = append(puts, r.URL.Path+" "+string(bd))
+	}))
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+	if err := c.UpdateRoot(&Root{ID: "Api_Git", Name: "API"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts) != 1 || puts[0] != "/httpAuth/app/rest/vcs-roots/id:Api_Git/name API" {
+		t.Errorf("rename sent %v", puts)
+	}
+	puts = nil
+	ps := build.Properties{Property: []build.Property{{Name: "url", Value: "git@git.example.com:team/api.git"}}}
+	if err := c.UpdateRoot(&Root{ID: "Api_Git", Properties: ps}); err != nil {
+		t.Fatal(err)
+	}
+	want := `/httpAuth/app/rest/vcs-roots/id:Api_Git/properties {"property":[{"name":"url","value":"git@git.example.com:team/api.git"}]}`
+	if len(puts) != 1 || puts[0] != want {
+		t.Errorf("property update sent %v", puts)
+	}
+}
@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// CursorVersion is the current cursor file format version
+const CursorVersion = 1
+
+// Build states recorded in a cursor
+const (
+	stateQueued   = "queued"
+	stateRunning  = "running"
+	stateFinished = "finished"
+)
+
+// Cursor records how far the event stream has been delivered, so a
+// restarted watcher neither replays nor misses events
+type Cursor struct {
+	Version int `json:"version"`
+	// Since is the build ID up to which every build has been fully reported
+	Since int `json:"since"`
+	// Seen is the last reported state of builds after Since
+	Seen map[int]string `json:"seen"`
+	// Status is the last finished status of each buildType
+	Status map[string]string `json:"status"`
+}
+
+// newCursor returns an empty cursor
+func newCursor() *Cursor {
+	return &Cursor{Version: CursorVersion, Seen: make(map[int]string), Status: make(map[string]string)}
+}
+
+// LoadCursor reads a cursor from file f. A missing file returns nil and no error.
+func LoadCursor(f string) (*Cursor, error) {
+	bd, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cur := &Cursor{}
+	if jerr := json.Unmarshal(bd, cur); jerr != nil {
+		return nil, jerr
+	}
+	if cur.Version != CursorVersion {
+		return nil, errors.New("unsupported watch cursor version " + strconv.Itoa(cur.Version))
+	}
+	if cur.Seen == nil {
+		cur.Seen = make(map[int]string)
+	}
+	if cur.Status == nil {
+		cur.Status = make(map[string]string)
+	}
+	return cur, nil
+}
+
+// SaveCursor atomically writes cursor cur to file f
+func SaveCursor(cur *Cursor, f string) error {
+	bd, jerr := json.Marshal(cur)
+	if jerr != nil {
+		return jerr
+	}
+	tf := f + ".tmp"
+	werr := ioutil.WriteFile(tf, bd, 0600)
+	if werr != nil {
+		return werr
+	}
+	return os.Rename(tf, f)
+}
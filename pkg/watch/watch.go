@@ -0,0 +1,409 @@
+package watch
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/queue"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// EventType is the kind of a build event
+type EventType string
+
+// Event types. A finished build produces exactly one of EventFinished,
+// EventFailed or EventCancelled, optionally followed by EventBecameRed
+// or EventBecameGreen when its buildType changed status.
+const (
+	EventQueued      EventType = "queued"
+	EventStarted     EventType = "started"
+	EventFinished    EventType = "finished"
+	EventFailed      EventType = "failed"
+	EventCancelled   EventType = "cancelled"
+	EventBecameRed   EventType = "becameRed"
+	EventBecameGreen EventType = "becameGreen"
+)
+
+// DefaultInterval is the default poll interval
+const DefaultInterval = 10 * time.Second
+
+// DefaultLookupLimit is the default number of builds scanned for finished builds
+const DefaultLookupLimit = 1000
+
+// Event contains a build state change
+type Event struct {
+	Type        EventType   `json:"type"`
+	BuildTypeID string      `json:"buildTypeId"`
+	Build       build.Build `json:"build"`
+}
+
+// Filter selects events. Empty fields match everything.
+type Filter struct {
+	Types      []EventType
+	BuildTypes []string
+	Branch     string
+	// Match is an additional predicate applied to each event
+	Match func(Event) bool
+}
+
+// Matches returns true if event e passes the filter
+func (f *Filter) Matches(e Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 {
+		ok := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.BuildTypes) > 0 {
+		ok := false
+		for _, bt := range f.BuildTypes {
+			if bt == e.BuildTypeID {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.Branch != "" && f.Branch != e.Build.BranchName {
+		return false
+	}
+	if f.Match != nil && !f.Match(e) {
+		return false
+	}
+	return true
+}
+
+// subscriber is a channel receiving filtered events
+type subscriber struct {
+	f      *Filter
+	ch     chan Event
+	mu     sync.Mutex
+	done   chan struct{}
+	once   sync.Once
+	closed bool
+}
+
+// close stops delivery to the subscriber and closes its channel
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Config contains config data
+type Config struct {
+	Client *teamcity.Client
+	// Interval is the poll interval, DefaultInterval if zero
+	Interval time.Duration
+	// LookupLimit caps the builds scanned for finished builds, DefaultLookupLimit if zero
+	LookupLimit int
+	// Cursor is the position to resume from. If nil it is loaded from
+	// CursorFile, or the stream starts at the current server state.
+	Cursor *Cursor
+	// CursorFile is where the cursor is saved after each delivered poll
+	CursorFile string
+
+	mu   sync.Mutex
+	subs []*subscriber
+}
+
+// Subscribe returns a channel with buffer size n receiving the events matching
+// filter f, and a func that unsubscribes and closes the channel. Delivery
+// blocks until every subscriber has received the event, so slow subscribers
+// should use a larger buffer.
+func (c *Config) Subscribe(f *Filter, n int) (<-chan Event, func()) {
+	s := &subscriber{f: f, ch: make(chan Event, n), done: make(chan struct{})}
+	c.mu.Lock()
+	c.subs = append(c.subs, s)
+	c.mu.Unlock()
+	return s.ch, func() {
+		c.mu.Lock()
+		for i, o := range c.subs {
+			if o == s {
+				c.subs = append(c.subs[:i], c.subs[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+		s.close()
+	}
+}
+
+// Run polls until stop is closed or a poll fails, delivering events to
+// subscribers and saving the cursor. Subscriber channels are closed on return.
+func (c *Config) Run(stop <-chan struct{}) error {
+	defer c.closeSubscribers()
+	if c.Cursor == nil && c.CursorFile != "" {
+		cur, err := LoadCursor(c.CursorFile)
+		if err != nil {
+			return err
+		}
+		c.Cursor = cur
+	}
+	iv := c.Interval
+	if iv <= 0 {
+		iv = DefaultInterval
+	}
+	t := time.NewTicker(iv)
+	defer t.Stop()
+	for {
+		evs, err := c.Poll()
+		if err != nil {
+			return err
+		}
+		if !c.deliver(evs, stop) {
+			return nil
+		}
+		if c.CursorFile != "" {
+			if err := SaveCursor(c.Cursor, c.CursorFile); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// deliver sends events to matching subscribers, returning false if stop was closed
+func (c *Config) deliver(evs []Event, stop <-chan struct{}) bool {
+	c.mu.Lock()
+	subs := append([]*subscriber(nil), c.subs...)
+	c.mu.Unlock()
+	for _, e := range evs {
+		for _, s := range subs {
+			if !s.f.Matches(e) {
+				continue
+			}
+			s.mu.Lock()
+			if !s.closed {
+				select {
+				case s.ch <- e:
+				case <-s.done:
+				case <-stop:
+					s.mu.Unlock()
+					return false
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+	return true
+}
+
+// closeSubscribers closes every subscriber channel
+func (c *Config) closeSubscribers() {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+// Poll fetches the server state once, advances the cursor and returns the
+// events since the previous poll. Without a cursor the current state is
+// recorded and no events are returned.
+func (c *Config) Poll() ([]Event, error) {
+	bc := &build.Config{Client: c.Client}
+	qbs, err := (&queue.Config{Client: c.Client}).ActiveQueue()
+	if err != nil {
+		return nil, err
+	}
+	rbs, err := bc.BuildsFiltered("defaultFilter:false,running:true")
+	if err != nil {
+		return nil, err
+	}
+	if c.Cursor == nil {
+		return nil, c.seed(bc, qbs, rbs)
+	}
+	cur := c.Cursor
+	fbs, err := bc.BuildsFiltered(c.finishedLocator())
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[int]bool)
+	for _, b := range qbs {
+		present[b.ID] = true
+	}
+	for _, b := range rbs {
+		present[b.ID] = true
+	}
+	finished := make(map[int]build.Build)
+	for _, b := range fbs {
+		finished[b.ID] = b
+	}
+	// pending builds that left the queue and running list between polls
+	// without showing up as finished are looked up one by one
+	gone := make(map[int]bool)
+	for id, s := range cur.Seen {
+		if s == stateFinished || present[id] {
+			continue
+		}
+		if _, ok := finished[id]; ok {
+			continue
+		}
+		bs, err := bc.BuildsFiltered("defaultFilter:false,id:" + strconv.Itoa(id))
+		if err != nil && !teamcity.IsNotFound(err) {
+			return nil, err
+		}
+		if len(bs) == 0 {
+			gone[id] = true
+			continue
+		}
+		if bs[0].State == stateFinished {
+			finished[id] = bs[0]
+		}
+	}
+	// the cursor is only changed once every request has succeeded
+	var evs []Event
+	for id := range gone {
+		cur.Seen[id] = stateFinished
+	}
+	sortBuilds(qbs)
+	for _, b := range qbs {
+		if b.ID > cur.Since && cur.Seen[b.ID] == "" {
+			evs = append(evs, event(EventQueued, b))
+			cur.Seen[b.ID] = stateQueued
+		}
+	}
+	sortBuilds(rbs)
+	for _, b := range rbs {
+		if s := cur.Seen[b.ID]; b.ID > cur.Since && (s == "" || s == stateQueued) {
+			evs = append(evs, event(EventStarted, b))
+			cur.Seen[b.ID] = stateRunning
+		}
+	}
+	var fl []build.Build
+	for _, b := range finished {
+		if b.ID > cur.Since && cur.Seen[b.ID] != stateFinished {
+			fl = append(fl, b)
+		}
+	}
+	sortBuilds(fl)
+	for _, b := range fl {
+		evs = append(evs, c.finishedEvents(b)...)
+		cur.Seen[b.ID] = stateFinished
+	}
+	c.advance()
+	return evs, nil
+}
+
+// seed starts a new cursor at the current server state
+func (c *Config) seed(bc *build.Config, qbs []build.Build, rbs []build.Build) error {
+	cur := newCursor()
+	bs, err := bc.BuildsFiltered("defaultFilter:false,count:1")
+	if err != nil {
+		return err
+	}
+	if len(bs) > 0 {
+		cur.Since = bs[0].ID
+	}
+	for _, b := range qbs {
+		if b.ID > cur.Since {
+			cur.Seen[b.ID] = stateQueued
+		}
+	}
+	for _, b := range rbs {
+		if b.ID > cur.Since {
+			cur.Seen[b.ID] = stateRunning
+		}
+	}
+	c.Cursor = cur
+	return nil
+}
+
+// finishedLocator returns the locator of builds finished since the cursor
+func (c *Config) finishedLocator() string {
+	n := c.LookupLimit
+	if n <= 0 {
+		n = DefaultLookupLimit
+	}
+	l := "defaultFilter:false,state:finished,lookupLimit:" + strconv.Itoa(n) + ",count:" + strconv.Itoa(n)
+	if c.Cursor.Since > 0 {
+		l += ",sinceBuild:(id:" + strconv.Itoa(c.Cursor.Since) + ")"
+	}
+	return l
+}
+
+// finishedEvents returns the events for finished build b and records its status
+func (c *Config) finishedEvents(b build.Build) []Event {
+	if b.CanceledInfo != nil {
+		return []Event{event(EventCancelled, b)}
+	}
+	var evs []Event
+	if b.Status == "FAILURE" {
+		evs = append(evs, event(EventFailed, b))
+	} else {
+		evs = append(evs, event(EventFinished, b))
+	}
+	if b.Status != "SUCCESS" && b.Status != "FAILURE" {
+		return evs
+	}
+	prev := c.Cursor.Status[b.BuildTypeID]
+	if prev == "SUCCESS" && b.Status == "FAILURE" {
+		evs = append(evs, event(EventBecameRed, b))
+	}
+	if prev == "FAILURE" && b.Status == "SUCCESS" {
+		evs = append(evs, event(EventBecameGreen, b))
+	}
+	c.Cursor.Status[b.BuildTypeID] = b.Status
+	return evs
+}
+
+// advance moves Since up to just below the oldest pending build and
+// forgets the builds at or below it
+func (c *Config) advance() {
+	cur := c.Cursor
+	ns := cur.Since
+	pending := 0
+	for id, s := range cur.Seen {
+		if s != stateFinished && (pending == 0 || id < pending) {
+			pending = id
+		}
+		if id > ns {
+			ns = id
+		}
+	}
+	if pending > 0 {
+		ns = pending - 1
+	}
+	if ns <= cur.Since {
+		return
+	}
+	cur.Since = ns
+	for id := range cur.Seen {
+		if id <= ns {
+			delete(cur.Seen, id)
+		}
+	}
+}
+
+// event returns an event of type t for build b
+func event(t EventType, b build.Build) Event {
+	return Event{Type: t, BuildTypeID: b.BuildTypeID, Build: b}
+}
+
+// sortBuilds sorts builds by ID, oldest first
+func sortBuilds(bs []build.Build) {
+	sort.Slice(bs, func(i, j int) bool { return bs[i].ID < bs[j].ID })
+}
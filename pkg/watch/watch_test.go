@@ -0,0 +1,153 @@
+package watch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+)
+
+// stub is a TeamCity server whose queue, running and finished builds tests can change
+type stub struct {
+	mu       sync.Mutex
+	queue    string
+	running  string
+	finished string
+	builds   map[string]string
+	locators []string
+}
+
+// ServeHTTP answers the requests made by Poll
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := r.URL.Query().Get("locator")
+	switch {
+	case r.URL.Path == "/httpAuth/app/rest/buildQueue":
+		w.Write([]byte(`{"build":[` + s.queue + `]}`))
+	case strings.Contains(l, "running:true"):
+		w.Write([]byte(`{"build":[` + s.running + `]}`))
+	case strings.Contains(l, "state:finished"):
+		s.locators = append(s.locators, l)
+		w.Write([]byte(`{"build":[` + s.finished + `]}`))
+	case l == "defaultFilter:false,count:1":
+		w.Write([]byte(`{"build":[{"id":9,"state":"finished"}]}`))
+	case s.builds[l] != "":
+		w.Write([]byte(`{"build":[` + s.builds[l] + `]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// set replaces the queue, running and finished builds
+func (s *stub) set(q string, r string, f string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue, s.running, s.finished = q, r, f
+}
+
+// eventStrings formats events as type:buildID
+func eventStrings(evs []Event) string {
+	var ss []string
+	for _, e := range evs {
+		ss = append(ss, string(e.Type)+":"+e.BuildTypeID+":"+strconv.Itoa(e.Build.ID))
+	}
+	return strings.Join(ss, " ")
+}
+
+// TestPollEvents tests events across polls and a restart from a saved cursor
+func TestPollEvents(t *testing.T) {
+	s := &stub{builds: map[string]string{
+		"defaultFilter:false,id:11": `{"id":11,"buildTypeId":"B","state":"finished","status":"UNKNOWN","canceledInfo":{"text":"stop"}}`,
+	}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", "")}
+
+	s.set(`{"id":10,"buildTypeId":"A"}`, ``, ``)
+	steps := []struct {
+		queue, running, finished string
+		want                     string
+	}{
+		{``, ``, ``, ""},
+		{`{"id":11,"buildTypeId":"B"}`, `{"id":10,"buildTypeId":"A","state":"running"}`, ``, "queued:B:11 started:A:10"},
+		{``, ``, `{"id":12,"buildTypeId":"B","state":"finished","status":"SUCCESS"},{"id":10,"buildTypeId":"A","state":"finished","status":"FAILURE"}`,
+			"failed:A:10 cancelled:B:11 finished:B:12"},
+	}
+	for i, st := range steps {
+		if i > 0 {
+			s.set(st.queue, st.running, st.finished)
+		}
+		evs, err := c.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventStrings(evs); got != st.want {
+			t.Errorf("poll %d events = %q, want %q", i, got, st.want)
+		}
+	}
+	if c.Cursor.Since != 12 || len(c.Cursor.Seen) != 0 {
+		t.Errorf("unexpected cursor after all builds finished: %+v", c.Cursor)
+	}
+
+	d, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "cursor.json")
+	if err := SaveCursor(c.Cursor, f); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := LoadCursor(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := &Config{Client: teamcity.New(ts.URL, "", ""), Cursor: cur}
+	s.set(``, ``, `{"id":13,"buildTypeId":"A","state":"finished","status":"SUCCESS"},{"id":12,"buildTypeId":"B","state":"finished","status":"SUCCESS"}`)
+	evs, err := rc.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventStrings(evs), "finished:A:13 becameGreen:A:13"; got != want {
+		t.Errorf("resumed events = %q, want %q", got, want)
+	}
+	if l := s.locators[len(s.locators)-1]; !strings.Contains(l, "sinceBuild:(id:12)") || !strings.Contains(l, "lookupLimit:1000") {
+		t.Errorf("unexpected finished locator %s", l)
+	}
+}
+
+// TestRunSubscribers tests that subscribers only receive matching events
+func TestRunSubscribers(t *testing.T) {
+	s := &stub{}
+	s.set(``, ``, `{"id":10,"buildTypeId":"A","state":"finished","status":"SUCCESS"},{"id":11,"buildTypeId":"B","state":"finished","status":"FAILURE"}`)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := &Config{Client: teamcity.New(ts.URL, "", ""), Interval: time.Millisecond, Cursor: &Cursor{Version: CursorVersion, Since: 9, Seen: map[int]string{}, Status: map[string]string{}}}
+	failed, _ := c.Subscribe(&Filter{Types: []EventType{EventFailed}}, 1)
+	forA, _ := c.Subscribe(&Filter{BuildTypes: []string{"A"}}, 1)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- c.Run(stop) }()
+	if e := <-failed; e.Build.ID != 11 {
+		t.Errorf("failed subscriber got %+v", e)
+	}
+	if e := <-forA; e.Build.ID != 10 || e.Type != EventFinished {
+		t.Errorf("buildType subscriber got %+v", e)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-failed; ok {
+		t.Error("subscriber channel not closed after Run returned")
+	}
+}
@@ -0,0 +1,376 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/watch"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Request headers sent with each delivery
+const (
+	EventHeader     = "X-TeamCity-Event"
+	DeliveryHeader  = "X-TeamCity-Delivery"
+	SignatureHeader = "X-TeamCity-Signature-256"
+)
+
+// Defaults used when the Config fields are zero
+const (
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+	DefaultTimeout = 10 * time.Second
+)
+
+// sleep waits between retries, overridden by tests
+var sleep = time.Sleep
+
+// now returns the current time, overridden by tests
+var now = time.Now
+
+// Endpoint is a receiver of build event callbacks. Empty filters match everything.
+type Endpoint struct {
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+	// Secret signs payloads with HMAC-SHA256 in SignatureHeader
+	Secret string `yaml:"secret,omitempty" json:"-"`
+	// Projects matches builds in these projects and their subprojects
+	Projects   []string          `yaml:"projects,omitempty" json:"projects,omitempty"`
+	BuildTypes []string          `yaml:"buildTypes,omitempty" json:"buildTypes,omitempty"`
+	Events     []watch.EventType `yaml:"events,omitempty" json:"events,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// Config contains config data
+type Config struct {
+	// Client resolves the project of a buildType for Projects filters
+	Client    *teamcity.Client
+	Endpoints []Endpoint
+	// Retries is how often a failed delivery is retried, DefaultRetries
+	// if zero and none if negative
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each further
+	// retry, DefaultBackoff if zero
+	Backoff time.Duration
+	// Timeout is the timeout of each request, DefaultTimeout if zero
+	Timeout time.Duration
+	// DeadLetterFile receives deliveries that failed every attempt and events
+	// that could not be matched to an endpoint, one JSON object per line
+	DeadLetterFile string
+	// OnError is called by Serve with the error of each failed dispatch, if set
+	OnError func(watch.Event, error)
+
+	mu    sync.Mutex
+	trees map[string]map[string]bool
+}
+
+// Payload is the JSON body posted to endpoints
+type Payload struct {
+	ID          string          `json:"id"`
+	Event       watch.EventType `json:"event"`
+	BuildTypeID string          `json:"buildTypeId"`
+	ProjectID   string          `json:"projectId,omitempty"`
+	Timestamp   string          `json:"timestamp"`
+	Build       build.Build     `json:"build"`
+}
+
+// DeadLetter is a delivery that failed every attempt, or an event that could
+// not be matched to the endpoint, with Attempts 0
+type DeadLetter struct {
+	Endpoint string  `json:"endpoint"`
+	URL      string  `json:"url"`
+	Attempts int     `json:"attempts"`
+	Error    string  `json:"error"`
+	Time     string  `json:"time"`
+	Payload  Payload `json:"payload"`
+}
+
+// LoadEndpoints reads endpoints from YAML file f
+func LoadEndpoints(f string) ([]Endpoint, error) {
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var es []Endpoint
+	yerr := yaml.UnmarshalStrict(bd, &es)
+	if yerr != nil {
+		return nil, errors.New(f + ": " + yerr.Error())
+	}
+	for _, e := range es {
+		if e.URL == "" {
+			return nil, errors.New(f + ": endpoint " + e.Name + " has no url")
+		}
+	}
+	return es, nil
+}
+
+// Serve dispatches events from evs until the channel is closed, such as a
+// channel from watch.Config.Subscribe. Delivery and match errors are
+// dead-lettered and passed to OnError.
+func (c *Config) Serve(evs <-chan watch.Event) {
+	for e := range evs {
+		if err := c.Dispatch(e); err != nil && c.OnError != nil {
+			c.OnError(e, err)
+		}
+	}
+}
+
+// Dispatch posts event e to every matching endpoint. The project of the
+// buildType is looked up once if any endpoint filters on projects; if the
+// lookup fails the event is dead-lettered for those endpoints.
+func (c *Config) Dispatch(e watch.Event) error {
+	p := Payload{
+		ID:          string(e.Type) + "-" + strconv.Itoa(e.Build.ID),
+		Event:       e.Type,
+		BuildTypeID: e.BuildTypeID,
+		Timestamp:   now().UTC().Format(time.RFC3339),
+		Build:       e.Build,
+	}
+	bc := &build.Config{Client: c.Client}
+	var perr error
+	for _, ep := range c.Endpoints {
+		if len(ep.Projects) > 0 {
+			p.ProjectID, perr = bc.ProjectID(e.BuildTypeID)
+			break
+		}
+	}
+	var erstrs []string
+	for _, ep := range c.Endpoints {
+		ok, err := c.matches(bc, ep, e, p.ProjectID, perr)
+		if err != nil {
+			erstrs = append(erstrs, ep.Name+": "+err.Error())
+			if werr := c.deadLetter(ep, p, 0, err); werr != nil {
+				erstrs = append(erstrs, ep.Name+": dead letter: "+werr.Error())
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := c.Deliver(ep, p); err != nil {
+			erstrs = append(erstrs, ep.Name+": "+err.Error())
+		}
+	}
+	if len(erstrs) > 0 {
+		return errors.New(strings.Join(erstrs, "; "))
+	}
+	return nil
+}
+
+// matches returns true if endpoint ep accepts event e in project pid, or
+// perr if the project is needed but could not be looked up
+func (c *Config) matches(bc *build.Config, ep Endpoint, e watch.Event, pid string, perr error) (bool, error) {
+	if len(ep.Events) > 0 && !containsEvent(ep.Events, e.Type) {
+		return false, nil
+	}
+	if len(ep.BuildTypes) > 0 && !contains(ep.BuildTypes, e.BuildTypeID) {
+		return false, nil
+	}
+	if len(ep.Projects) == 0 {
+		return true, nil
+	}
+	if perr != nil {
+		return false, perr
+	}
+	for _, pr := range ep.Projects {
+		t, err := c.tree(bc, pr)
+		if err != nil {
+			return false, err
+		}
+		if t[pid] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// tree returns the IDs of project p and its subprojects, cached after the first lookup
+func (c *Config) tree(bc *build.Config, p string) (map[string]bool, error) {
+	c.mu.Lock()
+	t, ok := c.trees[p]
+	c.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+	// the lookup runs unlocked so a slow server does not block other dispatches
+	ids, err := bc.ProjectTree(p)
+	if err != nil {
+		return nil, err
+	}
+	t = make(map[string]bool)
+	for _, id := range ids {
+		t[id] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.trees == nil {
+		c.trees = make(map[string]map[string]bool)
+	}
+	c.trees[p] = t
+	return t, nil
+}
+
+// Deliver posts payload p to endpoint ep, retrying network errors, 429 and
+// 5xx responses. A delivery that fails is written to the dead-letter file.
+func (c *Config) Deliver(ep Endpoint, p Payload) error {
+	bd, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	retries := c.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	backoff := c.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	attempts := 0
+	var derr error
+	for {
+		attempts++
+		retry, err := c.post(ep, p, bd)
+		if err == nil {
+			return nil
+		}
+		derr = err
+		if !retry || attempts > retries {
+			break
+		}
+		sleep(backoff)
+		backoff *= 2
+	}
+	if werr := c.deadLetter(ep, p, attempts, derr); werr != nil {
+		return errors.New(derr.Error() + "; dead letter: " + werr.Error())
+	}
+	return derr
+}
+
+// post sends one delivery attempt and reports whether a failure may be retried
+func (c *Config) post(ep Endpoint, p Payload, bd []byte) (bool, error) {
+	req, err := http.NewRequest("POST", ep.URL, bytes.NewReader(bd))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-teamcity-webhook")
+	req.Header.Set(EventHeader, string(p.Event))
+	req.Header.Set(DeliveryHeader, p.ID)
+	if ep.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(ep.Secret, bd))
+	}
+	for k, v := range ep.Headers {
+		req.Header.Set(k, v)
+	}
+	t := c.Timeout
+	if t <= 0 {
+		t = DefaultTimeout
+	}
+	hc := &http.Client{Timeout: t}
+	res, err := hc.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	ioutil.ReadAll(res.Body)
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, errors.New("POST " + ep.URL + ": " + strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode))
+}
+
+// deadLetter appends a failed delivery to the dead-letter file
+func (c *Config) deadLetter(ep Endpoint, p Payload, n int, derr error) error {
+	if c.DeadLetterFile == "" {
+		return nil
+	}
+	d := DeadLetter{
+		Endpoint: ep.Name,
+		URL:      ep.URL,
+		Attempts: n,
+		Error:    derr.Error(),
+		Time:     now().UTC().Format(time.RFC3339),
+		Payload:  p,
+	}
+	bd, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(bd, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadDeadLetters reads the dead letters in file f
+func ReadDeadLetters(f string) ([]DeadLetter, error) {
+	bd, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var ds []DeadLetter
+	for _, l := range bytes.Split(bd, []byte("\n")) {
+		if len(bytes.TrimSpace(l)) == 0 {
+			continue
+		}
+		var d DeadLetter
+		if jerr := json.Unmarshal(l, &d); jerr != nil {
+			return nil, jerr
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// Sign returns the signature header value of body bd with secret s
+func Sign(s string, bd []byte) string {
+	m := hmac.New(sha256.New, []byte(s))
+	m.Write(bd)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify checks signature header value sig of body bd with secret s, for receivers
+func Verify(s string, bd []byte, sig string) bool {
+	return hmac.Equal([]byte(Sign(s, bd)), []byte(sig))
+}
+
+// contains returns true if ss contains s
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsEvent returns true if ts contains t
+func containsEvent(ts []watch.EventType, t watch.EventType) bool {
+	for _, v := range ts {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
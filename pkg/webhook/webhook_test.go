@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/go-teamcity/pkg/build"
+	"github.com/robertlestak/go-teamcity/pkg/teamcity"
+	"github.com/robertlestak/go-teamcity/pkg/watch"
+)
+
+// receiver records the deliveries it accepts and answers with status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	secret   string
+	attempts int
+	payloads []Payload
+	t        *testing.T
+}
+
+// ServeHTTP verifies and records a delivery
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.attempts++
+	bd, _ := ioutil.ReadAll(r.Body)
+	if rc.secret != "" && !Verify(rc.secret, bd, r.Header.Get(SignatureHeader)) {
+		rc.t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+	}
+	if rc.status != 0 {
+		w.WriteHeader(rc.status)
+		return
+	}
+	var p Payload
+	if err := json.Unmarshal(bd, &p); err != nil {
+		rc.t.Error(err)
+	}
+	if r.Header.Get(EventHeader) != string(p.Event) || r.Header.Get(DeliveryHeader) != p.ID {
+		rc.t.Errorf("headers do not match payload: %v", r.Header)
+	}
+	rc.payloads = append(rc.payloads, p)
+}
+
+// failedEvent returns a failed event for build i of buildType bt
+func failedEvent(i int, bt string) watch.Event {
+	return watch.Event{Type: watch.EventFailed, BuildTypeID: bt, Build: build.Build{ID: i, BuildTypeID: bt, Status: "FAILURE"}}
+}
+
+// TestDispatchFilters tests signatures and event, buildType and project filters
+func TestDispatchFilters(t *testing.T) {
+	tc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/httpAuth/app/rest/buildTypes/id:Webhook_Payments_Api_Build":
+			w.Write([]byte(`{"id":"Webhook_Payments_Api_Build","projectId":"Webhook_Payments_Api"}`))
+		case "/httpAuth/app/rest/buildTypes/id:Webhook_Orders_Build":
+			w.Write([]byte(`{"id":"Webhook_Orders_Build","projectId":"Webhook_Orders"}`))
+		case "/httpAuth/app/rest/projects":
+			w.Write([]byte(`{"project":[{"id":"Webhook_Payments","parentProjectId":"_Root"},
+				{"id":"Webhook_Payments_Api","parentProjectId":"Webhook_Payments"},{"id":"Webhook_Orders","parentProjectId":"_Root"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer tc.Close()
+	all := &receiver{t: t, secret: "s3cret"}
+	payments := &receiver{t: t}
+	ars := httptest.NewServer(all)
+	defer ars.Close()
+	prs := httptest.NewServer(payments)
+	defer prs.Close()
+	c := &Config{
+		Client: teamcity.New(tc.URL, "", ""),
+		Endpoints: []Endpoint{
+			{Name: "all-failures", URL: ars.URL, Secret: "s3cret", Events: []watch.EventType{watch.EventFailed}},
+			{Name: "payments", URL: prs.URL, Projects: []string{"Webhook_Payments"}},
+		},
+	}
+	for _, e := range []watch.Event{
+		failedEvent(1, "Webhook_Payments_Api_Build"),
+		failedEvent(2, "Webhook_Orders_Build"),
+		{Type: watch.EventStarted, BuildTypeID: "Webhook_Orders_Build", Build: build.Build{ID: 3}},
+	} {
+		if err := c.Dispatch(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(all.payloads) != 2 || all.payloads[0].ID != "failed-1" || all.payloads[1].ID != "failed-2" ||
+		all.payloads[0].ProjectID != "Webhook_Payments_Api" {
+		t.Errorf("all-failures endpoint got %+v", all.payloads)
+	}
+	if len(payments.payloads) != 1 || payments.payloads[0].ProjectID != "Webhook_Payments_Api" {
+		t.Errorf("payments endpoint got %+v", payments.payloads)
+	}
+}
+
+// TestDeliverRetriesAndDeadLetters tests retries with backoff and the dead-letter file
+func TestDeliverRetriesAndDeadLetters(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+	d, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	down := &receiver{t: t, status: http.StatusBadGateway}
+	rejects := &receiver{t: t, status: http.StatusBadRequest}
+	drs := httptest.NewServer(down)
+	defer drs.Close()
+	rrs := httptest.NewServer(rejects)
+	defer rrs.Close()
+	c := &Config{
+		Endpoints: []Endpoint{
+			{Name: "down", URL: drs.URL},
+			{Name: "rejects", URL: rrs.URL},
+		},
+		Retries:        2,
+		Backoff:        time.Second,
+		DeadLetterFile: filepath.Join(d, "dead.jsonl"),
+	}
+	if err := c.Dispatch(failedEvent(7, "Payments_Build")); err == nil {
+		t.Fatal("expected delivery error")
+	}
+	if down.attempts != 3 || rejects.attempts != 1 {
+		t.Errorf("attempts = %d and %d, want 3 and 1", down.attempts, rejects.attempts)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Errorf("backoff waits = %v", waits)
+	}
+	ds, err := ReadDeadLetters(c.DeadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Endpoint != "down" || ds[0].Attempts != 3 || ds[1].Endpoint != "rejects" || ds[1].Payload.Build.ID != 7 {
+		t.Errorf("unexpected dead letters %+v", ds)
+	}
+}
+
+// TestServeDeadLettersMatchErrors tests that events whose project cannot be
+// looked up are dead-lettered and reported
+func TestServeDeadLettersMatchErrors(t *testing.T) {
+	tc := httptest.NewServer(http.NotFoundHandler())
+	defer tc.Close()
+	d, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	all := &receiver{t: t}
+	ars := httptest.NewServer(all)
+	defer ars.Close()
+	var errs []error
+	c := &Config{
+		Client: teamcity.New(tc.URL, "", ""),
+		Endpoints: []Endpoint{
+			{Name: "all", URL: ars.URL},
+			{Name: "payments", URL: ars.URL, Projects: []string{"Payments"}},
+		},
+		DeadLetterFile: filepath.Join(d, "dead.jsonl"),
+		OnError:        func(e watch.Event, err error) { errs = append(errs, err) },
+	}
+	evs := make(chan watch.Event, 1)
+	evs <- failedEvent(5, "Payments_Build")
+	close(evs)
+	c.Serve(evs)
+	if len(errs) != 1 {
+		t.Errorf("reported errors = %v", errs)
+	}
+	if len(all.payloads) != 1 || all.payloads[0].Build.ID != 5 {
+		t.Errorf("unfiltered endpoint got %+v", all.payloads)
+	}
+	ds, err := ReadDeadLetters(c.DeadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Endpoint != "payments" || ds[0].Attempts != 0 || ds[0].Payload.Build.ID != 5 {
+		t.Errorf("unexpected dead letters %+v", ds)
+	}
+}
+
+// TestTreeLookupUnlocked tests that a slow project lookup does not block cached lookups
+func TestTreeLookupUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	tc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"project":[{"id":"Slow","parentProjectId":"_Root"}]}`))
+	}))
+	defer tc.Close()
+	defer close(release)
+	c := &Config{Client: teamcity.New(tc.URL, "", ""), trees: map[string]map[string]bool{"Cached": {"Cached": true}}}
+	bc := &build.Config{Client: c.Client}
+	go c.tree(bc, "Slow")
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		c.tree(bc, "Cached")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("cached lookup blocked by a slow lookup")
+	}
+}